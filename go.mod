@@ -7,4 +7,4 @@ require (
 	github.com/creack/pty v1.1.21
 )
 
-require golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
+require golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5
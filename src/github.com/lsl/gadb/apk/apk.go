@@ -0,0 +1,274 @@
+package apk
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Info is what gadb reads from an APK
+type Info struct {
+	Package     string `json:"package"`
+	VersionCode int64  `json:"versionCode"`
+	VersionName string `json:"versionName"`
+	Label       string `json:"label,omitempty"`
+	// Split is the split name, such as "config.arm64_v8a", empty for
+	// a base or single APK
+	Split     string `json:"split,omitempty"`
+	MinSdk    int    `json:"minSdk"`
+	TargetSdk int    `json:"targetSdk"`
+	// LaunchActivity is the fully qualified activity (or alias)
+	// handling MAIN/LAUNCHER, empty when the app has none
+	LaunchActivity string   `json:"launchActivity,omitempty"`
+	Permissions    []string `json:"permissions"`
+	// ABIs are the lib/<abi>/ directories with native code; an APK
+	// without any runs on every ABI
+	ABIs []string `json:"abis"`
+}
+
+// Component returns the launch activity as "package/activity" for
+// am start -n, empty when there is none
+func (info *Info) Component() string {
+	if info.LaunchActivity == "" {
+		return ""
+	}
+	return info.Package + "/" + info.LaunchActivity
+}
+
+// Open reads the APK at path
+func Open(path string) (*Info, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer zr.Close()
+	info, err := Read(&zr.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// Read reads an APK from an open zip archive
+func Read(zr *zip.Reader) (*Info, error) {
+	manifest, err := readZipFile(zr, "AndroidManifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("no AndroidManifest.xml")
+	}
+	root, err := ParseXML(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("bad AndroidManifest.xml: %w", err)
+	}
+	// Without a resource table references are shown as ids
+	var table *Table
+	if arsc, err := readZipFile(zr, "resources.arsc"); err == nil && arsc != nil {
+		table, _ = ParseTable(arsc)
+	}
+
+	info := manifestInfo(root, table)
+	info.ABIs = nativeABIs(zr)
+	return info, nil
+}
+
+// readZipFile returns the contents of a zip entry, nil when absent
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// manifestInfo collects the manifest's details
+func manifestInfo(root *Element, table *Table) *Info {
+	info := &Info{
+		Package:     root.Value("package"),
+		Split:       root.Value("split"),
+		VersionName: table.Resolve(attrOrEmpty(root, "versionName")),
+		MinSdk:      1,
+		Permissions: []string{},
+	}
+	if a, ok := root.Attr("versionCode"); ok {
+		info.VersionCode, _ = a.Int()
+	}
+	if sdk := root.Find("uses-sdk"); len(sdk) > 0 {
+		if a, ok := sdk[0].Attr("minSdkVersion"); ok {
+			if n, ok := a.Int(); ok {
+				info.MinSdk = int(n)
+			}
+		}
+		if a, ok := sdk[0].Attr("targetSdkVersion"); ok {
+			if n, ok := a.Int(); ok {
+				info.TargetSdk = int(n)
+			}
+		}
+	}
+	if info.TargetSdk == 0 {
+		info.TargetSdk = info.MinSdk
+	}
+	for _, tag := range []string{"uses-permission", "uses-permission-sdk-23"} {
+		for _, p := range root.Find(tag) {
+			if name := p.Value("name"); name != "" {
+				info.Permissions = append(info.Permissions, name)
+			}
+		}
+	}
+	if app := root.Find("application"); len(app) > 0 {
+		info.Label = table.Resolve(attrOrEmpty(app[0], "label"))
+		info.LaunchActivity = launchActivity(app[0], info.Package)
+	}
+	return info
+}
+
+// attrOrEmpty returns the attribute, or an empty one when absent
+func attrOrEmpty(e *Element, name string) Attr {
+	a, _ := e.Attr(name)
+	return a
+}
+
+// launchActivity finds the first activity or alias with a MAIN and
+// LAUNCHER intent filter
+func launchActivity(app *Element, pkg string) string {
+	for _, c := range app.Children {
+		if c.Name != "activity" && c.Name != "activity-alias" {
+			continue
+		}
+		if a, ok := c.Attr("enabled"); ok && a.String() == "false" {
+			continue
+		}
+		for _, filter := range c.Find("intent-filter") {
+			if hasName(filter.Find("action"), "android.intent.action.MAIN") &&
+				hasName(filter.Find("category"), "android.intent.category.LAUNCHER") {
+				return qualifyName(pkg, c.Value("name"))
+			}
+		}
+	}
+	return ""
+}
+
+// Components are the components of a manifest, as fully qualified
+// class names
+type Components struct {
+	Activities []string
+	Services   []string
+	Receivers  []string
+}
+
+// ExportedComponents returns the enabled activities (and aliases),
+// services and receivers of a binary manifest that other apps and the
+// shell can start
+func ExportedComponents(manifest []byte) (*Components, error) {
+	root, err := ParseXML(manifest)
+	if err != nil {
+		return nil, err
+	}
+	pkg := root.Value("package")
+	c := &Components{}
+	for _, app := range root.Find("application") {
+		for _, e := range app.Children {
+			if !isExported(e) {
+				continue
+			}
+			name := qualifyName(pkg, e.Value("name"))
+			switch e.Name {
+			case "activity", "activity-alias":
+				c.Activities = append(c.Activities, name)
+			case "service":
+				c.Services = append(c.Services, name)
+			case "receiver":
+				c.Receivers = append(c.Receivers, name)
+			}
+		}
+	}
+	sort.Strings(c.Activities)
+	sort.Strings(c.Services)
+	sort.Strings(c.Receivers)
+	return c, nil
+}
+
+// isExported reports whether an enabled component is exported; without
+// android:exported a component is exported when it has an intent filter
+func isExported(e *Element) bool {
+	if a, ok := e.Attr("enabled"); ok && a.String() == "false" {
+		return false
+	}
+	if a, ok := e.Attr("exported"); ok {
+		return a.String() == "true"
+	}
+	return len(e.Find("intent-filter")) > 0
+}
+
+// hasName reports whether one of the elements has the android:name
+func hasName(elements []*Element, name string) bool {
+	for _, e := range elements {
+		if e.Value("name") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifyName expands a manifest class name relative to the package:
+// ".Main" and "Main" both become "<pkg>.Main"
+func qualifyName(pkg, name string) string {
+	switch {
+	case strings.HasPrefix(name, "."):
+		return pkg + name
+	case !strings.Contains(name, "."):
+		return pkg + "." + name
+	}
+	return name
+}
+
+// nativeABIs lists the ABIs under lib/
+func nativeABIs(zr *zip.Reader) []string {
+	seen := map[string]bool{}
+	abis := []string{}
+	for _, f := range zr.File {
+		rest, ok := strings.CutPrefix(f.Name, "lib/")
+		if !ok {
+			continue
+		}
+		abi, file, ok := strings.Cut(rest, "/")
+		if !ok || abi == "" || file == "" || seen[abi] {
+			continue
+		}
+		seen[abi] = true
+		abis = append(abis, abi)
+	}
+	sort.Strings(abis)
+	return abis
+}
+
+// SupportsABI reports whether a device with the ABIs (from
+// ro.product.cpu.abilist, most preferred first) can run the APK, and
+// the ABI it would use; APKs without native code run everywhere
+func (info *Info) SupportsABI(deviceABIs []string) (string, bool) {
+	if len(info.ABIs) == 0 {
+		return "", true
+	}
+	for _, d := range deviceABIs {
+		for _, a := range info.ABIs {
+			if a == d {
+				return a, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,404 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// The tests build manifests and tables with the chunk layouts aapt and
+// aapt2 write, so no binary fixtures need to be checked in
+
+type testAttr struct {
+	android bool
+	name    string
+	// str is a raw string value; otherwise typ and data are used
+	str  string
+	typ  uint8
+	data uint32
+}
+
+type testNode struct {
+	name     string
+	attrs    []testAttr
+	children []testNode
+}
+
+// attrIDs is attrNames reversed
+var attrIDs = func() map[string]uint32 {
+	ids := map[string]uint32{}
+	for id, name := range attrNames {
+		ids[name] = id
+	}
+	return ids
+}()
+
+// poolBuilder assigns string indices
+type poolBuilder struct {
+	strings []string
+	index   map[string]uint32
+}
+
+func (p *poolBuilder) add(s string) uint32 {
+	if i, ok := p.index[s]; ok {
+		return i
+	}
+	if p.index == nil {
+		p.index = map[string]uint32{}
+	}
+	p.index[s] = uint32(len(p.strings))
+	p.strings = append(p.strings, s)
+	return p.index[s]
+}
+
+func writeChunk(buf *bytes.Buffer, typ uint16, header, body []byte) {
+	le := binary.LittleEndian
+	buf.Write(le.AppendUint16(nil, typ))
+	buf.Write(le.AppendUint16(nil, uint16(8+len(header))))
+	buf.Write(le.AppendUint32(nil, uint32(8+len(header)+len(body))))
+	buf.Write(header)
+	buf.Write(body)
+}
+
+// encodePool writes a string pool chunk; hidden strings are written
+// empty, as obfuscators leave them
+func encodePool(strs []string, utf8 bool, hidden map[int]bool) []byte {
+	le := binary.LittleEndian
+	var offsets, data []byte
+	for i, s := range strs {
+		if hidden[i] {
+			s = ""
+		}
+		offsets = le.AppendUint32(offsets, uint32(len(data)))
+		if utf8 {
+			data = append(data, byte(len([]rune(s))), byte(len(s)))
+			data = append(data, s...)
+			data = append(data, 0)
+		} else {
+			units := utf16.Encode([]rune(s))
+			data = le.AppendUint16(data, uint16(len(units)))
+			for _, u := range units {
+				data = le.AppendUint16(data, u)
+			}
+			data = le.AppendUint16(data, 0)
+		}
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	var flags uint32
+	if utf8 {
+		flags = 1 << 8
+	}
+	header := le.AppendUint32(nil, uint32(len(strs)))
+	header = le.AppendUint32(header, 0)
+	header = le.AppendUint32(header, flags)
+	header = le.AppendUint32(header, uint32(28+len(offsets)))
+	header = le.AppendUint32(header, 0)
+	var buf bytes.Buffer
+	writeChunk(&buf, chunkStringPool, header, append(offsets, data...))
+	return buf.Bytes()
+}
+
+// buildXML encodes a document; with stripNames the android attribute
+// names are left out of the pool and found through the resource map
+func buildXML(root testNode, utf8, stripNames bool) []byte {
+	le := binary.LittleEndian
+	var pool poolBuilder
+	var resMap []byte
+	var walkIDs func(n testNode)
+	walkIDs = func(n testNode) {
+		for _, a := range n.attrs {
+			if id, ok := attrIDs[a.name]; ok && a.android {
+				if _, seen := pool.index[a.name]; !seen {
+					pool.add(a.name)
+					resMap = le.AppendUint32(resMap, id)
+				}
+			}
+		}
+		for _, c := range n.children {
+			walkIDs(c)
+		}
+	}
+	walkIDs(root)
+	hidden := map[int]bool{}
+	if stripNames {
+		for i := range pool.strings {
+			hidden[i] = true
+		}
+	}
+	ns := pool.add(AndroidNS)
+	prefix := pool.add("android")
+
+	var body bytes.Buffer
+	node := func(line uint32) []byte {
+		return le.AppendUint32(le.AppendUint32(nil, line), noIndex)
+	}
+	nsExt := le.AppendUint32(le.AppendUint32(nil, prefix), ns)
+	writeChunk(&body, chunkXMLStartNS, node(1), nsExt)
+	var walk func(n testNode)
+	walk = func(n testNode) {
+		name := pool.add(n.name)
+		ext := le.AppendUint32(nil, noIndex)
+		ext = le.AppendUint32(ext, name)
+		ext = le.AppendUint16(ext, 20)
+		ext = le.AppendUint16(ext, 20)
+		ext = le.AppendUint16(ext, uint16(len(n.attrs)))
+		ext = append(ext, make([]byte, 6)...)
+		for _, a := range n.attrs {
+			attrNS := uint32(noIndex)
+			if a.android {
+				attrNS = ns
+			}
+			raw, typ, data := uint32(noIndex), a.typ, a.data
+			if a.str != "" {
+				raw = pool.add(a.str)
+				typ, data = typeString, raw
+			}
+			ext = le.AppendUint32(ext, attrNS)
+			ext = le.AppendUint32(ext, pool.add(a.name))
+			ext = le.AppendUint32(ext, raw)
+			ext = append(ext, 8, 0, 0, typ)
+			ext = le.AppendUint32(ext, data)
+		}
+		writeChunk(&body, chunkXMLStart, node(1), ext)
+		for _, c := range n.children {
+			walk(c)
+		}
+		writeChunk(&body, chunkXMLEnd, node(1), le.AppendUint32(le.AppendUint32(nil, noIndex), name))
+	}
+	walk(root)
+	writeChunk(&body, chunkXMLEndNS, node(1), nsExt)
+
+	var doc, inner bytes.Buffer
+	inner.Write(encodePool(pool.strings, utf8, hidden))
+	writeChunk(&inner, chunkXMLResMap, nil, resMap)
+	inner.Write(body.Bytes())
+	writeChunk(&doc, chunkXML, nil, inner.Bytes())
+	return doc.Bytes()
+}
+
+// testConfig is one configuration of buildTable; values map entry
+// indices of type 1 to (type, data)
+type testConfig struct {
+	language string
+	values   map[int][2]uint32
+}
+
+// buildTable encodes a resources.arsc with package 0x7f and one type
+func buildTable(strs []string, configs []testConfig) []byte {
+	le := binary.LittleEndian
+	var pkgBody bytes.Buffer
+	for _, cfg := range configs {
+		count := 0
+		for i := range cfg.values {
+			count = max(count, i+1)
+		}
+		config := make([]byte, 64)
+		le.PutUint32(config, 64)
+		copy(config[8:10], cfg.language)
+		var offsets, entries []byte
+		for i := 0; i < count; i++ {
+			v, ok := cfg.values[i]
+			if !ok {
+				offsets = le.AppendUint32(offsets, noIndex)
+				continue
+			}
+			offsets = le.AppendUint32(offsets, uint32(len(entries)))
+			entries = le.AppendUint16(entries, 8)
+			entries = le.AppendUint16(entries, 0)
+			entries = le.AppendUint32(entries, 0)
+			entries = append(entries, 8, 0, 0, byte(v[0]))
+			entries = le.AppendUint32(entries, v[1])
+		}
+		header := []byte{1, 0, 0, 0}
+		header = le.AppendUint32(header, uint32(count))
+		header = le.AppendUint32(header, uint32(8+12+64+len(offsets)))
+		header = append(header, config...)
+		writeChunk(&pkgBody, chunkTableType, header, append(offsets, entries...))
+	}
+	pkgHeader := le.AppendUint32(nil, 0x7f)
+	pkgHeader = append(pkgHeader, make([]byte, 256+20)...)
+
+	var inner, table bytes.Buffer
+	inner.Write(encodePool(strs, false, nil))
+	writeChunk(&inner, chunkTablePackage, pkgHeader, pkgBody.Bytes())
+	writeChunk(&table, chunkTable, le.AppendUint32(nil, 1), inner.Bytes())
+	return table.Bytes()
+}
+
+// writeAPK zips the files into an APK under dir
+func writeAPK(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.apk")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// launcherFilter is a MAIN/LAUNCHER intent filter
+var launcherFilter = testNode{name: "intent-filter", children: []testNode{
+	{name: "action", attrs: []testAttr{{android: true, name: "name", str: "android.intent.action.MAIN"}}},
+	{name: "category", attrs: []testAttr{{android: true, name: "name", str: "android.intent.category.LAUNCHER"}}},
+}}
+
+func testManifest(versionCode testAttr) testNode {
+	return testNode{
+		name: "manifest",
+		attrs: []testAttr{
+			{name: "package", str: "com.example.app"},
+			versionCode,
+			{android: true, name: "versionName", typ: typeReference, data: 0x7f010001},
+		},
+		children: []testNode{
+			{name: "uses-sdk", attrs: []testAttr{
+				{android: true, name: "minSdkVersion", typ: typeIntDec, data: 24},
+				{android: true, name: "targetSdkVersion", typ: typeIntDec, data: 34},
+			}},
+			{name: "uses-permission", attrs: []testAttr{{android: true, name: "name", str: "android.permission.INTERNET"}}},
+			{name: "uses-permission", attrs: []testAttr{{android: true, name: "name", str: "android.permission.CAMERA"}}},
+			{name: "application", attrs: []testAttr{
+				{android: true, name: "label", typ: typeReference, data: 0x7f010000},
+			}, children: []testNode{
+				{name: "activity", attrs: []testAttr{{android: true, name: "name", str: ".Settings"}}},
+				{name: "activity", attrs: []testAttr{{android: true, name: "name", str: ".MainActivity"}},
+					children: []testNode{launcherFilter}},
+			}},
+		},
+	}
+}
+
+func TestOpen(t *testing.T) {
+	// label -> (reference) -> "Example" in the default config, with a
+	// French value listed first
+	table := buildTable([]string{"Exemple", "Example", "1.2.3"}, []testConfig{
+		{language: "fr", values: map[int][2]uint32{2: {typeString, 0}}},
+		{values: map[int][2]uint32{0: {typeReference, 0x7f010002}, 1: {typeString, 2}, 2: {typeString, 1}}},
+	})
+	manifest := buildXML(testManifest(testAttr{android: true, name: "versionCode", typ: typeIntDec, data: 1203}), false, false)
+	path := writeAPK(t, map[string][]byte{
+		"AndroidManifest.xml":     manifest,
+		"resources.arsc":          table,
+		"classes.dex":             {0},
+		"lib/x86_64/libfoo.so":    {0},
+		"lib/arm64-v8a/libfoo.so": {0},
+		"lib/arm64-v8a/libbar.so": {0},
+	})
+
+	info, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Info{
+		Package:        "com.example.app",
+		VersionCode:    1203,
+		VersionName:    "1.2.3",
+		Label:          "Example",
+		MinSdk:         24,
+		TargetSdk:      34,
+		LaunchActivity: "com.example.app.MainActivity",
+		Permissions:    []string{"android.permission.INTERNET", "android.permission.CAMERA"},
+		ABIs:           []string{"arm64-v8a", "x86_64"},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("Open = %+v, want %+v", info, want)
+	}
+	if c := info.Component(); c != "com.example.app/com.example.app.MainActivity" {
+		t.Errorf("Component = %q", c)
+	}
+}
+
+func TestParseXMLStrippedNames(t *testing.T) {
+	// UTF-8 pool, attribute names only in the resource map, and a hex
+	// versionCode above the int32 range
+	data := buildXML(testManifest(testAttr{android: true, name: "versionCode", typ: typeIntHex, data: 0x80000001}), true, true)
+	root, err := ParseXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := manifestInfo(root, nil)
+	if info.Package != "com.example.app" || info.VersionCode != 0x80000001 || info.MinSdk != 24 || info.TargetSdk != 34 {
+		t.Errorf("manifestInfo = %+v", info)
+	}
+	if info.VersionName != "@0x7f010001" {
+		t.Errorf("VersionName without a table = %q, want the reference", info.VersionName)
+	}
+	if info.LaunchActivity != "com.example.app.MainActivity" {
+		t.Errorf("LaunchActivity = %q", info.LaunchActivity)
+	}
+}
+
+func TestExportedComponents(t *testing.T) {
+	name := func(n string) testAttr { return testAttr{android: true, name: "name", str: n} }
+	exported := func(b bool) testAttr {
+		a := testAttr{android: true, name: "exported", typ: typeIntBool}
+		if b {
+			a.data = 0xffffffff
+		}
+		return a
+	}
+	filter := testNode{name: "intent-filter", children: []testNode{
+		{name: "action", attrs: []testAttr{name("com.example.app.ACTION")}},
+	}}
+	manifest := testNode{
+		name:  "manifest",
+		attrs: []testAttr{{name: "package", str: "com.example.app"}},
+		children: []testNode{{name: "application", children: []testNode{
+			{name: "activity", attrs: []testAttr{name(".Main")}, children: []testNode{launcherFilter}},
+			{name: "activity", attrs: []testAttr{name(".DeepLink"), exported(true)}},
+			{name: "activity", attrs: []testAttr{name(".Internal")}},
+			{name: "activity", attrs: []testAttr{name(".Filtered"), exported(false)}, children: []testNode{filter}},
+			{name: "activity", attrs: []testAttr{name(".Off"), exported(true), {android: true, name: "enabled", typ: typeIntBool}}},
+			{name: "activity-alias", attrs: []testAttr{name(".Alias"), exported(true)}},
+			{name: "service", attrs: []testAttr{name("com.example.lib.SyncService"), exported(true)}},
+			{name: "service", attrs: []testAttr{name(".Private")}},
+			{name: "receiver", attrs: []testAttr{name(".Boot")}, children: []testNode{filter}},
+		}}},
+	}
+
+	for _, strip := range []bool{false, true} {
+		c, err := ExportedComponents(buildXML(manifest, false, strip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &Components{
+			Activities: []string{"com.example.app.Alias", "com.example.app.DeepLink", "com.example.app.Main"},
+			Services:   []string{"com.example.lib.SyncService"},
+			Receivers:  []string{"com.example.app.Boot"},
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("ExportedComponents (stripped names %v) = %+v, want %+v", strip, c, want)
+		}
+	}
+}
+
+func TestSupportsABI(t *testing.T) {
+	info := &Info{ABIs: []string{"armeabi-v7a", "arm64-v8a"}}
+	if abi, ok := info.SupportsABI([]string{"arm64-v8a", "armeabi-v7a", "armeabi"}); !ok || abi != "arm64-v8a" {
+		t.Errorf("SupportsABI = %q, %v, want the device's preferred arm64-v8a", abi, ok)
+	}
+	if _, ok := info.SupportsABI([]string{"x86_64", "x86"}); ok {
+		t.Error("SupportsABI accepted an x86 device")
+	}
+	if _, ok := (&Info{}).SupportsABI([]string{"x86"}); !ok {
+		t.Error("SupportsABI refused an APK without native code")
+	}
+}
@@ -0,0 +1,171 @@
+package apk
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Table entry flags
+const (
+	entryComplex = 0x0001
+	entryCompact = 0x0008
+)
+
+// Type chunk flags
+const (
+	typeSparse   = 0x01
+	typeOffset16 = 0x02
+)
+
+// tableValue is one simple resource value
+type tableValue struct {
+	typ  uint8
+	data uint32
+	// isDefault marks values from the default configuration
+	isDefault bool
+}
+
+// Table is a decoded resources.arsc, holding the simple values of each
+// resource; values from the default configuration are preferred
+type Table struct {
+	strings stringPool
+	values  map[uint32]tableValue
+}
+
+// ParseTable decodes a resources.arsc
+func ParseTable(data []byte) (*Table, error) {
+	head, err := readChunk(data)
+	if err != nil {
+		return nil, err
+	}
+	if head.typ != chunkTable {
+		return nil, fmt.Errorf("not a resource table (chunk 0x%04x)", head.typ)
+	}
+	list, err := chunks(head.data[head.headerSize:])
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{values: make(map[uint32]tableValue)}
+	for _, c := range list {
+		switch c.typ {
+		case chunkStringPool:
+			if t.strings, err = parseStringPool(c); err != nil {
+				return nil, err
+			}
+		case chunkTablePackage:
+			if err := t.parsePackage(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// parsePackage reads the type chunks of a package
+func (t *Table) parsePackage(pkg chunk) error {
+	id := u32(pkg.data, 8)
+	list, err := chunks(pkg.data[pkg.headerSize:])
+	if err != nil {
+		return fmt.Errorf("package 0x%02x: %w", id, err)
+	}
+	for _, c := range list {
+		if c.typ == chunkTableType {
+			t.parseType(id, c)
+		}
+	}
+	return nil
+}
+
+// parseType reads the entries of one type chunk
+func (t *Table) parseType(pkgID uint32, c chunk) {
+	b := c.data
+	typeID := uint32(b[8])
+	flags := b[9]
+	count := int(u32(b, 12))
+	entriesStart := int(u32(b, 16))
+	// The configuration follows, starting with its own size; the
+	// default configuration is all zeros
+	configSize := int(u32(b, 20))
+	isDefault := configSize >= 4 && 20+configSize <= len(b) &&
+		bytes.Count(b[24:20+configSize], []byte{0}) == configSize-4
+
+	for i := 0; i < count; i++ {
+		idx, off := i, -1
+		switch {
+		case flags&typeSparse != 0:
+			idx = int(u16(b, c.headerSize+4*i))
+			off = int(u16(b, c.headerSize+4*i+2)) * 4
+		case flags&typeOffset16 != 0:
+			if v := u16(b, c.headerSize+2*i); v != 0xffff {
+				off = int(v) * 4
+			}
+		default:
+			if v := u32(b, c.headerSize+4*i); v != noIndex {
+				off = int(v)
+			}
+		}
+		if off < 0 {
+			continue
+		}
+		v, ok := readEntry(b, entriesStart+off)
+		if !ok {
+			continue
+		}
+		v.isDefault = isDefault
+		id := pkgID<<24 | typeID<<16 | uint32(idx)
+		if old, seen := t.values[id]; !seen || v.isDefault && !old.isDefault {
+			t.values[id] = v
+		}
+	}
+}
+
+// readEntry reads a simple entry; maps (styles, arrays) are skipped
+func readEntry(b []byte, off int) (tableValue, bool) {
+	if off+8 > len(b) {
+		return tableValue{}, false
+	}
+	size := int(u16(b, off))
+	flags := u16(b, off+2)
+	if flags&entryCompact != 0 {
+		// Compact entries keep the type in the high byte of the flags
+		// and the data where the key would be
+		return tableValue{typ: uint8(flags >> 8), data: u32(b, off+4)}, true
+	}
+	if flags&entryComplex != 0 || off+size+8 > len(b) {
+		return tableValue{}, false
+	}
+	return tableValue{typ: b[off+size+3], data: u32(b, off+size+4)}, true
+}
+
+// maxReferenceDepth bounds reference chains so cycles end
+const maxReferenceDepth = 8
+
+// String resolves a resource to a string, following references
+func (t *Table) String(id uint32) (string, bool) {
+	for depth := 0; depth < maxReferenceDepth; depth++ {
+		v, ok := t.values[id]
+		if !ok {
+			return "", false
+		}
+		switch v.typ {
+		case typeString:
+			return t.strings.get(v.data), true
+		case typeReference:
+			id = v.data
+		default:
+			return Attr{Type: v.typ, Data: v.data}.String(), true
+		}
+	}
+	return "", false
+}
+
+// Resolve returns an attribute's value, looking references up in the
+// table; t may be nil, leaving references as they are
+func (t *Table) Resolve(a Attr) string {
+	if t != nil && a.IsReference() {
+		if s, ok := t.String(a.Data); ok {
+			return s
+		}
+	}
+	return a.String()
+}
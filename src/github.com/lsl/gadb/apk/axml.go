@@ -0,0 +1,223 @@
+package apk
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// AndroidNS is the namespace of android: attributes
+const AndroidNS = "http://schemas.android.com/apk/res/android"
+
+// Res_value data types
+const (
+	typeNull      = 0x00
+	typeReference = 0x01
+	typeAttribute = 0x02
+	typeString    = 0x03
+	typeFloat     = 0x04
+	typeIntDec    = 0x10
+	typeIntHex    = 0x11
+	typeIntBool   = 0x12
+)
+
+// attrNames names framework attributes by resource id, for manifests
+// whose attribute name strings were stripped by obfuscators
+var attrNames = map[uint32]string{
+	0x01010001: "label",
+	0x01010002: "icon",
+	0x01010003: "name",
+	0x0101000e: "enabled",
+	0x0101000f: "debuggable",
+	0x01010010: "exported",
+	0x01010202: "targetActivity",
+	0x0101020c: "minSdkVersion",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+	0x01010270: "targetSdkVersion",
+	0x01010271: "maxSdkVersion",
+	0x01010572: "compileSdkVersion",
+}
+
+// Attr is an attribute of a binary XML element
+type Attr struct {
+	Namespace string
+	Name      string
+	// Raw is the attribute's original string, empty when it was
+	// compiled to a typed value
+	Raw  string
+	Type uint8
+	Data uint32
+}
+
+// IsReference reports whether the value refers to a resource
+func (a Attr) IsReference() bool {
+	return a.Raw == "" && a.Type == typeReference
+}
+
+// String returns the value as aapt dump prints it, references as
+// "@0x7f0a0001"
+func (a Attr) String() string {
+	if a.Raw != "" {
+		return a.Raw
+	}
+	switch a.Type {
+	case typeNull:
+		return ""
+	case typeReference:
+		return fmt.Sprintf("@0x%08x", a.Data)
+	case typeAttribute:
+		return fmt.Sprintf("?0x%08x", a.Data)
+	case typeIntDec:
+		return strconv.Itoa(int(int32(a.Data)))
+	case typeIntHex:
+		return fmt.Sprintf("0x%x", a.Data)
+	case typeIntBool:
+		return strconv.FormatBool(a.Data != 0)
+	}
+	return fmt.Sprintf("0x%08x", a.Data)
+}
+
+// Int returns the value as an integer, parsing strings
+func (a Attr) Int() (int64, bool) {
+	if a.Raw != "" {
+		n, err := strconv.ParseInt(a.Raw, 0, 64)
+		return n, err == nil
+	}
+	switch a.Type {
+	case typeIntDec:
+		return int64(int32(a.Data)), true
+	case typeIntHex:
+		// versionCode is declared as a hex int but is unsigned
+		return int64(a.Data), true
+	}
+	return 0, false
+}
+
+// Element is an element of a binary XML document
+type Element struct {
+	Name     string
+	Attrs    []Attr
+	Children []*Element
+}
+
+// Attr returns the attribute with the local name, preferring the
+// android namespace
+func (e *Element) Attr(name string) (Attr, bool) {
+	var found Attr
+	ok := false
+	for _, a := range e.Attrs {
+		if a.Name != name {
+			continue
+		}
+		if a.Namespace == AndroidNS {
+			return a, true
+		}
+		if !ok {
+			found, ok = a, true
+		}
+	}
+	return found, ok
+}
+
+// Value returns the string value of an attribute, "" when absent
+func (e *Element) Value(name string) string {
+	a, _ := e.Attr(name)
+	return a.String()
+}
+
+// Find returns the direct children with the name
+func (e *Element) Find(name string) []*Element {
+	var found []*Element
+	for _, c := range e.Children {
+		if c.Name == name {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// ParseXML decodes a binary XML document such as a compiled
+// AndroidManifest.xml and returns its root element
+func ParseXML(data []byte) (*Element, error) {
+	doc, err := readChunk(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.typ != chunkXML {
+		return nil, fmt.Errorf("not a binary XML document (chunk 0x%04x)", doc.typ)
+	}
+	list, err := chunks(doc.data[doc.headerSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	var pool stringPool
+	var resMap []uint32
+	var root *Element
+	var stack []*Element
+	for _, c := range list {
+		switch c.typ {
+		case chunkStringPool:
+			if pool, err = parseStringPool(c); err != nil {
+				return nil, err
+			}
+		case chunkXMLResMap:
+			for off := c.headerSize; off+4 <= len(c.data); off += 4 {
+				resMap = append(resMap, u32(c.data, off))
+			}
+		case chunkXMLStart:
+			e := parseElement(c, pool, resMap)
+			if len(stack) == 0 {
+				if root == nil {
+					root = e
+				}
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, e)
+			}
+			stack = append(stack, e)
+		case chunkXMLEnd:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("binary XML has no elements")
+	}
+	return root, nil
+}
+
+// parseElement decodes a start element chunk
+func parseElement(c chunk, pool stringPool, resMap []uint32) *Element {
+	b := c.data
+	ext := c.headerSize
+	e := &Element{Name: pool.get(u32(b, ext+4))}
+	attrStart := int(u16(b, ext+8))
+	attrSize := int(u16(b, ext+10))
+	count := int(u16(b, ext+12))
+	if attrSize < 20 {
+		attrSize = 20
+	}
+	for i := 0; i < count; i++ {
+		off := ext + attrStart + i*attrSize
+		if off+20 > len(b) {
+			break
+		}
+		nameIdx := u32(b, off+4)
+		a := Attr{
+			Namespace: pool.get(u32(b, off)),
+			Name:      pool.get(nameIdx),
+			Raw:       pool.get(u32(b, off+8)),
+			Type:      b[off+15],
+			Data:      u32(b, off+16),
+		}
+		if int(nameIdx) < len(resMap) {
+			if name, ok := attrNames[resMap[nameIdx]]; ok {
+				a.Name = name
+			}
+		}
+		e.Attrs = append(e.Attrs, a)
+	}
+	return e
+}
@@ -0,0 +1,344 @@
+package apk
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BundleExts are the archive extensions holding split APKs: bundletool
+// build-apks output and the XAPK format of app stores
+var BundleExts = []string{".apks", ".xapk"}
+
+// IsBundle reports whether path is a split APK archive or a directory
+// holding APKs
+func IsBundle(path string) bool {
+	for _, ext := range BundleExts {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return true
+		}
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		return false
+	}
+	apks, _ := filepath.Glob(filepath.Join(path, "*.apk"))
+	return len(apks) > 0
+}
+
+// Split is one APK of a bundle
+type Split struct {
+	Path string
+	Info *Info
+}
+
+// Name returns the split name, "base" for the base APK
+func (s *Split) Name() string {
+	if s.Info.Split == "" {
+		return "base"
+	}
+	return s.Info.Split
+}
+
+// Bundle is an app made of a base APK and splits
+type Bundle struct {
+	Base   *Split
+	Splits []*Split
+	// tmp is the directory an archive was extracted to
+	tmp string
+}
+
+// OpenBundle reads the APKs of an .apks or .xapk archive, or those in
+// a directory; archives are extracted to a temporary directory that
+// Close removes
+func OpenBundle(path string) (*Bundle, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{}
+	dir := path
+	if !fi.IsDir() {
+		if b.tmp, err = extractAPKs(path); err != nil {
+			return nil, err
+		}
+		dir = b.tmp
+	}
+	if err := b.load(dir); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// load opens the APKs directly in dir
+func (b *Bundle) load(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".apk") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		info, err := Open(path)
+		if err != nil {
+			return err
+		}
+		s := &Split{Path: path, Info: info}
+		if info.Split == "" {
+			if b.Base != nil {
+				return fmt.Errorf("two base APKs: %s and %s", filepath.Base(b.Base.Path), e.Name())
+			}
+			b.Base = s
+		}
+		b.Splits = append(b.Splits, s)
+	}
+	if b.Base == nil {
+		return fmt.Errorf("no base APK found")
+	}
+	for _, s := range b.Splits {
+		if s.Info.Package != b.Base.Info.Package {
+			return fmt.Errorf("%s belongs to %s, not %s", filepath.Base(s.Path), s.Info.Package, b.Base.Info.Package)
+		}
+	}
+	return nil
+}
+
+// skippedBundleDirs hold APKs of a bundletool archive that are not
+// installed with the splits: standalone APKs for pre-Lollipop devices,
+// the instant app variant and asset pack slices
+var skippedBundleDirs = []string{"standalones/", "instant/", "asset-slices/"}
+
+// extractAPKs copies the APKs of an archive into a new temporary
+// directory, leaving out those under skippedBundleDirs
+func extractAPKs(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer zr.Close()
+	tmp, err := os.MkdirTemp("", "gadb-bundle-")
+	if err != nil {
+		return "", err
+	}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".apk") || inSkippedBundleDir(f.Name) {
+			continue
+		}
+		if err := extractFile(f, filepath.Join(tmp, filepath.Base(f.Name))); err != nil {
+			os.RemoveAll(tmp)
+			return "", fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+	}
+	return tmp, nil
+}
+
+// inSkippedBundleDir reports whether an archive entry is under one of
+// skippedBundleDirs
+func inSkippedBundleDir(name string) bool {
+	for _, dir := range skippedBundleDirs {
+		if strings.HasPrefix(name, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractFile writes one zip entry to dst
+func extractFile(f *zip.File, dst string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Close removes the extracted files, if any
+func (b *Bundle) Close() error {
+	if b.tmp == "" {
+		return nil
+	}
+	return os.RemoveAll(b.tmp)
+}
+
+// DeviceConfig is what split selection needs to know about a device
+type DeviceConfig struct {
+	// ABIs are the supported ABIs, most preferred first
+	ABIs []string
+	// Density is the screen density in dpi, 0 when unknown
+	Density int
+	// Locales are BCP 47 tags such as "en-US", most preferred first
+	Locales []string
+}
+
+// densities are the density qualifiers of config splits
+var densities = map[string]int{
+	"ldpi": 120, "mdpi": 160, "tvdpi": 213, "hdpi": 240,
+	"xhdpi": 320, "xxhdpi": 480, "xxxhdpi": 640,
+}
+
+// splitKind classifies config splits
+type splitKind int
+
+const (
+	kindOther splitKind = iota
+	kindABI
+	kindDensity
+	kindLanguage
+)
+
+// configSplit parses a config split name: "config.<qualifier>" for the
+// base module and "<module>.config.<qualifier>" for feature modules
+func configSplit(name string) (module, qualifier string, ok bool) {
+	if q, ok := strings.CutPrefix(name, "config."); ok {
+		return "", q, true
+	}
+	if i := strings.Index(name, ".config."); i > 0 {
+		return name[:i], name[i+len(".config."):], true
+	}
+	return "", "", false
+}
+
+// qualifierKind tells an ABI ("arm64_v8a"), a density ("xxhdpi") and a
+// language ("en", "pt_BR") apart
+func qualifierKind(q string) splitKind {
+	switch {
+	case isABI(strings.ReplaceAll(q, "_", "-")):
+		return kindABI
+	case densities[q] > 0:
+		return kindDensity
+	case len(q) == 2 || len(q) == 3 || len(q) > 3 && q[2] == '_':
+		return kindLanguage
+	}
+	return kindOther
+}
+
+// isABI reports whether s is an Android ABI name
+func isABI(s string) bool {
+	switch s {
+	case "armeabi", "armeabi-v7a", "arm64-v8a", "x86", "x86_64", "x86-64", "mips", "mips64", "riscv64":
+		return true
+	}
+	return false
+}
+
+// Select picks the APKs to install on a device: the base, every
+// feature module, and for each module the config splits for the
+// device's preferred ABI, closest density and languages; config
+// splits gadb does not recognize are kept
+func (b *Bundle) Select(d DeviceConfig) ([]*Split, error) {
+	type group struct {
+		module string
+		kind   splitKind
+	}
+	groups := map[group][]*Split{}
+	var selected []*Split
+	for _, s := range b.Splits {
+		module, q, ok := configSplit(s.Info.Split)
+		if !ok {
+			selected = append(selected, s)
+			continue
+		}
+		kind := qualifierKind(q)
+		if kind == kindOther {
+			selected = append(selected, s)
+			continue
+		}
+		g := group{module, kind}
+		groups[g] = append(groups[g], s)
+	}
+
+	for g, splits := range groups {
+		switch g.kind {
+		case kindABI:
+			s := pickABI(splits, d.ABIs)
+			if s == nil {
+				return nil, fmt.Errorf("no split for the device's ABIs (%s)", strings.Join(d.ABIs, ", "))
+			}
+			selected = append(selected, s)
+		case kindDensity:
+			selected = append(selected, pickDensity(splits, d.Density))
+		case kindLanguage:
+			selected = append(selected, pickLanguages(splits, d.Locales)...)
+		}
+	}
+	// Base first, then by name, so the install command reads well
+	sort.Slice(selected, func(i, j int) bool {
+		if (selected[i] == b.Base) != (selected[j] == b.Base) {
+			return selected[i] == b.Base
+		}
+		return selected[i].Info.Split < selected[j].Info.Split
+	})
+	return selected, nil
+}
+
+// pickABI returns the split for the most preferred ABI, nil when the
+// device supports none; with no ABI list the first split is taken
+func pickABI(splits []*Split, abis []string) *Split {
+	if len(abis) == 0 {
+		return splits[0]
+	}
+	for _, abi := range abis {
+		for _, s := range splits {
+			_, q, _ := configSplit(s.Info.Split)
+			if strings.ReplaceAll(q, "_", "-") == strings.ReplaceAll(abi, "_", "-") {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// pickDensity returns the split whose density is closest to the
+// device's, preferring higher densities as Android does when scaling
+func pickDensity(splits []*Split, dpi int) *Split {
+	if dpi == 0 {
+		dpi = densities["xxhdpi"]
+	}
+	var best *Split
+	bestScore := 0
+	for _, s := range splits {
+		_, q, _ := configSplit(s.Info.Split)
+		// Scaling down looks better than up, so lower densities count
+		// double
+		score := densities[q] - dpi
+		if score < 0 {
+			score = -2 * score
+		}
+		if best == nil || score < bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best
+}
+
+// pickLanguages returns the splits for the device's languages
+func pickLanguages(splits []*Split, locales []string) []*Split {
+	var picked []*Split
+	for _, s := range splits {
+		_, q, _ := configSplit(s.Info.Split)
+		lang, _, _ := strings.Cut(q, "_")
+		for _, l := range locales {
+			deviceLang, _, _ := strings.Cut(strings.ReplaceAll(l, "_", "-"), "-")
+			if strings.EqualFold(lang, deviceLang) {
+				picked = append(picked, s)
+				break
+			}
+		}
+	}
+	return picked
+}
@@ -0,0 +1,117 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// splitAPK returns an APK for a split of com.example.app
+func splitAPK(t *testing.T, split string) []byte {
+	t.Helper()
+	root := testManifest(testAttr{android: true, name: "versionCode", typ: typeIntDec, data: 7})
+	if split != "" {
+		root = testNode{name: "manifest", attrs: []testAttr{
+			{name: "package", str: "com.example.app"},
+			{name: "split", str: split},
+		}}
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("AndroidManifest.xml")
+	w.Write(buildXML(root, true, false))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBundleSelect(t *testing.T) {
+	// A bundletool .apks: splits/ holds what install-multiple needs,
+	// standalones/ is for pre-Lollipop devices, instant/ is the instant
+	// app and asset-slices/ are asset packs
+	splits := map[string]string{
+		"splits/base-master.apk":           "",
+		"splits/base-arm64_v8a.apk":        "config.arm64_v8a",
+		"splits/base-armeabi_v7a.apk":      "config.armeabi_v7a",
+		"splits/base-x86_64.apk":           "config.x86_64",
+		"splits/base-hdpi.apk":             "config.hdpi",
+		"splits/base-xxhdpi.apk":           "config.xxhdpi",
+		"splits/base-xxxhdpi.apk":          "config.xxxhdpi",
+		"splits/base-en.apk":               "config.en",
+		"splits/base-fr.apk":               "config.fr",
+		"splits/camera-master.apk":         "camera",
+		"splits/camera-arm64_v8a.apk":      "camera.config.arm64_v8a",
+		"splits/camera-armeabi_v7a.apk":    "camera.config.armeabi_v7a",
+		"splits/base-etc2.apk":             "config.etc2",
+		"standalones/standalone-x86.apk":   "",
+		"instant/instant-base-master.apk":  "",
+		"instant/base-master.apk":          "",
+		"asset-slices/textures-master.apk": "textures",
+	}
+	path := filepath.Join(t.TempDir(), "app.apks")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, split := range splits {
+		w, _ := zw.Create(name)
+		w.Write(splitAPK(t, split))
+	}
+	w, _ := zw.Create("toc.pb")
+	w.Write([]byte{0})
+	zw.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := OpenBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.Base == nil || b.Base.Info.LaunchActivity != "com.example.app.MainActivity" {
+		t.Fatalf("Base = %+v", b.Base)
+	}
+
+	tests := []struct {
+		device DeviceConfig
+		want   []string
+	}{
+		{
+			DeviceConfig{ABIs: []string{"arm64-v8a", "armeabi-v7a"}, Density: 420, Locales: []string{"fr-FR"}},
+			[]string{"base", "camera", "camera.config.arm64_v8a", "config.arm64_v8a", "config.etc2", "config.fr", "config.xxhdpi"},
+		},
+		{
+			// 32-bit ARM, a density between hdpi and xxhdpi, no
+			// matching language
+			DeviceConfig{ABIs: []string{"armeabi-v7a", "armeabi"}, Density: 300, Locales: []string{"de-DE"}},
+			[]string{"base", "camera", "camera.config.armeabi_v7a", "config.armeabi_v7a", "config.etc2", "config.hdpi"},
+		},
+	}
+	for _, tt := range tests {
+		selected, err := b.Select(tt.device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range selected {
+			names = append(names, s.Name())
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("Select(%+v) = %q, want %q", tt.device, names, tt.want)
+		}
+	}
+
+	// camera has no x86_64 split
+	if _, err := b.Select(DeviceConfig{ABIs: []string{"x86_64"}}); err == nil {
+		t.Error("Select accepted a device without a camera split for its ABI")
+	}
+
+	tmp := b.tmp
+	b.Close()
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("Close left %s behind", tmp)
+	}
+}
@@ -0,0 +1,163 @@
+// Package apk reads APK files: the binary XML of AndroidManifest.xml,
+// the resource table in resources.arsc, and the details gadb needs to
+// install and launch an app
+package apk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Chunk types of the binary resource formats (ResourceTypes.h)
+const (
+	chunkStringPool   = 0x0001
+	chunkTable        = 0x0002
+	chunkXML          = 0x0003
+	chunkXMLStartNS   = 0x0100
+	chunkXMLEndNS     = 0x0101
+	chunkXMLStart     = 0x0102
+	chunkXMLEnd       = 0x0103
+	chunkXMLCDATA     = 0x0104
+	chunkXMLResMap    = 0x0180
+	chunkTablePackage = 0x0200
+	chunkTableType    = 0x0201
+	chunkTableSpec    = 0x0202
+)
+
+// noIndex marks an absent string reference
+const noIndex = 0xffffffff
+
+// chunk is a chunk header and the bytes it spans
+type chunk struct {
+	typ        uint16
+	headerSize int
+	data       []byte // the whole chunk, header included
+}
+
+// readChunk reads the chunk at the start of b
+func readChunk(b []byte) (chunk, error) {
+	if len(b) < 8 {
+		return chunk{}, fmt.Errorf("truncated chunk header")
+	}
+	c := chunk{
+		typ:        binary.LittleEndian.Uint16(b),
+		headerSize: int(binary.LittleEndian.Uint16(b[2:])),
+	}
+	size := int(binary.LittleEndian.Uint32(b[4:]))
+	if c.headerSize < 8 || size < c.headerSize || size > len(b) {
+		return chunk{}, fmt.Errorf("bad chunk 0x%04x: header %d, size %d of %d bytes", c.typ, c.headerSize, size, len(b))
+	}
+	c.data = b[:size]
+	return c, nil
+}
+
+// chunks splits b into consecutive chunks
+func chunks(b []byte) ([]chunk, error) {
+	var list []chunk
+	for len(b) > 0 {
+		c, err := readChunk(b)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, c)
+		b = b[len(c.data):]
+	}
+	return list, nil
+}
+
+// u16 and u32 read little endian values, returning 0 past the end so
+// truncated input degrades instead of panicking
+func u16(b []byte, off int) uint16 {
+	if off < 0 || off+2 > len(b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b[off:])
+}
+
+func u32(b []byte, off int) uint32 {
+	if off < 0 || off+4 > len(b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b[off:])
+}
+
+// stringPool is a decoded string pool chunk
+type stringPool []string
+
+// parseStringPool decodes a string pool chunk in UTF-8 or UTF-16
+func parseStringPool(c chunk) (stringPool, error) {
+	b := c.data
+	count := int(u32(b, 8))
+	flags := u32(b, 16)
+	stringsStart := int(u32(b, 20))
+	utf8 := flags&(1<<8) != 0
+	if count < 0 || c.headerSize+4*count > len(b) {
+		return nil, fmt.Errorf("bad string pool: %d strings", count)
+	}
+
+	pool := make(stringPool, count)
+	for i := range pool {
+		off := stringsStart + int(u32(b, c.headerSize+4*i))
+		if off >= len(b) {
+			return nil, fmt.Errorf("string %d out of range", i)
+		}
+		if utf8 {
+			// UTF-16 length, then UTF-8 length, each 1 or 2 bytes
+			_, n := poolLen8(b, off)
+			off += n
+			length, n := poolLen8(b, off)
+			off += n
+			if off+length > len(b) {
+				return nil, fmt.Errorf("string %d out of range", i)
+			}
+			pool[i] = string(b[off : off+length])
+		} else {
+			length, n := poolLen16(b, off)
+			off += n
+			if off+2*length > len(b) {
+				return nil, fmt.Errorf("string %d out of range", i)
+			}
+			units := make([]uint16, length)
+			for j := range units {
+				units[j] = u16(b, off+2*j)
+			}
+			pool[i] = string(utf16.Decode(units))
+		}
+	}
+	return pool, nil
+}
+
+// poolLen8 reads a UTF-8 pool length: one byte, or two when the high
+// bit is set
+func poolLen8(b []byte, off int) (int, int) {
+	if off >= len(b) {
+		return 0, 1
+	}
+	l := int(b[off])
+	if l&0x80 == 0 {
+		return l, 1
+	}
+	if off+1 >= len(b) {
+		return 0, 2
+	}
+	return (l&0x7f)<<8 | int(b[off+1]), 2
+}
+
+// poolLen16 reads a UTF-16 pool length: one unit, or two when the
+// high bit is set; the second result is the bytes read
+func poolLen16(b []byte, off int) (int, int) {
+	l := int(u16(b, off))
+	if l&0x8000 == 0 {
+		return l, 2
+	}
+	return (l&0x7fff)<<16 | int(u16(b, off+2)), 4
+}
+
+// get returns string i, or "" for noIndex or out of range references
+func (p stringPool) get(i uint32) string {
+	if i == noIndex || int(i) >= len(p) {
+		return ""
+	}
+	return p[i]
+}
@@ -0,0 +1,256 @@
+package gadb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppInfo describes an installed package, from "dumpsys package packages"
+type AppInfo struct {
+	Package     string `json:"package"`
+	VersionName string `json:"versionName"`
+	VersionCode int64  `json:"versionCode"`
+	MinSdk      int    `json:"minSdk,omitempty"`
+	TargetSdk   int    `json:"targetSdk"`
+	// Installed and Updated are device local times, "2024-01-15 10:00:00"
+	Installed string `json:"firstInstallTime"`
+	Updated   string `json:"lastUpdateTime"`
+	Installer string `json:"installer,omitempty"`
+	// Path is the package's code path: its APK, or the directory
+	// holding base.apk and any splits
+	Path   string `json:"path"`
+	System bool   `json:"system"`
+}
+
+var (
+	// "  Package [com.example.app] (a1b2c3):"
+	dumpsysPackageRe = regexp.MustCompile(`^  Package \[([^\]]+)\]`)
+	// "versionCode=42 minSdk=24 targetSdk=34" and other key=value runs
+	dumpsysFieldRe = regexp.MustCompile(`(\w+)=(\S*)`)
+	// "User 0: ceDataInode=... installed=true hidden=false ..."
+	dumpsysUserRe = regexp.MustCompile(`^\s+User \d+:.*\binstalled=(true|false)`)
+)
+
+// parseDumpsysPackages reads the Packages section of "dumpsys package
+// packages" output
+// Packages not installed for any user (system apps removed with
+// "pm uninstall --user") are left out, as pm list packages does
+func parseDumpsysPackages(out string) []*AppInfo {
+	var apps []*AppInfo
+	var cur *AppInfo
+	inPackages := false
+	installed := false
+	hasUsers := false
+	finish := func() {
+		if cur != nil && (installed || !hasUsers) {
+			apps = append(apps, cur)
+		}
+		cur = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line != "" && line[0] != ' ' {
+			// A new top-level section; hidden system packages repeat
+			// entries that are already listed
+			finish()
+			inPackages = line == "Packages:"
+			continue
+		}
+		if !inPackages {
+			continue
+		}
+		if m := dumpsysPackageRe.FindStringSubmatch(line); m != nil {
+			finish()
+			cur = &AppInfo{Package: m[1]}
+			installed, hasUsers = false, false
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := dumpsysUserRe.FindStringSubmatch(line); m != nil {
+			hasUsers = true
+			installed = installed || m[1] == "true"
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "flags=[") || strings.HasPrefix(trimmed, "pkgFlags=["):
+			cur.System = cur.System || strings.Contains(trimmed, " SYSTEM ")
+		case strings.HasPrefix(trimmed, "firstInstallTime="):
+			cur.Installed = strings.TrimPrefix(trimmed, "firstInstallTime=")
+		case strings.HasPrefix(trimmed, "lastUpdateTime="):
+			cur.Updated = strings.TrimPrefix(trimmed, "lastUpdateTime=")
+		case strings.HasPrefix(trimmed, "versionName="):
+			cur.VersionName = strings.TrimPrefix(trimmed, "versionName=")
+		default:
+			for _, m := range dumpsysFieldRe.FindAllStringSubmatch(trimmed, -1) {
+				switch m[1] {
+				case "versionCode":
+					cur.VersionCode, _ = strconv.ParseInt(m[2], 10, 64)
+				case "minSdk":
+					cur.MinSdk, _ = strconv.Atoi(m[2])
+				case "targetSdk":
+					cur.TargetSdk, _ = strconv.Atoi(m[2])
+				case "codePath":
+					cur.Path = m[2]
+				case "installerPackageName":
+					if m[2] != "null" {
+						cur.Installer = m[2]
+					}
+				}
+			}
+		}
+	}
+	finish()
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Package < apps[j].Package })
+	return apps
+}
+
+// loadApps returns the installed packages on a device, cached for
+// componentCacheTTL; completion reads the package names from here too
+func loadApps(serial string) ([]*AppInfo, error) {
+	componentCache.Lock()
+	cached, ok := componentCache.apps[serial]
+	componentCache.Unlock()
+	if ok && time.Since(cached.fetched) < componentCacheTTL {
+		return cached.apps, nil
+	}
+
+	apps, err := fetchApps(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	componentCache.Lock()
+	componentCache.apps[serial] = cachedApps{apps: apps, fetched: time.Now()}
+	componentCache.Unlock()
+	return apps, nil
+}
+
+// fetchApps reads the installed packages of a device from dumpsys
+func fetchApps(serial string) ([]*AppInfo, error) {
+	cmd := exec.Command("adb", "-s", serial, "shell", "dumpsys", "package", "packages")
+	setupCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packages: %w", err)
+	}
+	return parseDumpsysPackages(string(out)), nil
+}
+
+// appSortKeys order the apps listing; times sort newest first
+var appSortKeys = map[string]func(a, b *AppInfo) bool{
+	"name":      func(a, b *AppInfo) bool { return a.Package < b.Package },
+	"version":   func(a, b *AppInfo) bool { return a.VersionCode > b.VersionCode },
+	"target":    func(a, b *AppInfo) bool { return a.TargetSdk > b.TargetSdk },
+	"installed": func(a, b *AppInfo) bool { return a.Installed > b.Installed },
+	"updated":   func(a, b *AppInfo) bool { return a.Updated > b.Updated },
+	"installer": func(a, b *AppInfo) bool { return a.Installer < b.Installer },
+}
+
+// appsUsage is shown for malformed apps commands
+const appsUsage = "usage: apps [-a] [--sort name|version|target|installed|updated|installer] [--installer <pkg>] [--json] [filter]"
+
+// runAppsCommand handles "apps": list third-party packages (all with
+// -a) with their version and install details
+func runAppsCommand(serial string, args []string, out io.Writer) error {
+	all, asJSON := false, false
+	sortKey, installer, filter := "name", "", ""
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-a" || a == "--all":
+			all = true
+		case a == "--json":
+			asJSON = true
+		case (a == "--sort" || a == "--installer") && i+1 < len(args):
+			if a == "--sort" {
+				sortKey = args[i+1]
+			} else {
+				installer = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(a, "-") || filter != "":
+			return fmt.Errorf(appsUsage)
+		default:
+			filter = a
+		}
+	}
+	less, ok := appSortKeys[sortKey]
+	if !ok {
+		return fmt.Errorf(appsUsage)
+	}
+
+	apps, err := loadApps(serial)
+	if err != nil {
+		return err
+	}
+	var shown []*AppInfo
+	for _, app := range apps {
+		if app.System && !all {
+			continue
+		}
+		if installer != "" && app.Installer != installer {
+			continue
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(app.Package), strings.ToLower(filter)) {
+			continue
+		}
+		shown = append(shown, app)
+	}
+	sort.SliceStable(shown, func(i, j int) bool { return less(shown[i], shown[j]) })
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if shown == nil {
+			shown = []*AppInfo{}
+		}
+		return enc.Encode(shown)
+	}
+	printApps(out, shown)
+	return nil
+}
+
+// printApps writes the apps as an aligned table
+func printApps(out io.Writer, apps []*AppInfo) {
+	if len(apps) == 0 {
+		fmt.Fprintln(out, "No packages found")
+		return
+	}
+	nameWidth, versionWidth := len("PACKAGE"), len("VERSION")
+	for _, app := range apps {
+		if len(app.Package) > nameWidth {
+			nameWidth = len(app.Package)
+		}
+		if len(app.VersionName) > versionWidth {
+			versionWidth = len(app.VersionName)
+		}
+	}
+	row := func(cols ...string) {
+		fmt.Fprintf(out, "%-*s  %-*s  %10s  %6s  %-19s  %-19s  %-22s  %s\n",
+			nameWidth, cols[0], versionWidth, cols[1], cols[2], cols[3], cols[4], cols[5], cols[6], cols[7])
+	}
+	row("PACKAGE", "VERSION", "CODE", "TARGET", "INSTALLED", "UPDATED", "INSTALLER", "PATH")
+	for _, app := range apps {
+		installer := app.Installer
+		if installer == "" {
+			installer = "-"
+		}
+		row(app.Package, app.VersionName, strconv.FormatInt(app.VersionCode, 10), strconv.Itoa(app.TargetSdk),
+			app.Installed, app.Updated, installer, app.Path)
+	}
+	fmt.Fprintf(out, "%d package(s)\n", len(apps))
+}
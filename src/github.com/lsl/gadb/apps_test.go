@@ -0,0 +1,99 @@
+package gadb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const dumpsysPackagesSample = `Database versions:
+  Internal:
+    sdkVersion=34 databaseVersion=3
+
+Packages:
+  Package [com.example.app] (1a2b3c):
+    userId=10123
+    pkg=Package{4d5e6f com.example.app}
+    codePath=/data/app/~~AbC==/com.example.app-XyZ==
+    resourcePath=/data/app/~~AbC==/com.example.app-XyZ==
+    primaryCpuAbi=arm64-v8a
+    versionCode=42 minSdk=24 targetSdk=34
+    minExtensionVersions=[]
+    versionName=1.2.3
+    flags=[ HAS_CODE ALLOW_CLEAR_USER_DATA ALLOW_BACKUP ]
+    timeStamp=2024-01-15 10:00:00
+    firstInstallTime=2024-01-10 09:00:00
+    lastUpdateTime=2024-01-15 10:00:01
+    installerPackageName=com.android.vending
+    User 0: ceDataInode=1234 installed=true hidden=false suspended=false
+  Package [com.android.settings] (7a8b9c):
+    userId=1000
+    codePath=/system_ext/priv-app/Settings
+    versionCode=34 minSdk=34 targetSdk=34
+    versionName=14
+    flags=[ SYSTEM HAS_CODE PERSISTENT ]
+    firstInstallTime=2009-01-01 08:00:00
+    lastUpdateTime=2009-01-01 08:00:00
+    installerPackageName=null
+    User 0: ceDataInode=0 installed=true hidden=false
+  Package [com.android.removed] (0d0e0f):
+    codePath=/product/app/Removed
+    versionCode=1 targetSdk=30
+    flags=[ SYSTEM ]
+    User 0: ceDataInode=0 installed=false hidden=false
+
+Hidden system packages:
+  Package [com.android.settings] (1f2e3d):
+    codePath=/system/priv-app/Settings
+    versionCode=33 targetSdk=33
+`
+
+func TestParseDumpsysPackages(t *testing.T) {
+	apps := parseDumpsysPackages(dumpsysPackagesSample)
+	if len(apps) != 2 {
+		t.Fatalf("got %d apps, want 2", len(apps))
+	}
+	want := AppInfo{
+		Package: "com.android.settings", VersionName: "14", VersionCode: 34, MinSdk: 34, TargetSdk: 34,
+		Installed: "2009-01-01 08:00:00", Updated: "2009-01-01 08:00:00",
+		Path: "/system_ext/priv-app/Settings", System: true,
+	}
+	if *apps[0] != want {
+		t.Errorf("apps[0] = %+v, want %+v", *apps[0], want)
+	}
+	want = AppInfo{
+		Package: "com.example.app", VersionName: "1.2.3", VersionCode: 42, MinSdk: 24, TargetSdk: 34,
+		Installed: "2024-01-10 09:00:00", Updated: "2024-01-15 10:00:01", Installer: "com.android.vending",
+		Path: "/data/app/~~AbC==/com.example.app-XyZ==",
+	}
+	if *apps[1] != want {
+		t.Errorf("apps[1] = %+v, want %+v", *apps[1], want)
+	}
+}
+
+func TestAppsCommandJSON(t *testing.T) {
+	componentCache.Lock()
+	componentCache.apps["fake-apps"] = cachedApps{apps: parseDumpsysPackages(dumpsysPackagesSample), fetched: time.Now()}
+	componentCache.Unlock()
+
+	var buf bytes.Buffer
+	if err := runAppsCommand("fake-apps", []string{"-a", "--sort", "installed", "--json"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var apps []AppInfo
+	if err := json.Unmarshal(buf.Bytes(), &apps); err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 2 || apps[0].Package != "com.example.app" {
+		t.Errorf("apps sorted by install time = %+v", apps)
+	}
+
+	buf.Reset()
+	if err := runAppsCommand("fake-apps", []string{"--json", "settings"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := bytes.TrimSpace(buf.Bytes()); string(got) != "[]" {
+		t.Errorf("third-party filter matched a system app: %s", got)
+	}
+}
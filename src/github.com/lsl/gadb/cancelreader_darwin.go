@@ -0,0 +1,36 @@
+//go:build darwin
+
+package gadb
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// wait blocks until f is readable or the reader is canceled; macOS
+// poll(2) reports POLLNVAL for terminals, so this uses select(2)
+func (r *cancelReader) wait() error {
+	fd, cancelFd := int(r.f.Fd()), int(r.pr.Fd())
+	if fd >= unix.FD_SETSIZE || cancelFd >= unix.FD_SETSIZE {
+		return fmt.Errorf("select %s: descriptor out of range", r.f.Name())
+	}
+	for {
+		var set unix.FdSet
+		set.Set(fd)
+		set.Set(cancelFd)
+		_, err := unix.Select(max(fd, cancelFd)+1, &set, nil, nil, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if set.IsSet(cancelFd) {
+			return errReadCanceled
+		}
+		if set.IsSet(fd) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package gadb
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// wait blocks until f is readable or the reader is canceled, polling
+// both descriptors
+func (r *cancelReader) wait() error {
+	fds := []unix.PollFd{
+		{Fd: int32(r.f.Fd()), Events: unix.POLLIN},
+		{Fd: int32(r.pr.Fd()), Events: unix.POLLIN},
+	}
+	for {
+		fds[0].Revents, fds[1].Revents = 0, 0
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fds[1].Revents != 0 {
+			return errReadCanceled
+		}
+		if fds[0].Revents&unix.POLLNVAL != 0 {
+			return fmt.Errorf("poll %s: %w", r.f.Name(), unix.EBADF)
+		}
+		if fds[0].Revents&(unix.POLLIN|unix.POLLHUP|unix.POLLERR) != 0 {
+			return nil
+		}
+	}
+}
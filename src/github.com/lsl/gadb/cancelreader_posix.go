@@ -0,0 +1,71 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// errReadCanceled is returned by a cancelReader after Cancel
+var errReadCanceled = errors.New("read canceled")
+
+// cancelReader reads from a file and can be interrupted while blocked,
+// so a goroutine forwarding stdin can be stopped without waiting for
+// (and swallowing) the next keystroke
+// It waits on the file together with a self-pipe that Cancel writes to
+type cancelReader struct {
+	f        *os.File
+	pr, pw   *os.File
+	mu       sync.Mutex
+	canceled bool
+}
+
+// newCancelReader wraps f in a cancelable reader
+func newCancelReader(f *os.File) (*cancelReader, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	return &cancelReader{f: f, pr: pr, pw: pw}, nil
+}
+
+// Read waits until f is readable or the reader is canceled
+func (r *cancelReader) Read(p []byte) (int, error) {
+	for {
+		if err := r.wait(); err != nil {
+			return 0, err
+		}
+		n, err := unix.Read(int(r.f.Fd()), p)
+		if err == unix.EINTR || err == unix.EAGAIN {
+			continue
+		}
+		if n < 0 {
+			n = 0
+		}
+		if n == 0 && err == nil {
+			return 0, io.EOF
+		}
+		return n, err
+	}
+}
+
+// Cancel wakes up a blocked Read and makes further reads fail
+func (r *cancelReader) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.canceled {
+		r.canceled = true
+		_, _ = r.pw.Write([]byte{0})
+	}
+}
+
+// Close releases the self-pipe; call it after the reader is no longer used
+func (r *cancelReader) Close() {
+	_ = r.pr.Close()
+	_ = r.pw.Close()
+}
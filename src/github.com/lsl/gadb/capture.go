@@ -0,0 +1,546 @@
+package gadb
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+)
+
+const (
+	// defaultCaptureFileSize is the size at which a capture file rotates
+	defaultCaptureFileSize = 10 << 20
+	// defaultCaptureFiles is how many files are kept per device
+	defaultCaptureFiles = 10
+	// captureRecheck is how often capture looks for devices to attach
+	// to when the tracker reports nothing new
+	captureRecheck = 5 * time.Second
+)
+
+// rotatingFile writes numbered files in a directory, starting a new
+// file when the current one reaches maxSize and deleting the oldest
+// once there are more than maxFiles
+// Each Write goes whole into one file, so lines are never split
+type rotatingFile struct {
+	dir      string
+	base     string
+	maxSize  int64
+	maxFiles int
+
+	seq   int
+	f     *os.File
+	size  int64
+	total int64
+}
+
+// newRotatingFile returns a writer for dir/base.001.txt, base.002.txt, ...
+// No file is created before the first Write
+func newRotatingFile(dir, base string, maxSize int64, maxFiles int) *rotatingFile {
+	return &rotatingFile{dir: dir, base: base, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// name returns the path of the file with the given sequence number
+func (r *rotatingFile) name(seq int) string {
+	return filepath.Join(r.dir, fmt.Sprintf("%s.%03d.txt", r.base, seq))
+}
+
+// Write appends p to the current file, rotating first if it would
+// grow past the size limit
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.f != nil && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.f.Close(); err != nil {
+			return 0, err
+		}
+		r.f = nil
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	r.total += int64(n)
+	return n, err
+}
+
+// open starts the next file and removes the one that fell out of the limit
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	r.seq++
+	f, err := os.OpenFile(r.name(r.seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	if old := r.seq - r.maxFiles; old > 0 {
+		_ = os.Remove(r.name(old))
+	}
+	return nil
+}
+
+// Files returns the number of files currently kept
+func (r *rotatingFile) Files() int {
+	if r.seq < r.maxFiles {
+		return r.seq
+	}
+	return r.maxFiles
+}
+
+// Close closes the current file
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// captureDevice is the capture state of one device, kept across
+// disconnects so a reconnected device continues its files
+type captureDevice struct {
+	serial string
+	out    *rotatingFile
+	cmd    *exec.Cmd
+	// running is true while a logcat process is attached
+	running bool
+	// attached counts logcat processes started, reconnects included
+	attached int
+	lines    int64
+	// crashes counts the crash reports found in the captured lines
+	crashes int
+	// last is the newest timestamp written; on reconnect logcat is
+	// asked for lines from then on
+	last time.Time
+	// atLast holds the lines written at last, which logcat repeats
+	// when resuming from that time
+	atLast map[string]bool
+}
+
+// logcatCapture records logcat for every connected device into a
+// session directory until stopped
+type logcatCapture struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	tracker  *DeviceTracker
+	// unwatch removes the tracker callback registered at start
+	unwatch func()
+
+	mu      sync.Mutex
+	devices map[string]*captureDevice
+	stopped bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startCapture begins capturing into dir
+// Devices are attached as the tracker reports them online; without a
+// tracker the device list is polled
+func startCapture(dir string, maxSize int64, maxFiles int, tracker *DeviceTracker) (*logcatCapture, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	c := &logcatCapture{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		tracker:  tracker,
+		devices:  make(map[string]*captureDevice),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if tracker != nil {
+		c.unwatch = tracker.OnChange(c.poke)
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return c, nil
+}
+
+// poke asks the capture loop to look for new devices without blocking
+func (c *logcatCapture) poke() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop attaches to online devices until the capture is stopped
+func (c *logcatCapture) loop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(captureRecheck)
+	defer ticker.Stop()
+	for {
+		c.attach()
+		select {
+		case <-c.done:
+			return
+		case <-c.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// online returns the serials of the devices that can be captured
+func (c *logcatCapture) online() []string {
+	if c.tracker != nil {
+		if serials, known := c.tracker.Online(); known {
+			return serials
+		}
+	}
+	var serials []string
+	for _, d := range readDevices() {
+		serials = append(serials, d.Serial)
+	}
+	return serials
+}
+
+// attach starts logcat for each online device that has none running
+func (c *logcatCapture) attach() {
+	for _, serial := range c.online() {
+		c.mu.Lock()
+		if c.stopped {
+			c.mu.Unlock()
+			return
+		}
+		d := c.devices[serial]
+		if d == nil {
+			dir := filepath.Join(c.dir, unsafeFileChars.ReplaceAllString(serial, "_"))
+			d = &captureDevice{serial: serial, out: newRotatingFile(dir, "logcat", c.maxSize, c.maxFiles)}
+			c.devices[serial] = d
+		}
+		if d.running {
+			c.mu.Unlock()
+			continue
+		}
+		stdout, err := c.startLogcat(d)
+		c.mu.Unlock()
+		if err != nil {
+			continue
+		}
+		c.wg.Add(1)
+		go c.read(d, stdout)
+	}
+}
+
+// startLogcat starts a logcat process for a device, resuming after
+// the last line captured; c.mu must be held
+func (c *logcatCapture) startLogcat(d *captureDevice) (io.Reader, error) {
+	args := []string{"-s", d.serial, "logcat", "-v", "threadtime"}
+	if !d.last.IsZero() {
+		args = append(args, "-T", d.last.Format("01-02 15:04:05.000"))
+	}
+	cmd := exec.Command("adb", args...)
+	setupCommand(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	d.cmd = cmd
+	d.running = true
+	d.attached++
+	return stdout, nil
+}
+
+// read copies a device's logcat lines into its files until the
+// process exits, as when the device disconnects or capture stops
+// Crashes in the lines are saved and listed by "crashes" without an
+// alert, which would interrupt the prompt; a report completes when
+// the log moves on or the process exits
+func (c *logcatCapture) read(d *captureDevice, stdout io.Reader) {
+	defer c.wg.Done()
+	c.mu.Lock()
+	resumeAfter := d.last
+	c.mu.Unlock()
+
+	parser := logcat.NewParser()
+	detector := logcat.NewCrashDetector()
+	saveCrashes := func(crashes []*logcat.Crash) {
+		for _, cr := range crashes {
+			_, _ = captureCrash(d.serial, cr)
+			c.mu.Lock()
+			d.crashes++
+			c.mu.Unlock()
+		}
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		entries := parser.Feed(line)
+		var at time.Time
+		for _, e := range entries {
+			at = e.Time
+		}
+
+		c.mu.Lock()
+		// Resuming with -T repeats lines at the resume time
+		if !resumeAfter.IsZero() && !at.IsZero() {
+			if at.Before(resumeAfter) || at.Equal(resumeAfter) && d.atLast[line] {
+				c.mu.Unlock()
+				continue
+			}
+			resumeAfter = time.Time{}
+		}
+		_, err := d.out.Write([]byte(line + "\n"))
+		d.lines++
+		if !at.IsZero() {
+			if !at.Equal(d.last) {
+				d.last = at
+				d.atLast = make(map[string]bool)
+			}
+			d.atLast[line] = true
+		}
+		c.mu.Unlock()
+		for _, e := range entries {
+			saveCrashes(detector.Feed(e))
+		}
+		if err != nil {
+			break
+		}
+	}
+	saveCrashes(detector.Flush())
+
+	c.mu.Lock()
+	cmd := d.cmd
+	c.mu.Unlock()
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+	_ = cmd.Wait()
+	c.mu.Lock()
+	d.running = false
+	c.mu.Unlock()
+}
+
+// Status summarizes the capture for the "jobs" command
+func (c *logcatCapture) Status() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var bytes int64
+	running := 0
+	for _, d := range c.devices {
+		bytes += d.out.total
+		if d.running {
+			running++
+		}
+	}
+	return fmt.Sprintf("%d/%d devices, %s in %s", running, len(c.devices), formatBytes(bytes), c.dir)
+}
+
+// printStatus lists each device's capture state
+func (c *logcatCapture) printStatus() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(commandStdout(), "Capturing logcat to %s\n", c.dir)
+	if len(c.devices) == 0 {
+		fmt.Fprintln(commandStdout(), "  waiting for devices")
+		return
+	}
+	serials := make([]string, 0, len(c.devices))
+	for serial := range c.devices {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	for _, serial := range serials {
+		d := c.devices[serial]
+		state := "capturing"
+		if !d.running {
+			state = "waiting for reconnect"
+		}
+		fmt.Fprintf(commandStdout(), "  %-24s %-22s %8d lines  %9s  %d file(s)  %d crash(es)\n",
+			serial, state, d.lines, formatBytes(d.out.total), d.out.Files(), d.crashes)
+	}
+}
+
+// Stop ends every logcat process, closes the files and zips the
+// session directory next to it
+func (c *logcatCapture) Stop() error {
+	if c.unwatch != nil {
+		c.unwatch()
+	}
+	c.mu.Lock()
+	c.stopped = true
+	for _, d := range c.devices {
+		if d.running && d.cmd.Process != nil {
+			_ = d.cmd.Process.Kill()
+		}
+	}
+	c.mu.Unlock()
+	close(c.done)
+	c.wg.Wait()
+
+	for _, d := range c.devices {
+		_ = d.out.Close()
+	}
+	archive := filepath.Clean(c.dir) + ".zip"
+	if err := zipDir(c.dir, archive); err != nil {
+		return fmt.Errorf("failed to zip capture: %w", err)
+	}
+	fmt.Fprintf(commandStdout(), "Capture saved to %s\n", archive)
+	return nil
+}
+
+// zipDir writes the files under dir to a zip archive rooted at the
+// directory's name
+func zipDir(dir, archive string) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	root := filepath.Dir(filepath.Clean(dir))
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	})
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// parseByteSize parses sizes such as "512K", "10M" or "1G"; a plain
+// number is bytes
+func parseByteSize(s string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+	upper := strings.TrimSuffix(strings.ToUpper(s), "B")
+	mult := int64(1)
+	if len(upper) > 0 {
+		if m, ok := units[upper[len(upper)-1:]]; ok {
+			mult = m
+			upper = upper[:len(upper)-1]
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * mult, nil
+}
+
+// formatBytes renders a byte count for status output
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// captureUsage is shown for malformed capture commands
+const captureUsage = "usage: capture start [--dir <dir>] [--size <bytes|K|M|G>] [--count <files>] | capture stop | capture"
+
+// runCaptureCommand handles the REPL "capture" command: start or stop
+// background logcat capture of every device, or show its state
+func runCaptureCommand(ctx *Context, args []string) error {
+	if len(args) == 0 {
+		j := ctx.findJob("capture")
+		if j == nil {
+			fmt.Fprintln(commandStdout(), "Capture is off")
+			return nil
+		}
+		j.task.(*logcatCapture).printStatus()
+		return nil
+	}
+
+	switch args[0] {
+	case "start":
+		dir := filepath.Join(configDir(), "captures", time.Now().Format("20060102-150405"))
+		size := int64(defaultCaptureFileSize)
+		count := defaultCaptureFiles
+		for i := 1; i < len(args); i++ {
+			if i+1 >= len(args) {
+				return fmt.Errorf(captureUsage)
+			}
+			value := args[i+1]
+			switch args[i] {
+			case "--dir":
+				dir = expandHome(value)
+			case "--size":
+				n, err := parseByteSize(value)
+				if err != nil {
+					return err
+				}
+				size = n
+			case "--count":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid file count: %s", value)
+				}
+				count = n
+			default:
+				return fmt.Errorf(captureUsage)
+			}
+			i++
+		}
+		if ctx.findJob("capture") != nil {
+			return fmt.Errorf("capture is already running; use 'capture stop' first")
+		}
+		c, err := startCapture(dir, size, count, ctx.Tracker)
+		if err != nil {
+			return err
+		}
+		if _, err := ctx.startJob("capture", c); err != nil {
+			_ = c.Stop()
+			return err
+		}
+		fmt.Fprintf(commandStdout(), "Capturing logcat of all devices to %s (%s x %d files per device)\n", dir, formatBytes(size), count)
+		return nil
+	case "stop":
+		if len(args) != 1 {
+			return fmt.Errorf(captureUsage)
+		}
+		return ctx.stopJob("capture")
+	}
+	return fmt.Errorf(captureUsage)
+}
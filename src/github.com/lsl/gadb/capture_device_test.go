@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureResumesAfterLastLine(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fixture, err := filepath.Abs(crashLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_LOGCAT", fixture)
+	argsFile := filepath.Join(t.TempDir(), "args")
+	t.Setenv("FAKE_ADB_ARGS", argsFile)
+
+	// The tracker is never started, so capture lists devices with adb
+	tracker := NewDeviceTracker()
+	c, err := startCapture(filepath.Join(t.TempDir(), "capture"), defaultCaptureFileSize, defaultCaptureFiles, tracker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each fake logcat exits after the sample, as when a device
+	// disconnects; poke attaches again
+	want := "[logcat][-v][threadtime][-T][01-15 10:00:09.000]"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(argsFile)
+		if strings.Contains(string(data), want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no reconnect with %s in:\n%s", want, data)
+		}
+		c.poke()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The repeated lines at the resume time are not written again
+	c.mu.Lock()
+	lines := c.devices["fake-1"].lines
+	c.mu.Unlock()
+	if sample, _ := os.ReadFile(fixture); lines != int64(strings.Count(string(sample), "\n")) {
+		t.Errorf("captured %d lines, want the sample once", lines)
+	}
+	tracker.mu.Lock()
+	callbacks := len(tracker.onChange)
+	tracker.mu.Unlock()
+	if callbacks != 0 {
+		t.Errorf("%d tracker callbacks left after Stop", callbacks)
+	}
+}
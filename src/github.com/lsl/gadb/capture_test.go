@@ -0,0 +1,60 @@
+package gadb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileKeepsNewestFiles(t *testing.T) {
+	dir := t.TempDir()
+	r := newRotatingFile(dir, "logcat", 20, 3)
+	for i := 0; i < 10; i++ {
+		if _, err := r.Write([]byte("0123456789\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// 11-byte lines, one per 20-byte file
+	want := []string{"logcat.008.txt", "logcat.009.txt", "logcat.010.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "logcat.010.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "\n") != 1 {
+		t.Errorf("last file = %q, want one whole line", data)
+	}
+	if r.total != 110 || r.Files() != 3 {
+		t.Errorf("total = %d, files = %d", r.total, r.Files())
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "4K": 4096, "10M": 10 << 20, "1gb": 1 << 30}
+	for in, want := range tests {
+		if got, err := parseByteSize(in); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "ten"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("parseByteSize(%q) succeeded", in)
+		}
+	}
+}
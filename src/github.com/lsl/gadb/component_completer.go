@@ -0,0 +1,351 @@
+package gadb
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/apk"
+)
+
+// componentCacheTTL is how long package and component lists are reused
+// for completion before they are fetched again
+const componentCacheTTL = 30 * time.Second
+
+// componentKind identifies a type of manifest component
+type componentKind int
+
+const (
+	componentActivity componentKind = iota
+	componentService
+	componentReceiver
+)
+
+// am subcommands whose -n argument names a component of the given kind
+var amComponentKinds = map[string]componentKind{
+	"start":                    componentActivity,
+	"start-activity":           componentActivity,
+	"start-activity-as-user":   componentActivity,
+	"startservice":             componentService,
+	"start-service":            componentService,
+	"startserviceasuser":       componentService,
+	"start-foreground-service": componentService,
+	"stopservice":              componentService,
+	"stop-service":             componentService,
+	"broadcast":                componentReceiver,
+	"broadcast-as-user":        componentReceiver,
+}
+
+// Section headers in "dumpsys package" output that list components
+// reachable through intent filters
+var resolverTableKinds = map[string]componentKind{
+	"Activity Resolver Table:": componentActivity,
+	"Service Resolver Table:":  componentService,
+	"Receiver Resolver Table:": componentReceiver,
+}
+
+// resolverEntryRe matches a component line in a resolver table,
+// e.g. "        5c0a0f1 com.example/.MainActivity filter 2a3b4c"
+var resolverEntryRe = regexp.MustCompile(`^\s+[0-9a-f]+\s+(\S+/\S+)`)
+
+// PackageComponents holds the components a package exposes
+type PackageComponents struct {
+	Activities []string
+	Services   []string
+	Receivers  []string
+}
+
+// byKind returns the component list for kind
+func (pc *PackageComponents) byKind(kind componentKind) []string {
+	switch kind {
+	case componentService:
+		return pc.Services
+	case componentReceiver:
+		return pc.Receivers
+	default:
+		return pc.Activities
+	}
+}
+
+// componentCache caches package lists and component lists per device
+var componentCache = struct {
+	sync.Mutex
+	apps       map[string]cachedApps
+	components map[string]cachedComponents
+	// refreshing marks devices whose apps list is being fetched in the
+	// background for completion
+	refreshing map[string]bool
+}{
+	apps:       make(map[string]cachedApps),
+	components: make(map[string]cachedComponents),
+	refreshing: make(map[string]bool),
+}
+
+type cachedApps struct {
+	apps    []*AppInfo
+	fetched time.Time
+}
+
+type cachedComponents struct {
+	components *PackageComponents
+	fetched    time.Time
+}
+
+// completeComponent completes the argument of "am <cmd> -n"
+// It returns ok=false when the line is not a component argument
+func (p *pathCompleter) completeComponent(fields []string, word string) ([][]rune, int, bool) {
+	if !p.shellMode {
+		if len(fields) == 0 || fields[0] != "shell" {
+			return nil, 0, false
+		}
+		fields = fields[1:]
+	}
+	if len(fields) < 3 || fields[0] != "am" || fields[len(fields)-1] != "-n" {
+		return nil, 0, false
+	}
+	kind, ok := amComponentKinds[fields[1]]
+	if !ok || p.ctx == nil || p.ctx.CurrentDevice == nil {
+		return nil, 0, false
+	}
+	serial := p.ctx.CurrentDevice.Serial
+
+	var names []string
+	if i := strings.Index(word, "/"); i >= 0 {
+		if pc := loadPackageComponents(serial, word[:i]); pc != nil {
+			for _, c := range pc.byKind(kind) {
+				names = append(names, c+" ")
+			}
+		}
+	} else {
+		for _, pkg := range loadPackages(serial) {
+			names = append(names, pkg+"/")
+		}
+	}
+
+	var candidates [][]rune
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, []rune(name[len(word):]))
+		}
+	}
+	return candidates, len([]rune(word)), true
+}
+
+// isPmPackageArg reports whether the next word is the package of a pm
+// subcommand, as in "shell pm clear <pkg>" or "pm clear <pkg>" in
+// shell mode
+func (p *pathCompleter) isPmPackageArg(fields []string) bool {
+	if !p.shellMode {
+		if len(fields) == 0 || fields[0] != "shell" {
+			return false
+		}
+		fields = fields[1:]
+	}
+	var args []string
+	for _, f := range fields {
+		if !strings.HasPrefix(f, "-") {
+			args = append(args, f)
+		}
+	}
+	if len(args) != 2 || args[0] != "pm" {
+		return false
+	}
+	for _, c := range pmCommands {
+		if c.name == args[1] {
+			return c.takesPackage
+		}
+	}
+	return false
+}
+
+// completePackageArg completes the package argument of the shell mode
+// "as" builtin, "logcat --pkg", "uninstall" and pm subcommands
+func (p *pathCompleter) completePackageArg(fields []string, word string) ([][]rune, int, bool) {
+	asBuiltin := p.shellMode && len(fields) == 1 && fields[0] == "as"
+	logcatPkg := !p.shellMode && len(fields) > 1 && fields[0] == "logcat" && fields[len(fields)-1] == "--pkg"
+	uninstall := !p.shellMode && len(fields) >= 1 && fields[0] == "uninstall" && !strings.HasPrefix(word, "-")
+	for _, f := range fields[min(len(fields), 1):] {
+		uninstall = uninstall && strings.HasPrefix(f, "-")
+	}
+	if !asBuiltin && !logcatPkg && !uninstall && !p.isPmPackageArg(fields) {
+		return nil, 0, false
+	}
+	if p.ctx == nil || p.ctx.CurrentDevice == nil {
+		return nil, 0, false
+	}
+	var candidates [][]rune
+	for _, pkg := range loadPackages(p.ctx.CurrentDevice.Serial) {
+		if strings.HasPrefix(pkg, word) {
+			candidates = append(candidates, []rune(pkg[len(word):]+" "))
+		}
+	}
+	return candidates, len([]rune(word)), true
+}
+
+// loadPackages returns the names of the installed packages on a
+// device from the apps list, so completion and "apps" agree
+// A stale list is returned as is and refreshed in the background, so
+// completion only waits on dumpsys when there is no list at all, as
+// after an install dropped it
+func loadPackages(serial string) []string {
+	componentCache.Lock()
+	cached, ok := componentCache.apps[serial]
+	if ok && time.Since(cached.fetched) >= componentCacheTTL && !componentCache.refreshing[serial] {
+		componentCache.refreshing[serial] = true
+		go refreshApps(serial, cached.fetched)
+	}
+	componentCache.Unlock()
+
+	apps := cached.apps
+	if !ok {
+		var err error
+		if apps, err = loadApps(serial); err != nil {
+			return nil
+		}
+	}
+	names := make([]string, len(apps))
+	for i, app := range apps {
+		names[i] = app.Package
+	}
+	return names
+}
+
+// refreshApps fetches the apps list of a device again; the result is
+// dropped when the list it replaces was forgotten or replaced meanwhile
+func refreshApps(serial string, fetched time.Time) {
+	apps, err := fetchApps(serial)
+
+	componentCache.Lock()
+	defer componentCache.Unlock()
+	delete(componentCache.refreshing, serial)
+	if cached, ok := componentCache.apps[serial]; err == nil && ok && cached.fetched.Equal(fetched) {
+		componentCache.apps[serial] = cachedApps{apps: apps, fetched: time.Now()}
+	}
+}
+
+// loadPackageComponents returns the exported components of a package
+// on a device, cached; they are read from the installed APK's manifest,
+// or from dumpsys when the manifest cannot be extracted
+func loadPackageComponents(serial, pkg string) *PackageComponents {
+	key := serial + "\x00" + pkg
+	componentCache.Lock()
+	cached, ok := componentCache.components[key]
+	componentCache.Unlock()
+	if ok && time.Since(cached.fetched) < componentCacheTTL {
+		return cached.components
+	}
+
+	pc := manifestComponents(serial, pkg)
+	if pc == nil {
+		cmd := exec.Command("adb", "-s", serial, "shell", "dumpsys", "package", shellQuote(pkg))
+		setupCommand(cmd)
+		out, err := cmd.Output()
+		if err != nil {
+			return nil
+		}
+		pc = parsePackageComponents(string(out), pkg)
+	}
+
+	componentCache.Lock()
+	componentCache.components[key] = cachedComponents{components: pc, fetched: time.Now()}
+	componentCache.Unlock()
+	return pc
+}
+
+// manifestComponents reads the exported components from the manifest
+// of the package's base APK, extracted on the device with unzip; nil
+// when the device has no unzip or the manifest cannot be read
+func manifestComponents(serial, pkg string) *PackageComponents {
+	script := fmt.Sprintf(`unzip -p "$(pm path %s | head -n 1 | cut -d: -f2-)" AndroidManifest.xml`, shellQuote(pkg))
+	cmd := exec.Command("adb", "-s", serial, "exec-out", script)
+	setupCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil || len(out) == 0 {
+		return nil
+	}
+	c, err := apk.ExportedComponents(out)
+	if err != nil {
+		return nil
+	}
+	qualify := func(classes []string) []string {
+		names := make([]string, len(classes))
+		for i, class := range classes {
+			names[i] = pkg + "/" + class
+		}
+		return names
+	}
+	return &PackageComponents{
+		Activities: qualify(c.Activities),
+		Services:   qualify(c.Services),
+		Receivers:  qualify(c.Receivers),
+	}
+}
+
+// parsePackageComponents extracts the components of pkg from
+// "dumpsys package <pkg>" output
+// dumpsys does not tell whether a component is exported, so this lists
+// the components in the resolver tables, those with intent filters:
+// exported ones without filters are missing and unexported ones with
+// filters are included
+func parsePackageComponents(out, pkg string) *PackageComponents {
+	pc := &PackageComponents{}
+	inTable := false
+	var kind componentKind
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line != "" && line[0] != ' ' {
+			kind, inTable = resolverTableKinds[strings.TrimSpace(line)]
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		m := resolverEntryRe.FindStringSubmatch(line)
+		if m == nil || !strings.HasPrefix(m[1], pkg+"/") {
+			continue
+		}
+		component := expandComponentName(m[1])
+		switch kind {
+		case componentActivity:
+			pc.Activities = append(pc.Activities, component)
+		case componentService:
+			pc.Services = append(pc.Services, component)
+		case componentReceiver:
+			pc.Receivers = append(pc.Receivers, component)
+		}
+	}
+	pc.Activities = sortedUnique(pc.Activities)
+	pc.Services = sortedUnique(pc.Services)
+	pc.Receivers = sortedUnique(pc.Receivers)
+	return pc
+}
+
+// sortedUnique sorts names and drops duplicates; a component appears
+// once per intent filter action in the resolver tables
+func sortedUnique(names []string) []string {
+	sort.Strings(names)
+	out := names[:0]
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// expandComponentName turns "com.example/.Main" into "com.example/com.example.Main"
+// so every candidate uses the same fully qualified form
+func expandComponentName(name string) string {
+	i := strings.Index(name, "/")
+	if i < 0 || i+1 >= len(name) || name[i+1] != '.' {
+		return name
+	}
+	return name[:i+1] + name[:i] + name[i+1:]
+}
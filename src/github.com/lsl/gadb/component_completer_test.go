@@ -0,0 +1,65 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadPackagesSharesTheAppsList(t *testing.T) {
+	// The fake adb runs shell commands locally, so dumpsys is a script
+	// printing the sample
+	dir := t.TempDir()
+	sample := filepath.Join(dir, "packages.txt")
+	if err := os.WriteFile(sample, []byte(dumpsysPackagesSample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dumpsys"), []byte("#!/bin/sh\ncat '"+sample+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	serial := "fake-1"
+	t.Cleanup(func() { forgetApps(serial) })
+	want := []string{"com.android.settings", "com.example.app"}
+
+	// No list yet: completion fetches it and "apps" reuses it
+	forgetApps(serial)
+	if got := loadPackages(serial); !reflect.DeepEqual(got, want) {
+		t.Fatalf("loadPackages = %q, want %q", got, want)
+	}
+	componentCache.Lock()
+	_, cached := componentCache.apps[serial]
+	componentCache.Unlock()
+	if !cached {
+		t.Fatal("completion did not fill the apps cache")
+	}
+
+	// A stale list is offered at once and refreshed in the background
+	componentCache.Lock()
+	componentCache.apps[serial] = cachedApps{apps: []*AppInfo{{Package: "com.uninstalled"}}, fetched: time.Now().Add(-time.Hour)}
+	componentCache.Unlock()
+	if got := loadPackages(serial); !reflect.DeepEqual(got, []string{"com.uninstalled"}) {
+		t.Fatalf("loadPackages with a stale list = %q", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		componentCache.Lock()
+		refreshing := componentCache.refreshing[serial]
+		componentCache.Unlock()
+		if !refreshing {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := loadPackages(serial); !reflect.DeepEqual(got, want) {
+		t.Errorf("loadPackages after the refresh = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+package gadb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+)
+
+// defaultPrompt renders the classic "[GADB] <serial> > " prompt
+const defaultPrompt = "[GADB] {serial} > "
+
+// Config holds user settings loaded from the gadb config file
+//
+// The file is line based: "key = value", with "#" starting a comment.
+// Values may be double-quoted to keep leading or trailing spaces.
+// Lines starting with highlight, mute or alert are logcat rules, see
+// logcat.Rule.
+//
+//	prompt = "{cyan}{alias|model}{reset} sdk{sdk} {battery}% {exit_status}> "
+//	alias.emulator-5554 = pixel
+//	transcript = ~/gadb-transcript.ndjson
+//	apk.launch = true
+//	highlight tag=OkHttp color=cyan
+//	mute tag=chatty
+//	alert message~"OutOfMemoryError"
+type Config struct {
+	// Prompt is the REPL prompt template, see renderPrompt
+	Prompt string
+	// Aliases maps device serials to friendly names
+	Aliases map[string]string
+	// Transcript is a file the REPL logs to from startup, if set
+	Transcript string
+	// APKLaunch makes "gadb app.apk" launch the app after installing,
+	// as install --launch does
+	APKLaunch bool
+	// LogcatRules highlight, mute or alert on entries in logcat views
+	LogcatRules logcat.Rules
+}
+
+// DefaultConfig returns the settings used when no config file exists
+func DefaultConfig() *Config {
+	return &Config{
+		Prompt:  defaultPrompt,
+		Aliases: make(map[string]string),
+	}
+}
+
+// logcatRules returns the logcat rules, none without a config
+func (c *Config) logcatRules() logcat.Rules {
+	if c == nil {
+		return nil
+	}
+	return c.LogcatRules
+}
+
+// configDir returns the directory holding gadb's config and session data
+func configDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "gadb")
+	}
+	return filepath.Join(home, ".gadb")
+}
+
+// configPath returns the config file location, honoring GADB_CONFIG
+func configPath() string {
+	if p := os.Getenv("GADB_CONFIG"); p != "" {
+		return p
+	}
+	return filepath.Join(configDir(), "config")
+}
+
+// LoadConfig reads the config file, falling back to defaults
+// A missing file is not an error; a malformed one is reported and ignored
+func LoadConfig() *Config {
+	f, err := os.Open(configPath())
+	if err != nil {
+		return DefaultConfig()
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", configPath(), err)
+		return DefaultConfig()
+	}
+	return cfg
+}
+
+// parseConfig parses config file content
+func parseConfig(r io.Reader) (*Config, error) {
+	cfg := DefaultConfig()
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if logcat.IsRuleLine(line) {
+			rule, err := logcat.ParseRule(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			cfg.LogcatRules = append(cfg.LogcatRules, rule)
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := strings.TrimSpace(line[:eq])
+		value, err := parseConfigValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		switch {
+		case key == "prompt":
+			cfg.Prompt = value
+		case key == "transcript":
+			cfg.Transcript = value
+		case key == "apk.launch":
+			if cfg.APKLaunch, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("line %d: apk.launch must be true or false", lineNo)
+			}
+		case strings.HasPrefix(key, "alias."):
+			cfg.Aliases[strings.TrimPrefix(key, "alias.")] = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", lineNo, key)
+		}
+	}
+	return cfg, scanner.Err()
+}
+
+// parseConfigValue unquotes a double-quoted value
+func parseConfigValue(v string) (string, error) {
+	if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+		return strconv.Unquote(v)
+	}
+	return v, nil
+}
+
+// Alias returns the configured alias for a device serial, if any
+func (c *Config) Alias(serial string) string {
+	return c.Aliases[serial]
+}
@@ -0,0 +1,41 @@
+package gadb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`
+# comment
+prompt = "{cyan}{alias|model}{reset} > "
+alias.emulator-5554 = pixel
+transcript = ~/gadb.ndjson
+apk.launch = true
+mute tag=chatty
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Prompt != "{cyan}{alias|model}{reset} > " || cfg.Alias("emulator-5554") != "pixel" ||
+		cfg.Transcript != "~/gadb.ndjson" || !cfg.APKLaunch || len(cfg.LogcatRules) != 1 {
+		t.Errorf("parseConfig = %+v", cfg)
+	}
+
+	defaults, err := parseConfig(strings.NewReader(""))
+	if err != nil || defaults.Prompt != defaultPrompt || defaults.APKLaunch {
+		t.Errorf("empty config = %+v, %v", defaults, err)
+	}
+
+	for _, bad := range []string{
+		"prompt",
+		"colour = red",
+		`prompt = "unterminated \"`,
+		"apk.launch = sometimes",
+		"mute nothing",
+	} {
+		if _, err := parseConfig(strings.NewReader("# first\n" + bad)); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+			t.Errorf("parseConfig(%q) = %v, want a line 2 error", bad, err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package gadb
 
 import (
 	"fmt"
+	"strings"
+	"sync/atomic"
 )
 
 // Context holds the state for a REPL session
@@ -16,6 +18,26 @@ type Context struct {
 	Running bool
 	// Exit code to return when exiting
 	ExitCode int
+	// Exit code of the last executed command, shown in the prompt
+	LastExitCode int
+	// User settings from the config file
+	Config *Config
+	// Tracker follows device connection state in the background
+	Tracker *DeviceTracker
+	// Transcript records inputs and output when logging is on
+	Transcript *Transcript
+	// openEntry finishes the transcript entry being recorded, if any
+	openEntry func(exitCode int)
+	// Device properties fetched in the background for the prompt
+	info *deviceInfoCache
+	// What the prompt shows, published by the REPL goroutine for
+	// redraws from the tracker's goroutines
+	promptState atomic.Pointer[promptState]
+	// Long-lived shell mode sessions keyed by device serial
+	shellSessions map[string]*ShellSession
+	// Background jobs such as logcat capture
+	jobs      []*job
+	nextJobID int
 }
 
 // NewContext creates a new REPL context with the given devices
@@ -30,6 +52,8 @@ func NewContext(devices []Device) *Context {
 		History:          make([]string, 0, 100),
 		Running:          true,
 		ExitCode:         0,
+		Config:           LoadConfig(),
+		info:             newDeviceInfoCache(),
 	}
 }
 
@@ -42,12 +66,47 @@ func (c *Context) SetCurrentDevice(index int) error {
 	return nil
 }
 
-// GetPrompt returns the current prompt string
-func (c *Context) GetPrompt() string {
+// promptState is a copy of the REPL state the prompt shows
+type promptState struct {
+	device   *Device
+	devices  int
+	lastExit int
+}
+
+// publishPrompt copies the state the prompt shows; only the goroutine
+// running commands calls it, after each command
+func (c *Context) publishPrompt() {
+	s := &promptState{devices: len(c.AvailableDevices), lastExit: c.LastExitCode}
 	if c.CurrentDevice != nil {
-		return fmt.Sprintf("[GADB] %s > ", c.CurrentDevice.Serial)
+		d := *c.CurrentDevice
+		s.device = &d
+	}
+	c.promptState.Store(s)
+}
+
+// GetPrompt returns the prompt rendered from the configured template
+// and the last published state; it is safe from any goroutine
+// It never blocks: slow fields show their last known value
+func (c *Context) GetPrompt() string {
+	s := c.promptState.Load()
+	if s == nil || s.device == nil {
+		return "[GADB] > "
+	}
+	fields := c.promptFields(s)
+	prompt := renderPrompt(c.Config.Prompt, fields)
+	if fields["state"] == disconnectedMarker && !strings.Contains(c.Config.Prompt, "state") {
+		prompt = disconnectedMarker + " " + prompt
 	}
-	return "[GADB] > "
+	return prompt
+}
+
+// StartTracking starts following device state in the background
+// onChange runs whenever tracked state or device info changes
+func (c *Context) StartTracking(onChange func()) {
+	c.Tracker = NewDeviceTracker()
+	c.Tracker.OnChange(onChange)
+	c.info.setOnUpdate(onChange)
+	c.Tracker.Start()
 }
 
 // AddToHistory adds a command to the history
@@ -66,7 +125,7 @@ func (c *Context) AddToHistory(cmd string) {
 func (c *Context) RefreshDevices() {
 	c.AvailableDevices = readDevices()
 	if len(c.AvailableDevices) == 0 {
-		fmt.Println("Warning: No devices found")
+		fmt.Fprintln(commandStdout(), "Warning: No devices found")
 		c.CurrentDevice = nil
 		return
 	}
@@ -83,10 +142,19 @@ func (c *Context) RefreshDevices() {
 	}
 }
 
+// useDevice makes d the current device when a PTY escape switched to it
+func (c *Context) useDevice(d *Device) {
+	if d == nil || c.CurrentDevice != nil && c.CurrentDevice.Serial == d.Serial {
+		return
+	}
+	c.RefreshDevices()
+	c.CurrentDevice = d
+}
+
 // EnsureDevice checks if a device is selected, exits if not
 func (c *Context) EnsureDevice() bool {
 	if c.CurrentDevice == nil {
-		fmt.Println("No device selected. Use 'devices' and 'select' commands first.")
+		fmt.Fprintln(commandStdout(), "No device selected. Use 'devices' and 'select' commands first.")
 		return false
 	}
 	return true
@@ -96,4 +164,10 @@ func (c *Context) EnsureDevice() bool {
 func (c *Context) Stop(code int) {
 	c.Running = false
 	c.ExitCode = code
+	c.stopJobs()
+	if c.Tracker != nil {
+		c.Tracker.Stop()
+	}
+	c.closeShellSessions()
+	_ = stopRecording()
 }
@@ -0,0 +1,145 @@
+package gadb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+)
+
+// capturedCrash is a crash found in a logcat view during this session
+type capturedCrash struct {
+	*logcat.Crash
+	// Device is the device label or serial the crash came from
+	Device string
+	// Path is where the report was saved, empty if saving failed
+	Path string
+}
+
+// sessionCrashes lists the crashes captured since gadb started
+var sessionCrashes struct {
+	sync.Mutex
+	list []*capturedCrash
+}
+
+// crashDir is where crash reports are saved
+func crashDir() string {
+	return filepath.Join(configDir(), "crashes")
+}
+
+// unsafeFileChars are replaced in crash file names; network serials
+// contain ':' which Windows does not allow
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// crashFileName names a report by device, package, time and kind
+func crashFileName(device string, c *logcat.Crash) string {
+	pkg := c.Package
+	if pkg == "" {
+		pkg = "unknown"
+	}
+	return fmt.Sprintf("%s_%s_%s_%s.txt",
+		unsafeFileChars.ReplaceAllString(device, "_"),
+		unsafeFileChars.ReplaceAllString(pkg, "_"),
+		c.Time.Format("20060102-150405"), c.Kind)
+}
+
+// captureCrash saves a crash report and adds it to the session list
+func captureCrash(device string, c *logcat.Crash) (*capturedCrash, error) {
+	cc := &capturedCrash{Crash: c, Device: device}
+	sessionCrashes.Lock()
+	sessionCrashes.list = append(sessionCrashes.list, cc)
+	sessionCrashes.Unlock()
+
+	if err := os.MkdirAll(crashDir(), 0755); err != nil {
+		return cc, fmt.Errorf("failed to create crash directory: %w", err)
+	}
+	name := crashFileName(device, c)
+	path := filepath.Join(crashDir(), name)
+	// Several crashes in the same second get numbered files
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(crashDir(), fmt.Sprintf("%s-%d.txt", strings.TrimSuffix(name, ".txt"), n))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s in %s (pid %d) on %s at %s\n", c.Kind, c.Package, c.PID, device, c.Time.Format("2006-01-02 15:04:05.000"))
+	fmt.Fprintf(&b, "# %s\n\n", c.Summary)
+	b.WriteString(c.Text())
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return cc, fmt.Errorf("failed to save crash report: %w", err)
+	}
+	cc.Path = path
+	return cc, nil
+}
+
+// crashTitle is the one-line description of a crash
+func crashTitle(cc *capturedCrash) string {
+	pkg := cc.Package
+	if pkg == "" {
+		pkg = "unknown process"
+	}
+	title := fmt.Sprintf("%s (pid %d) on %s", pkg, cc.PID, cc.Device)
+	if cc.Summary != "" {
+		title += ": " + cc.Summary
+	}
+	return title
+}
+
+// printCrashAlert prints a highlighted crash summary
+func printCrashAlert(w io.Writer, color bool, cc *capturedCrash) {
+	label := strings.ToUpper(cc.Kind.String())
+	if color {
+		fmt.Fprintf(w, "\033[1;37;41m %s \033[0m \033[1;31m%s\033[0m\n", label, crashTitle(cc))
+	} else {
+		fmt.Fprintf(w, "[%s] %s\n", label, crashTitle(cc))
+	}
+	if cc.Path != "" {
+		fmt.Fprintf(w, "        saved to %s\n", cc.Path)
+	}
+}
+
+// runCrashesCommand handles the REPL "crashes" command: list the
+// crashes captured this session, show one, or clear the list
+func runCrashesCommand(args []string) error {
+	sessionCrashes.Lock()
+	list := append([]*capturedCrash(nil), sessionCrashes.list...)
+	sessionCrashes.Unlock()
+
+	if len(args) == 1 && args[0] == "clear" {
+		sessionCrashes.Lock()
+		sessionCrashes.list = nil
+		sessionCrashes.Unlock()
+		return nil
+	}
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(list) {
+			return fmt.Errorf("usage: crashes [<number> | clear]")
+		}
+		cc := list[n-1]
+		printCrashAlert(commandStdout(), useColor(os.Stdout), cc)
+		fmt.Fprintln(commandStdout(), "")
+		fmt.Fprint(commandStdout(), cc.Text())
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: crashes [<number> | clear]")
+	}
+
+	if len(list) == 0 {
+		fmt.Fprintln(commandStdout(), "No crashes captured in this session")
+		return nil
+	}
+	for i, cc := range list {
+		fmt.Fprintf(commandStdout(), "%3d  %s  %-6s  %s\n", i+1, cc.Time.Format("01-02 15:04:05"), cc.Kind, crashTitle(cc))
+	}
+	return nil
+}
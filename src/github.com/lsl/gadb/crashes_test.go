@@ -0,0 +1,85 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// crashLog is a logcat sample with a Java crash, an ANR and a native crash
+const crashLog = "logcat/testdata/crashes.txt"
+
+// sessionCrashCount returns the number of crashes captured so far
+func sessionCrashCount() int {
+	sessionCrashes.Lock()
+	defer sessionCrashes.Unlock()
+	return len(sessionCrashes.list)
+}
+
+func TestRedirectedLogcatDetectsCrashes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	fixture, err := filepath.Abs(crashLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_LOGCAT", fixture)
+
+	before := sessionCrashCount()
+	out := filepath.Join(t.TempDir(), "log.txt")
+	if err := ExecWithRedirect(&Device{Serial: "fake-1"}, ParseCommand("logcat -d > "+out), nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("redirected lines changed:\n%s", got)
+	}
+	if n := sessionCrashCount() - before; n != 3 {
+		t.Errorf("detected %d crashes, want 3", n)
+	}
+	reports, _ := os.ReadDir(filepath.Join(home, ".gadb", "crashes"))
+	if len(reports) != 3 {
+		t.Errorf("saved %d crash reports, want 3", len(reports))
+	}
+}
+
+func TestCaptureDetectsCrashes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fixture, err := filepath.Abs(crashLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_LOGCAT", fixture)
+
+	c, err := startCapture(filepath.Join(t.TempDir(), "capture"), defaultCaptureFileSize, defaultCaptureFiles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		found := 0
+		for _, d := range c.devices {
+			found += d.crashes
+		}
+		c.mu.Unlock()
+		if found == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("found %d crashes on the two fake devices, want 6", found)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
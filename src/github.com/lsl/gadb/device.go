@@ -30,12 +30,12 @@ func readDevices() []Device {
 	cmd := exec.Command("adb", "devices", "-l")
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(commandStdout(), err)
 		os.Exit(1)
 	}
 	err = cmd.Start()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(commandStdout(), err)
 		os.Exit(1)
 	}
 	reader := bufio.NewReader(stdout)
@@ -137,11 +137,11 @@ func selectDevices(devs []Device) []Device {
 func ListDevices() {
 	devices := readDevices()
 	if len(devices) == 0 {
-		fmt.Println("No device found")
+		fmt.Fprintln(commandStdout(), "No device found")
 		return
 	}
-	fmt.Println("Connected devices:")
+	fmt.Fprintln(commandStdout(), "Connected devices:")
 	for i, d := range devices {
-		fmt.Printf("  [%d] %s\n", i+1, d.String())
+		fmt.Fprintf(commandStdout(), "  [%d] %s\n", i+1, d.String())
 	}
 }
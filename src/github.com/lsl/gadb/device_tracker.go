@@ -0,0 +1,178 @@
+package gadb
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trackerRetryDelay is how long the tracker waits before reconnecting
+// to the adb server after the connection drops
+const trackerRetryDelay = 2 * time.Second
+
+// DeviceTracker follows device connection state through the adb
+// server's track-devices service, so callers can react to devices
+// appearing and disappearing without polling "adb devices"
+type DeviceTracker struct {
+	mu       sync.Mutex
+	states   map[string]string
+	ready    bool
+	conn     net.Conn
+	stopped  bool
+	onChange []*trackerCallback
+}
+
+// trackerCallback is a registered OnChange callback; its pointer
+// identifies it for removal
+type trackerCallback struct {
+	fn func()
+}
+
+// NewDeviceTracker creates a tracker; call Start to begin tracking
+func NewDeviceTracker() *DeviceTracker {
+	return &DeviceTracker{states: make(map[string]string)}
+}
+
+// Start runs the tracking loop in the background
+func (t *DeviceTracker) Start() {
+	go t.loop()
+}
+
+// Stop ends tracking and closes the adb server connection
+func (t *DeviceTracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	if t.conn != nil {
+		t.conn.Close()
+	}
+}
+
+// OnChange registers a callback run after every device list update
+// and returns a function that unregisters it
+// Callbacks run on the tracker goroutine and must not block
+func (t *DeviceTracker) OnChange(fn func()) (remove func()) {
+	cb := &trackerCallback{fn: fn}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChange = append(t.onChange, cb)
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for i, c := range t.onChange {
+			if c == cb {
+				t.onChange = append(t.onChange[:i:i], t.onChange[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// State returns the connection state of a device ("device", "offline",
+// "unauthorized", ...) or "" if it is not connected
+// known is false until the tracker has received its first device list
+func (t *DeviceTracker) State(serial string) (state string, known bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.states[serial], t.ready
+}
+
+// Online returns the serials of devices in the "device" state
+// known is false until the tracker has received its first device list
+func (t *DeviceTracker) Online() (serials []string, known bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for serial, state := range t.states {
+		if state == "device" {
+			serials = append(serials, serial)
+		}
+	}
+	sort.Strings(serials)
+	return serials, t.ready
+}
+
+// loop keeps a track-devices connection open, reconnecting as needed
+func (t *DeviceTracker) loop() {
+	for {
+		t.mu.Lock()
+		stopped := t.stopped
+		t.mu.Unlock()
+		if stopped {
+			return
+		}
+
+		if err := t.track(); err != nil {
+			t.mu.Lock()
+			t.ready = false
+			t.mu.Unlock()
+		}
+		time.Sleep(trackerRetryDelay)
+	}
+}
+
+// track reads device list updates until the connection fails
+func (t *DeviceTracker) track() error {
+	conn, err := net.DialTimeout("tcp", adbServerAddr(), syncDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return nil
+	}
+	t.conn = conn
+	t.mu.Unlock()
+
+	if err := sendHostRequest(conn, "host:track-devices"); err != nil {
+		return err
+	}
+
+	lenHex := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, lenHex); err != nil {
+			return err
+		}
+		n, err := strconv.ParseUint(string(lenHex), 16, 32)
+		if err != nil {
+			return fmt.Errorf("bad track-devices length %q", lenHex)
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return err
+		}
+		t.update(parseTrackDevices(string(payload)))
+	}
+}
+
+// update replaces the known device states and notifies listeners
+func (t *DeviceTracker) update(states map[string]string) {
+	t.mu.Lock()
+	t.states = states
+	t.ready = true
+	callbacks := append([]*trackerCallback{}, t.onChange...)
+	t.mu.Unlock()
+
+	for _, cb := range callbacks {
+		cb.fn()
+	}
+}
+
+// parseTrackDevices parses a track-devices payload of "serial\tstate" lines
+func parseTrackDevices(payload string) map[string]string {
+	states := make(map[string]string)
+	for _, line := range strings.Split(payload, "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) == 2 && parts[0] != "" {
+			states[parts[0]] = strings.TrimSpace(parts[1])
+		}
+	}
+	return states
+}
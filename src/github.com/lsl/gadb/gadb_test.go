@@ -16,7 +16,7 @@ func Test_read_devices(t *testing.T) {
 func Test_read_devices_time(t *testing.T) {
 
 	start := time.Now()
-	read_devices()
+	readDevices()
 	end := time.Now()
 	fmt.Printf("time %s", end.Sub(start))
 }
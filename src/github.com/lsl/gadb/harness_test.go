@@ -0,0 +1,142 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// fakeADBScript stands in for adb in tests: "devices" lists two
+// devices, "shell" runs the command with the local sh and "logcat"
+// prints $FAKE_LOGCAT, or $FAKE_LOGCAT_REPEAT until killed, appending
+// its arguments to $FAKE_ADB_ARGS as one "[arg][arg]..." line per call
+const fakeADBScript = `#!/bin/sh
+if [ "$1" = "-s" ]; then shift 2; fi
+case "$1" in
+devices)
+	printf 'List of devices attached\nfake-1\tdevice product:fake model:Fake_One device:fake\nfake-2\tdevice product:fake model:Fake_Two device:fake\n\n'
+	;;
+logcat)
+	if [ -n "$FAKE_ADB_ARGS" ]; then printf '[%s]' "$@" >> "$FAKE_ADB_ARGS"; echo >> "$FAKE_ADB_ARGS"; fi
+	if [ -n "$FAKE_LOGCAT_REPEAT" ]; then exec yes "$FAKE_LOGCAT_REPEAT"; fi
+	if [ -n "$FAKE_LOGCAT" ]; then cat "$FAKE_LOGCAT"; fi
+	;;
+shell)
+	shift
+	if [ $# -eq 0 ]; then exec sh; fi
+	exec sh -c "$*"
+	;;
+*)
+	echo "fake adb: unsupported command: $*" >&2
+	exit 1
+	;;
+esac
+`
+
+// TestMain puts the fake adb first in PATH for every test
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gadb-fake-adb-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "adb"), []byte(fakeADBScript), 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeTerminal is a pseudo-terminal standing in for the user's terminal:
+// tests type into master and the code under test reads from tty
+type fakeTerminal struct {
+	master *os.File
+	tty    *os.File
+}
+
+// newFakeTerminal opens a pseudo-terminal closed at the end of the test
+func newFakeTerminal(t *testing.T) *fakeTerminal {
+	t.Helper()
+	master, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	t.Cleanup(func() {
+		master.Close()
+		tty.Close()
+	})
+	return &fakeTerminal{master: master, tty: tty}
+}
+
+// typeKeys writes keystrokes as if typed by the user
+func (f *fakeTerminal) typeKeys(t *testing.T, keys string) {
+	t.Helper()
+	if _, err := f.master.WriteString(keys); err != nil {
+		t.Fatalf("typing %q: %v", keys, err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writers and readers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits until out contains want
+func waitForOutput(t *testing.T, out *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(out.String(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q, got %q", want, out.String())
+}
+
+// runPTYAsync runs a PTY session in the background and returns its result channel
+func runPTYAsync(term *fakeTerminal, out *syncBuffer, args ...string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- runPTYSession(term.tty, out, "fake-1", args)
+	}()
+	return done
+}
+
+// waitForSession waits for a PTY session to end
+func waitForSession(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("PTY session did not end")
+		return nil
+	}
+}
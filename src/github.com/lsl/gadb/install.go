@@ -0,0 +1,550 @@
+package gadb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/apk"
+)
+
+// apkInfoUsage is shown for malformed apkinfo commands
+const apkInfoUsage = "usage: apkinfo [--json] <file.apk>"
+
+// runApkInfoCommand handles "apkinfo <file.apk>": show the manifest
+// details of a local APK; no device needed
+func runApkInfoCommand(args []string, out io.Writer) error {
+	asJSON, path := false, ""
+	for _, a := range args {
+		switch {
+		case a == "--json":
+			asJSON = true
+		case strings.HasPrefix(a, "-") || path != "":
+			return fmt.Errorf(apkInfoUsage)
+		default:
+			path = a
+		}
+	}
+	if path == "" {
+		return fmt.Errorf(apkInfoUsage)
+	}
+	info, err := apk.Open(path)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	printApkInfo(out, info)
+	return nil
+}
+
+// printApkInfo writes the details as aligned "key: value" lines
+func printApkInfo(out io.Writer, info *apk.Info) {
+	orNone := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	abis := "any (no native code)"
+	if len(info.ABIs) > 0 {
+		abis = strings.Join(info.ABIs, ", ")
+	}
+	fmt.Fprintf(out, "package:      %s\n", info.Package)
+	if info.Split != "" {
+		fmt.Fprintf(out, "split:        %s\n", info.Split)
+	}
+	fmt.Fprintf(out, "label:        %s\n", orNone(info.Label))
+	fmt.Fprintf(out, "version:      %s (%d)\n", orNone(info.VersionName), info.VersionCode)
+	fmt.Fprintf(out, "minSdk:       %d\n", info.MinSdk)
+	fmt.Fprintf(out, "targetSdk:    %d\n", info.TargetSdk)
+	fmt.Fprintf(out, "launcher:     %s\n", orNone(info.LaunchActivity))
+	fmt.Fprintf(out, "abis:         %s\n", abis)
+	fmt.Fprintf(out, "permissions:  %d\n", len(info.Permissions))
+	for _, p := range info.Permissions {
+		fmt.Fprintf(out, "  %s\n", p)
+	}
+}
+
+// deviceTarget is what install checks and split selection need to
+// know about a device
+type deviceTarget struct {
+	SDK int
+	apk.DeviceConfig
+}
+
+// readDeviceTarget queries the SDK level, ABIs, density and locale of
+// a device
+func readDeviceTarget(serial string) (*deviceTarget, error) {
+	cmd := exec.Command("adb", "-s", serial, "shell",
+		"getprop ro.build.version.sdk; getprop ro.product.cpu.abilist; getprop ro.product.cpu.abi; "+
+			"getprop ro.sf.lcd_density; getprop persist.sys.locale; getprop ro.product.locale")
+	setupCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device properties: %w", err)
+	}
+	return parseDeviceTarget(string(out)), nil
+}
+
+// parseDeviceTarget reads the output of the getprop calls in
+// readDeviceTarget; devices before Lollipop have no abilist, only abi,
+// and the locale is in ro.product.locale until the user changes it
+func parseDeviceTarget(out string) *deviceTarget {
+	lines := strings.Split(strings.ReplaceAll(out, "\r", ""), "\n")
+	for len(lines) < 6 {
+		lines = append(lines, "")
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	t := &deviceTarget{}
+	t.SDK, _ = strconv.Atoi(lines[0])
+	abis := lines[1]
+	if abis == "" {
+		abis = lines[2]
+	}
+	for _, abi := range strings.Split(abis, ",") {
+		if abi = strings.TrimSpace(abi); abi != "" {
+			t.ABIs = append(t.ABIs, abi)
+		}
+	}
+	t.Density, _ = strconv.Atoi(lines[3])
+	for _, locale := range lines[4:6] {
+		if locale != "" {
+			t.Locales = append(t.Locales, locale)
+			break
+		}
+	}
+	return t
+}
+
+// checkInstall returns why an APK cannot be installed on a device,
+// nil when it can; unknown device values are not held against it
+func checkInstall(info *apk.Info, t *deviceTarget) error {
+	if t.SDK > 0 && info.MinSdk > t.SDK {
+		return fmt.Errorf("%s needs SDK %d, device has SDK %d", info.Package, info.MinSdk, t.SDK)
+	}
+	if len(t.ABIs) > 0 {
+		if _, ok := info.SupportsABI(t.ABIs); !ok {
+			return fmt.Errorf("%s has native code for %s only, device supports %s",
+				info.Package, strings.Join(info.ABIs, ", "), strings.Join(t.ABIs, ", "))
+		}
+	}
+	return nil
+}
+
+// installAPKs returns the APK files an install command names
+func installAPKs(args []string) []string {
+	var apks []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") && strings.HasSuffix(strings.ToLower(a), ".apk") {
+			apks = append(apks, a)
+		}
+	}
+	return apks
+}
+
+// isInstallable reports whether path is an APK, a split APK archive
+// or a directory of splits, as "gadb <path>" installs
+func isInstallable(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".apk") || apk.IsBundle(path)
+}
+
+// installBundle finds the split APK archive or directory among the
+// install arguments, returning it and the other arguments
+func installBundle(args []string) (string, []string, bool) {
+	for i, a := range args {
+		if !strings.HasPrefix(a, "-") && apk.IsBundle(a) {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return a, rest, true
+		}
+	}
+	return "", args, false
+}
+
+// installFlags are the install options gadb handles itself; the
+// rest are passed to adb
+type installFlags struct {
+	noCheck bool
+	// launch starts the launcher activity after installing;
+	// waitDebugger and clearLogcat imply it
+	launch       bool
+	waitDebugger bool
+	clearLogcat  bool
+	// ifNewer skips devices with the same or a later versionCode,
+	// skipSame only those with the same one
+	ifNewer  bool
+	skipSame bool
+}
+
+// splitInstallArgs separates gadb's install flags from adb's
+func splitInstallArgs(args []string) (installFlags, []string) {
+	var flags installFlags
+	var rest []string
+	for _, a := range args {
+		switch a {
+		case "--no-check":
+			flags.noCheck = true
+		case "--launch":
+			flags.launch = true
+		case "--wait-debugger":
+			flags.launch, flags.waitDebugger = true, true
+		case "--clear-logcat":
+			flags.launch, flags.clearLogcat = true, true
+		case "--if-newer":
+			flags.ifNewer = true
+		case "--skip-same":
+			flags.skipSame = true
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return flags, rest
+}
+
+// installOutcome is how an install went on one device
+type installOutcome int
+
+const (
+	installDone installOutcome = iota
+	installSkipped
+	installFailed
+)
+
+// installResult is the outcome of an install on one device, with the
+// reason it was skipped or failed
+type installResult struct {
+	serial  string
+	outcome installOutcome
+	detail  string
+	err     error
+	// installTime and launchTime are how long adb took, zero for steps
+	// that did not run
+	installTime time.Duration
+	launchTime  time.Duration
+}
+
+// runInstallCommand handles "install" on one device
+func runInstallCommand(device *Device, args []string) error {
+	return installOnDevice(device.Serial, args).err
+}
+
+// runFleetInstall installs on each device in turn, then lists which
+// were installed, skipped or failed
+func runFleetInstall(devices []Device, args []string) error {
+	var results []installResult
+	for _, d := range devices {
+		results = append(results, installOnDevice(d.Serial, args))
+	}
+	failed := printInstallSummary(commandStdout(), results)
+	if failed > 0 {
+		return fmt.Errorf("install failed on %d of %d devices", failed, len(results))
+	}
+	return nil
+}
+
+// printInstallSummary writes one line per device and returns the
+// number of failures
+func printInstallSummary(out io.Writer, results []installResult) int {
+	labels := map[installOutcome]string{installDone: "installed", installSkipped: "skipped", installFailed: "failed"}
+	width, failed := 0, 0
+	for _, r := range results {
+		width = max(width, len(r.serial))
+		if r.outcome == installFailed {
+			failed++
+		}
+	}
+	fmt.Fprintln(out, "\nInstall summary:")
+	for _, r := range results {
+		fmt.Fprintf(out, "  %-9s  %-*s  %s\n", labels[r.outcome], width, r.serial, r.detail)
+	}
+	return failed
+}
+
+// installOnDevice checks, installs and optionally launches an app on
+// one device; adb's output is shown as it runs
+// An APK gadb cannot read is passed on for adb to judge
+func installOnDevice(serial string, args []string) installResult {
+	flags, adbArgs := splitInstallArgs(args)
+	fail := func(err error) installResult {
+		return installResult{serial: serial, outcome: installFailed, detail: err.Error(), err: err}
+	}
+
+	plan, err := planInstall(serial, adbArgs, flags)
+	if err != nil {
+		return fail(err)
+	}
+	defer plan.close()
+
+	if reason := plan.skipReason(serial, flags); reason != "" {
+		fmt.Fprintf(commandStdout(), "Skipping %s: %s\n", serial, reason)
+		return installResult{serial: serial, outcome: installSkipped, detail: reason}
+	}
+
+	started := time.Now()
+	output, err := runAdbCapture(serial, plan.args...)
+	if err != nil && isIncompatibleUpdate(output) && plan.info != nil && confirmReinstall(serial, plan.info.Package) {
+		if err = runAdbCommand(serial, "uninstall", plan.info.Package); err == nil {
+			started = time.Now()
+			output, err = runAdbCapture(serial, plan.args...)
+		}
+	}
+	forgetApps(serial)
+	if err != nil {
+		if code := installFailureRe.FindString(output); code != "" {
+			return fail(fmt.Errorf("%s", code))
+		}
+		return fail(err)
+	}
+
+	result := installResult{serial: serial, outcome: installDone, installTime: time.Since(started)}
+	if plan.info != nil {
+		result.detail = fmt.Sprintf("%s %s (%d)", plan.info.Package, plan.info.VersionName, plan.info.VersionCode)
+	}
+	if flags.launch {
+		started = time.Now()
+		if err := launchInstalled(serial, plan.info, flags); err != nil {
+			failed := fail(fmt.Errorf("installed, but launch failed: %w", err))
+			failed.installTime = result.installTime
+			return failed
+		}
+		result.launchTime = time.Since(started)
+	}
+	return result
+}
+
+// installPlan is an install command resolved for one device
+type installPlan struct {
+	// info describes the (base) APK, nil when gadb could not read it
+	info *apk.Info
+	// args are the adb arguments, install or install-multiple
+	args  []string
+	close func()
+}
+
+// planInstall reads the APKs or bundle an install names, runs the
+// install checks and builds the adb command
+func planInstall(serial string, adbArgs []string, flags installFlags) (*installPlan, error) {
+	if bundle, rest, ok := installBundle(adbArgs); ok {
+		return planBundleInstall(serial, bundle, rest, flags)
+	}
+	apks := openInstallAPKs(installAPKs(adbArgs))
+	if !flags.noCheck {
+		if err := checkInstallOnDevice(serial, apks); err != nil {
+			return nil, err
+		}
+	}
+	plan := &installPlan{args: append([]string{"install"}, adbArgs...), close: func() {}}
+	for _, a := range apks {
+		if a.info != nil {
+			plan.info = a.info
+			break
+		}
+	}
+	return plan, nil
+}
+
+// planBundleInstall picks the splits of a bundle that suit the device
+// for install-multiple
+func planBundleInstall(serial, path string, adbArgs []string, flags installFlags) (*installPlan, error) {
+	if len(installAPKs(adbArgs)) > 0 {
+		return nil, fmt.Errorf("install one bundle at a time, without other APKs")
+	}
+	b, err := apk.OpenBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	target, err := readDeviceTarget(serial)
+	if err == nil && !flags.noCheck {
+		if err = checkInstall(b.Base.Info, target); err != nil {
+			err = fmt.Errorf("refusing to install %s on %s: %w (use --no-check to try anyway)", path, serial, err)
+		}
+	}
+	var splits []*apk.Split
+	if err == nil {
+		if splits, err = b.Select(target.DeviceConfig); err != nil {
+			err = fmt.Errorf("cannot install %s on %s: %w", path, serial, err)
+		}
+	}
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	names := make([]string, len(splits))
+	args := append([]string{"install-multiple"}, adbArgs...)
+	for i, s := range splits {
+		names[i] = s.Name()
+		args = append(args, s.Path)
+	}
+	fmt.Fprintf(commandStdout(), "Splits of %s for %s: %s\n", b.Base.Info.Package, serial, strings.Join(names, ", "))
+	return &installPlan{info: b.Base.Info, args: args, close: func() { b.Close() }}, nil
+}
+
+// skipReason returns why --if-newer or --skip-same skip the device,
+// "" to install; without a readable APK nothing is skipped
+func (p *installPlan) skipReason(serial string, flags installFlags) string {
+	if !flags.ifNewer && !flags.skipSame || p.info == nil {
+		return ""
+	}
+	installed, err := installedVersion(serial, p.info.Package)
+	if err != nil {
+		fmt.Fprintf(commandStderr(), "Warning: %v\n", err)
+		return ""
+	}
+	return versionSkipReason(p.info, installed, flags)
+}
+
+// versionSkipReason compares the APK's versionCode with the installed
+// one, -1 when the package is not installed: --skip-same skips the same
+// version and --if-newer an older APK too
+func versionSkipReason(info *apk.Info, installed int64, flags installFlags) string {
+	switch {
+	case installed < 0:
+		return ""
+	case installed == info.VersionCode && (flags.ifNewer || flags.skipSame):
+		return fmt.Sprintf("%s is already at versionCode %d", info.Package, installed)
+	case flags.ifNewer && installed > info.VersionCode:
+		return fmt.Sprintf("%s has versionCode %d, newer than %d", info.Package, installed, info.VersionCode)
+	}
+	return ""
+}
+
+// installedVersion returns the versionCode of a package on a device,
+// -1 when it is not installed
+func installedVersion(serial, pkg string) (int64, error) {
+	apps, err := loadApps(serial)
+	if err != nil {
+		return 0, err
+	}
+	for _, app := range apps {
+		if app.Package == pkg {
+			return app.VersionCode, nil
+		}
+	}
+	return -1, nil
+}
+
+// forgetApps drops the cached package list of a device after it
+// changed
+func forgetApps(serial string) {
+	componentCache.Lock()
+	delete(componentCache.apps, serial)
+	componentCache.Unlock()
+}
+
+// installFailureRe finds pm's failure code in adb install output
+var installFailureRe = regexp.MustCompile(`INSTALL_[A-Z_]+`)
+
+// isIncompatibleUpdate reports whether an install failed because the
+// installed app is signed with a different key
+func isIncompatibleUpdate(output string) bool {
+	return strings.Contains(output, "INSTALL_FAILED_UPDATE_INCOMPATIBLE") ||
+		strings.Contains(output, "INSTALL_PARSE_FAILED_INCONSISTENT_CERTIFICATES") ||
+		strings.Contains(strings.ToLower(output), "signatures do not match")
+}
+
+// confirmReinstall asks before uninstalling, which deletes the app's
+// data; only "yes" agrees
+func confirmReinstall(serial, pkg string) bool {
+	fmt.Printf("The installed %s on %s is signed with a different key.\n", pkg, serial)
+	fmt.Printf("Uninstall it, deleting its data, and install again? Type \"yes\" to continue: ")
+	input := bufio.NewScanner(os.Stdin)
+	if !input.Scan() {
+		fmt.Println("")
+		return false
+	}
+	return strings.TrimSpace(input.Text()) == "yes"
+}
+
+// installAPK is an APK named by an install command and what gadb read
+// from it, nil when it could not be read
+type installAPK struct {
+	path string
+	info *apk.Info
+}
+
+// openInstallAPKs reads the APKs, warning about those it cannot
+func openInstallAPKs(paths []string) []installAPK {
+	apks := make([]installAPK, 0, len(paths))
+	for _, path := range paths {
+		info, err := apk.Open(path)
+		if err != nil {
+			fmt.Fprintf(commandStderr(), "Warning: %v\n", err)
+		}
+		apks = append(apks, installAPK{path: path, info: info})
+	}
+	return apks
+}
+
+// checkInstallOnDevice runs checkInstall for each readable APK
+func checkInstallOnDevice(serial string, apks []installAPK) error {
+	var target *deviceTarget
+	for _, a := range apks {
+		if a.info == nil {
+			continue
+		}
+		if target == nil {
+			var err error
+			if target, err = readDeviceTarget(serial); err != nil {
+				fmt.Fprintf(commandStderr(), "Skipping install checks: %v\n", err)
+				return nil
+			}
+		}
+		if err := checkInstall(a.info, target); err != nil {
+			return fmt.Errorf("refusing to install %s on %s: %w (use --no-check to try anyway)", a.path, serial, err)
+		}
+	}
+	return nil
+}
+
+// launchInstalled starts the app's launcher activity, clearing logcat
+// first or waiting for a debugger as the flags ask
+func launchInstalled(serial string, info *apk.Info, flags installFlags) error {
+	if info == nil || info.Component() == "" {
+		return fmt.Errorf("cannot launch: no launcher activity found in the installed APK")
+	}
+	if flags.clearLogcat {
+		if err := runAdbCommand(serial, "logcat", "-c"); err != nil {
+			return err
+		}
+	}
+	start := []string{"shell", "am", "start"}
+	if flags.waitDebugger {
+		start = append(start, "-D")
+	}
+	start = append(start, "-n", info.Component())
+	return runAdbCommand(serial, start...)
+}
+
+// runAdbCommand runs an adb command on a device, showing it and its
+// output
+func runAdbCommand(serial string, args ...string) error {
+	_, err := runAdbCapture(serial, args...)
+	return err
+}
+
+// runAdbCapture is runAdbCommand that also returns the output
+func runAdbCapture(serial string, args ...string) (string, error) {
+	adbArgs := append([]string{"-s", serial}, args...)
+	cmd := exec.Command("adb", adbArgs...)
+	setupCommand(cmd)
+	var output bytes.Buffer
+	cmd.Stdout = io.MultiWriter(commandStdout(), &output)
+	cmd.Stderr = io.MultiWriter(commandStderr(), &output)
+	fmt.Fprintf(commandStdout(), "adb %s\n", adbArgs)
+	err := cmd.Run()
+	return output.String(), err
+}
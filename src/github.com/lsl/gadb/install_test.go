@@ -0,0 +1,108 @@
+package gadb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gadb/src/github.com/lsl/gadb/apk"
+)
+
+func TestParseDeviceTarget(t *testing.T) {
+	got := parseDeviceTarget("34\r\narm64-v8a,armeabi-v7a,armeabi\r\narm64-v8a\r\n420\r\nfr-FR\r\nen-US\r\n")
+	want := &deviceTarget{SDK: 34, DeviceConfig: apk.DeviceConfig{
+		ABIs:    []string{"arm64-v8a", "armeabi-v7a", "armeabi"},
+		Density: 420,
+		Locales: []string{"fr-FR"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDeviceTarget = %+v, want %+v", got, want)
+	}
+	// KitKat has no abilist, and no persist.sys.locale until changed
+	got = parseDeviceTarget("19\n\narmeabi-v7a\n240\n\nen-US\n")
+	if !reflect.DeepEqual(got.ABIs, []string{"armeabi-v7a"}) || !reflect.DeepEqual(got.Locales, []string{"en-US"}) {
+		t.Errorf("parseDeviceTarget without abilist = %+v", got)
+	}
+}
+
+func TestVersionSkipReason(t *testing.T) {
+	info := &apk.Info{Package: "com.example", VersionCode: 20}
+	tests := []struct {
+		name      string
+		installed int64
+		flags     installFlags
+		skip      bool
+	}{
+		{"if-newer, not installed", -1, installFlags{ifNewer: true}, false},
+		{"if-newer, older installed", 10, installFlags{ifNewer: true}, false},
+		{"if-newer, same installed", 20, installFlags{ifNewer: true}, true},
+		{"if-newer, newer installed", 30, installFlags{ifNewer: true}, true},
+		{"skip-same, not installed", -1, installFlags{skipSame: true}, false},
+		{"skip-same, older installed", 10, installFlags{skipSame: true}, false},
+		{"skip-same, same installed", 20, installFlags{skipSame: true}, true},
+		{"skip-same, newer installed", 30, installFlags{skipSame: true}, false},
+		{"no flags, same installed", 20, installFlags{}, false},
+	}
+	for _, tt := range tests {
+		if reason := versionSkipReason(info, tt.installed, tt.flags); (reason != "") != tt.skip {
+			t.Errorf("%s: versionSkipReason = %q, want skip %v", tt.name, reason, tt.skip)
+		}
+	}
+}
+
+func TestCheckInstall(t *testing.T) {
+	info := &apk.Info{Package: "com.example", MinSdk: 26, ABIs: []string{"arm64-v8a"}}
+	tests := []struct {
+		target *deviceTarget
+		ok     bool
+	}{
+		{&deviceTarget{SDK: 34, DeviceConfig: apk.DeviceConfig{ABIs: []string{"arm64-v8a", "armeabi-v7a"}}}, true},
+		{&deviceTarget{SDK: 25, DeviceConfig: apk.DeviceConfig{ABIs: []string{"arm64-v8a"}}}, false},
+		{&deviceTarget{SDK: 34, DeviceConfig: apk.DeviceConfig{ABIs: []string{"x86_64", "x86"}}}, false},
+		// Unknown values do not block the install
+		{&deviceTarget{}, true},
+	}
+	for _, tt := range tests {
+		if err := checkInstall(info, tt.target); (err == nil) != tt.ok {
+			t.Errorf("checkInstall(%+v) = %v, want ok %v", tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestSplitInstallArgs(t *testing.T) {
+	flags, rest := splitInstallArgs([]string{"-r", "--wait-debugger", "--no-check", "-g", "app.apk"})
+	if !flags.launch || !flags.waitDebugger || !flags.noCheck || flags.clearLogcat {
+		t.Errorf("flags = %+v", flags)
+	}
+	if want := []string{"-r", "-g", "app.apk"}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("adb args = %q, want %q", rest, want)
+	}
+}
+
+func TestInstallSummaryAndFailures(t *testing.T) {
+	var out strings.Builder
+	failed := printInstallSummary(&out, []installResult{
+		{serial: "pixel", outcome: installDone, detail: "com.example 1.2 (12)"},
+		{serial: "emulator-5554", outcome: installSkipped, detail: "com.example is already at versionCode 12"},
+		{serial: "tab", outcome: installFailed, detail: "INSTALL_FAILED_INSUFFICIENT_STORAGE"},
+	})
+	want := `
+Install summary:
+  installed  pixel          com.example 1.2 (12)
+  skipped    emulator-5554  com.example is already at versionCode 12
+  failed     tab            INSTALL_FAILED_INSUFFICIENT_STORAGE
+`
+	if failed != 1 || out.String() != want {
+		t.Errorf("printInstallSummary = %d, %q", failed, out.String())
+	}
+
+	for output, want := range map[string]bool{
+		"adb: failed to install app.apk: Failure [INSTALL_FAILED_UPDATE_INCOMPATIBLE: Package com.example signatures do not match previously installed version; ignoring!]": true,
+		"Failure [INSTALL_PARSE_FAILED_INCONSISTENT_CERTIFICATES]": true,
+		"Failure [INSTALL_FAILED_VERSION_DOWNGRADE]":               false,
+	} {
+		if got := isIncompatibleUpdate(output); got != want {
+			t.Errorf("isIncompatibleUpdate(%q) = %v", output, got)
+		}
+	}
+}
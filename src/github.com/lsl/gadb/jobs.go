@@ -0,0 +1,78 @@
+package gadb
+
+import (
+	"fmt"
+	"time"
+)
+
+// backgroundTask is work that keeps running while the REPL takes
+// other commands
+type backgroundTask interface {
+	// Status describes the task's progress for the "jobs" command
+	Status() string
+	// Stop ends the task and releases what it holds
+	Stop() error
+}
+
+// job is a running background task
+type job struct {
+	id      int
+	name    string
+	started time.Time
+	task    backgroundTask
+}
+
+// startJob registers a running background task
+// Only one job of each name may run at a time
+func (c *Context) startJob(name string, task backgroundTask) (*job, error) {
+	if c.findJob(name) != nil {
+		return nil, fmt.Errorf("%s is already running", name)
+	}
+	c.nextJobID++
+	j := &job{id: c.nextJobID, name: name, started: time.Now(), task: task}
+	c.jobs = append(c.jobs, j)
+	return j, nil
+}
+
+// findJob returns the running job with the given name, or nil
+func (c *Context) findJob(name string) *job {
+	for _, j := range c.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// stopJob stops a job by name and removes it from the list
+func (c *Context) stopJob(name string) error {
+	for i, j := range c.jobs {
+		if j.name == name {
+			c.jobs = append(c.jobs[:i], c.jobs[i+1:]...)
+			return j.task.Stop()
+		}
+	}
+	return fmt.Errorf("%s is not running", name)
+}
+
+// stopJobs stops every running job, as when the REPL exits
+func (c *Context) stopJobs() {
+	for len(c.jobs) > 0 {
+		name := c.jobs[0].name
+		if err := c.stopJob(name); err != nil {
+			fmt.Fprintf(commandStdout(), "Warning: %s: %v\n", name, err)
+		}
+	}
+}
+
+// runJobsCommand handles the REPL "jobs" command: list background jobs
+func runJobsCommand(ctx *Context) error {
+	if len(ctx.jobs) == 0 {
+		fmt.Fprintln(commandStdout(), "No background jobs")
+		return nil
+	}
+	for _, j := range ctx.jobs {
+		fmt.Fprintf(commandStdout(), "[%d] %-8s running for %s  %s\n", j.id, j.name, time.Since(j.started).Round(time.Second), j.task.Status())
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package logcat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binary logcat (-B) is a stream of logger entries, each a header
+// followed by its payload. The header grew over Android releases:
+//
+//	v1: len, pad(0), pid, tid, sec, nsec                  20 bytes
+//	v2: len, hdr_size, pid, tid, sec, nsec, euid          24 bytes
+//	v3: len, hdr_size, pid, tid, sec, nsec, lid           24 bytes
+//	v4: len, hdr_size, pid, tid, sec, nsec, lid, uid      28 bytes
+//
+// len and hdr_size are 16 bits, the rest 32, all little endian.
+// Text buffers carry a priority byte, a NUL-terminated tag and a
+// NUL-terminated message; the events buffers carry a 32-bit tag
+// number followed by one typed value.
+const (
+	headerV1Size = 20
+	headerV2Size = 24
+	headerV4Size = 28
+	// maxHeaderSize bounds hdr_size so garbage is not read as a header
+	maxHeaderSize = 100
+	// maxPayload is the largest payload any logd writes
+	maxPayload = 5 * 1024
+)
+
+// bufferNames are the log ids of v3 and later headers
+var bufferNames = []string{"main", "radio", "events", "system", "crash", "stats", "security", "kernel"}
+
+// binaryBuffers are log ids whose payload is an event, not text
+var binaryBuffers = map[uint32]bool{2: true, 5: true, 6: true}
+
+// event value types
+const (
+	eventInt    = 0
+	eventLong   = 1
+	eventString = 2
+	eventList   = 3
+	eventFloat  = 4
+)
+
+// header is a decoded logger entry header
+type header struct {
+	payloadLen int
+	size       int
+	pid, tid   int
+	sec, nsec  uint32
+	// lid is the log id, or -1 when the header does not carry one
+	lid int
+	uid string
+}
+
+// parseHeader decodes the header at the start of b, which holds at
+// least headerV1Size bytes; ok is false when b cannot be a header
+func parseHeader(b []byte) (h header, ok bool) {
+	h.payloadLen = int(binary.LittleEndian.Uint16(b[0:]))
+	h.size = int(binary.LittleEndian.Uint16(b[2:]))
+	if h.size == 0 {
+		h.size = headerV1Size
+	}
+	if h.size < headerV1Size || h.size > maxHeaderSize || h.payloadLen > maxPayload {
+		return h, false
+	}
+	h.pid = int(int32(binary.LittleEndian.Uint32(b[4:])))
+	h.tid = int(int32(binary.LittleEndian.Uint32(b[8:])))
+	h.sec = binary.LittleEndian.Uint32(b[12:])
+	h.nsec = binary.LittleEndian.Uint32(b[16:])
+	if h.nsec >= 1e9 {
+		return h, false
+	}
+	h.lid = -1
+	if len(b) >= headerV2Size && h.size >= headerV2Size {
+		// v2 stores the euid where v3 stores the log id; log ids are
+		// small, so larger values are taken as a v2 euid
+		if v := binary.LittleEndian.Uint32(b[20:]); v < uint32(len(bufferNames)) {
+			h.lid = int(v)
+		} else if h.size < headerV4Size {
+			h.uid = strconv.FormatUint(uint64(v), 10)
+		}
+	}
+	if len(b) >= headerV4Size && h.size >= headerV4Size {
+		h.uid = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[24:])), 10)
+	}
+	return h, true
+}
+
+// IsBinary reports whether data starts like binary logcat output
+// rather than text
+func IsBinary(data []byte) bool {
+	if len(data) < headerV1Size {
+		return false
+	}
+	h, ok := parseHeader(data)
+	return ok && h.payloadLen > 0
+}
+
+// BinaryScanner reads entries from binary logcat output
+// Messages spanning several lines become one entry per line, as in
+// text output, and each buffer's first entry is preceded by a divider
+type BinaryScanner struct {
+	// Location is the time zone entries are shown in
+	Location *time.Location
+
+	r     *bufio.Reader
+	seen  map[int]bool
+	queue []*Entry
+	entry *Entry
+	err   error
+}
+
+// NewBinaryScanner returns a scanner reading binary logcat from r
+func NewBinaryScanner(r io.Reader) *BinaryScanner {
+	return &BinaryScanner{
+		Location: time.Local,
+		r:        bufio.NewReaderSize(r, 64*1024),
+		seen:     make(map[int]bool),
+	}
+}
+
+// Scan advances to the next entry, returning false at the end of the
+// input, on a read error or at data that is not a logger entry
+func (s *BinaryScanner) Scan() bool {
+	for len(s.queue) == 0 {
+		if s.err != nil {
+			return false
+		}
+		s.queue, s.err = s.next()
+	}
+	s.entry, s.queue = s.queue[0], s.queue[1:]
+	return true
+}
+
+// Entry returns the entry read by the last Scan
+func (s *BinaryScanner) Entry() *Entry {
+	return s.entry
+}
+
+// Err returns the first error other than io.EOF
+func (s *BinaryScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// next reads one logger entry and returns the entries it produces
+func (s *BinaryScanner) next() ([]*Entry, error) {
+	head, err := s.r.Peek(headerV1Size)
+	if err != nil {
+		if err == io.EOF && len(head) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	h, ok := parseHeader(head)
+	if !ok {
+		return nil, fmt.Errorf("not a logger entry header: % x", head)
+	}
+	buf := make([]byte, h.size+h.payloadLen)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	// Reparse with the whole header so v2-v4 fields are read
+	h, _ = parseHeader(buf[:h.size])
+
+	var entries []*Entry
+	if h.lid >= 0 && !s.seen[h.lid] {
+		s.seen[h.lid] = true
+		name := bufferNames[h.lid]
+		entries = append(entries, &Entry{Buffer: name, Raw: "--------- beginning of " + name})
+	}
+	base := Entry{
+		Time: time.Unix(int64(h.sec), int64(h.nsec)).In(s.Location),
+		UID:  h.uid,
+		PID:  h.pid,
+		TID:  h.tid,
+	}
+	payload := buf[h.size:]
+	if h.lid >= 0 && binaryBuffers[uint32(h.lid)] {
+		e := base
+		e.Level = LevelInfo
+		e.Tag, e.Message = decodeEvent(payload)
+		e.Raw = e.String()
+		return append(entries, &e), nil
+	}
+
+	level, tag, msg := decodeText(payload)
+	for _, line := range strings.Split(msg, "\n") {
+		e := base
+		e.Level, e.Tag, e.Message = level, tag, line
+		e.Raw = e.String()
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
+
+// decodeText splits a text payload into priority, tag and message
+func decodeText(p []byte) (Level, string, string) {
+	if len(p) == 0 {
+		return LevelUnknown, "", ""
+	}
+	level := priorityLevel(p[0])
+	rest := p[1:]
+	tag := rest
+	msg := []byte(nil)
+	if i := bytes.IndexByte(rest, 0); i >= 0 {
+		tag, msg = rest[:i], rest[i+1:]
+	}
+	if i := bytes.IndexByte(msg, 0); i >= 0 {
+		msg = msg[:i]
+	}
+	return level, string(tag), strings.TrimRight(string(msg), "\n")
+}
+
+// priorityLevel maps an android_LogPriority (2 verbose ... 8 silent)
+// to a Level; out of range values are clamped so the entry still
+// counts as a log record
+func priorityLevel(prio byte) Level {
+	switch {
+	case prio < 2:
+		return LevelVerbose
+	case prio > 8:
+		return LevelSilent
+	}
+	return Level(prio - 1)
+}
+
+// decodeEvent renders an events buffer payload as its tag number and
+// value, lists in brackets as logcat prints them
+func decodeEvent(p []byte) (string, string) {
+	if len(p) < 4 {
+		return "", ""
+	}
+	tag := strconv.FormatUint(uint64(binary.LittleEndian.Uint32(p)), 10)
+	value, _, ok := decodeEventValue(p[4:], 0)
+	if !ok {
+		value += "[truncated]"
+	}
+	return tag, value
+}
+
+// decodeEventValue decodes one typed value and returns the rest
+func decodeEventValue(p []byte, depth int) (string, []byte, bool) {
+	if len(p) < 1 || depth > 8 {
+		return "", p, false
+	}
+	kind, p := p[0], p[1:]
+	switch kind {
+	case eventInt:
+		if len(p) < 4 {
+			return "", p, false
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(p)))), p[4:], true
+	case eventLong:
+		if len(p) < 8 {
+			return "", p, false
+		}
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(p)), 10), p[8:], true
+	case eventFloat:
+		if len(p) < 4 {
+			return "", p, false
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(p))
+		return strconv.FormatFloat(float64(f), 'g', -1, 32), p[4:], true
+	case eventString:
+		if len(p) < 4 {
+			return "", p, false
+		}
+		n := int(binary.LittleEndian.Uint32(p))
+		p = p[4:]
+		if n > len(p) {
+			return string(p), nil, false
+		}
+		return string(p[:n]), p[n:], true
+	case eventList:
+		if len(p) < 1 {
+			return "", p, false
+		}
+		count := int(p[0])
+		p = p[1:]
+		items := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			item, rest, ok := decodeEventValue(p, depth+1)
+			items = append(items, item)
+			p = rest
+			if !ok {
+				return "[" + strings.Join(items, ",") + "]", p, false
+			}
+		}
+		return "[" + strings.Join(items, ",") + "]", p, true
+	}
+	return "", p, false
+}
+
+// EntryScanner reads entries one at a time
+type EntryScanner interface {
+	Scan() bool
+	Entry() *Entry
+	Err() error
+}
+
+// NewEntryScanner returns a scanner for saved logcat output, reading
+// it as binary when it starts with a logger entry header and as text
+// otherwise
+func NewEntryScanner(r io.Reader) EntryScanner {
+	br := bufio.NewReaderSize(r, 64*1024)
+	if head, _ := br.Peek(headerV4Size); IsBinary(head) {
+		return NewBinaryScanner(br)
+	}
+	return NewScanner(br)
+}
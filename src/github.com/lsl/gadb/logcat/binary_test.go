@@ -0,0 +1,77 @@
+package logcat
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func scanBinaryFile(t *testing.T, name string) []*Entry {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := NewEntryScanner(f)
+	b, ok := s.(*BinaryScanner)
+	if !ok {
+		t.Fatalf("%s was not detected as binary", name)
+	}
+	b.Location = time.UTC
+	var entries []*Entry
+	for s.Scan() {
+		entries = append(entries, s.Entry())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestBinaryMatchesText(t *testing.T) {
+	got := scanBinaryFile(t, "testdata/binary_v4.bin")
+	want := scanFile(t, "testdata/binary_v4.txt")
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	f := NewFormatter(false)
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Time.Equal(w.Time) || g.UID != w.UID || g.PID != w.PID || g.TID != w.TID ||
+			g.Level != w.Level || g.Tag != w.Tag || g.Message != w.Message || g.Buffer != w.Buffer {
+			t.Errorf("entry %d = %+v, want %+v", i, g, w)
+		}
+		if f.Format(g) != f.Format(w) {
+			t.Errorf("entry %d formats as %q, want %q", i, f.Format(g), f.Format(w))
+		}
+	}
+}
+
+func TestBinaryOlderHeaders(t *testing.T) {
+	got := scanBinaryFile(t, "testdata/binary_old.bin")
+	// v1 and v2 carry no log id, so the only divider comes from v3
+	if len(got) != 4 {
+		t.Fatalf("got %d entries, want 4", len(got))
+	}
+	if got[0].Level != LevelWarn || got[0].Tag != "ActivityManager" || got[0].UID != "" {
+		t.Errorf("v1 entry = %+v", got[0])
+	}
+	if got[1].UID != "10123" || got[1].TID != 4330 || got[1].Message != "uid=10123 identical 3 lines" {
+		t.Errorf("v2 entry = %+v", got[1])
+	}
+	if got[2].Buffer != "system" || got[3].Tag != "Zygote" || got[3].Level != LevelDebug {
+		t.Errorf("v3 entries = %+v, %+v", got[2], got[3])
+	}
+}
+
+func TestIsBinaryRejectsText(t *testing.T) {
+	data, err := os.ReadFile("testdata/threadtime.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsBinary(data) {
+		t.Error("threadtime text detected as binary")
+	}
+}
@@ -0,0 +1,224 @@
+package logcat
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CrashKind tells Java crashes, ANRs and native crashes apart
+type CrashKind int
+
+const (
+	CrashJava CrashKind = iota
+	CrashANR
+	CrashNative
+)
+
+// String returns a short name used in reports and file names
+func (k CrashKind) String() string {
+	switch k {
+	case CrashANR:
+		return "anr"
+	case CrashNative:
+		return "native"
+	}
+	return "crash"
+}
+
+// Crash is a crash report extracted from the log
+type Crash struct {
+	Kind CrashKind
+	// Package is the crashed app's package or process name, if logged
+	Package string
+	// PID is the crashed process, 0 when not logged
+	PID  int
+	Time time.Time
+	// Summary is the exception, ANR reason or signal line
+	Summary string
+	// Entries are the lines of the report, stack trace included
+	Entries []*Entry
+}
+
+// Text returns the report as logcat lines
+func (c *Crash) Text() string {
+	var b strings.Builder
+	for _, e := range c.Entries {
+		b.WriteString(e.Raw)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// crashQuiet is how long after its last line a report is considered
+// complete; other processes' lines may interleave in the meantime
+const crashQuiet = time.Second
+
+// maxCrashLines bounds a single report
+const maxCrashLines = 2000
+
+var (
+	// "Process: com.example.app, PID: 4321"
+	javaProcessRe = regexp.MustCompile(`^Process: ([^,\s]+), PID: (\d+)`)
+	// "ANR in com.example.app (com.example.app/.MainActivity)"
+	anrInRe = regexp.MustCompile(`^ANR in ([^\s(]+)`)
+	// "PID: 4321" in an ANR report
+	anrPidRe = regexp.MustCompile(`^PID: (\d+)`)
+	// "pid: 4321, tid: 4340, name: RenderThread  >>> com.example.app <<<"
+	nativePidRe = regexp.MustCompile(`^pid: (\d+), tid: \d+, name: .*>>> (\S+) <<<`)
+	// "signal 11 (SIGSEGV), code 1 (SEGV_MAPERR), fault addr 0x0"
+	nativeSignalRe = regexp.MustCompile(`^signal \d+ \(`)
+)
+
+// openCrash is a report still collecting lines
+type openCrash struct {
+	crash    *Crash
+	pid, tid int
+	tag      string
+	last     time.Time
+}
+
+// CrashDetector finds crash reports in a stream of entries:
+// "FATAL EXCEPTION" blocks from AndroidRuntime, "ANR in" reports from
+// ActivityManager and "*** *** ***" native crash dumps from DEBUG
+// A report collects the lines that follow from the same process,
+// thread and tag, and ends at a line from that thread with another
+// tag, when the log moves on by more than a second, or at Flush
+type CrashDetector struct {
+	open []*openCrash
+}
+
+// NewCrashDetector returns an empty detector
+func NewCrashDetector() *CrashDetector {
+	return &CrashDetector{}
+}
+
+// Feed adds an entry and returns any reports it completes
+func (d *CrashDetector) Feed(e *Entry) []*Crash {
+	if !e.IsLog() {
+		return nil
+	}
+	var done []*Crash
+	kept := d.open[:0]
+	for _, o := range d.open {
+		sameThread := e.PID == o.pid && e.TID == o.tid
+		switch {
+		case sameThread && e.Tag == o.tag && !e.Continuation && startsCrash(e):
+			// A new report from the same thread ends this one
+			done = append(done, o.finish())
+		case sameThread && e.Tag == o.tag:
+			o.crash.Entries = append(o.crash.Entries, e)
+			o.last = e.Time
+			o.parse(e)
+			if len(o.crash.Entries) >= maxCrashLines {
+				done = append(done, o.finish())
+				continue
+			}
+			kept = append(kept, o)
+		case sameThread || e.Time.Sub(o.last) > crashQuiet:
+			done = append(done, o.finish())
+		default:
+			kept = append(kept, o)
+		}
+	}
+	d.open = kept
+
+	if !e.Continuation && startsCrash(e) {
+		d.start(e)
+	}
+	return done
+}
+
+// Flush completes every open report, as at the end of a stream or
+// when it has been quiet for a while
+func (d *CrashDetector) Flush() []*Crash {
+	var done []*Crash
+	for _, o := range d.open {
+		done = append(done, o.finish())
+	}
+	d.open = nil
+	return done
+}
+
+// Pending reports whether a report is still collecting lines
+func (d *CrashDetector) Pending() bool {
+	return len(d.open) > 0
+}
+
+// startsCrash reports whether an entry is the first line of a report
+func startsCrash(e *Entry) bool {
+	_, ok := crashKindOf(e)
+	return ok
+}
+
+// crashKindOf returns the kind of report an entry starts
+func crashKindOf(e *Entry) (CrashKind, bool) {
+	switch {
+	case e.Tag == "AndroidRuntime" && strings.HasPrefix(e.Message, "FATAL EXCEPTION"):
+		return CrashJava, true
+	case e.Level >= LevelError && strings.HasPrefix(e.Message, "ANR in "):
+		return CrashANR, true
+	case strings.HasPrefix(e.Message, "*** *** ***"):
+		return CrashNative, true
+	}
+	return 0, false
+}
+
+// start opens a report at its first line
+func (d *CrashDetector) start(e *Entry) {
+	kind, _ := crashKindOf(e)
+	o := &openCrash{
+		crash: &Crash{Kind: kind, Time: e.Time, Entries: []*Entry{e}},
+		pid:   e.PID,
+		tid:   e.TID,
+		tag:   e.Tag,
+		last:  e.Time,
+	}
+	o.parse(e)
+	d.open = append(d.open, o)
+}
+
+// parse picks the package, pid and summary out of a report line
+func (o *openCrash) parse(e *Entry) {
+	c := o.crash
+	msg := strings.TrimSpace(e.Message)
+	switch c.Kind {
+	case CrashJava:
+		if m := javaProcessRe.FindStringSubmatch(msg); m != nil {
+			c.Package = m[1]
+			c.PID, _ = strconv.Atoi(m[2])
+		} else if c.Summary == "" && len(c.Entries) > 1 && !strings.HasPrefix(msg, "at ") {
+			c.Summary = msg
+		}
+		if c.PID == 0 {
+			c.PID = e.PID
+		}
+	case CrashANR:
+		if m := anrInRe.FindStringSubmatch(msg); m != nil {
+			c.Package = m[1]
+		} else if m := anrPidRe.FindStringSubmatch(msg); m != nil {
+			c.PID, _ = strconv.Atoi(m[1])
+		} else if strings.HasPrefix(msg, "Reason: ") && c.Summary == "" {
+			c.Summary = strings.TrimPrefix(msg, "Reason: ")
+		}
+	case CrashNative:
+		if m := nativePidRe.FindStringSubmatch(msg); m != nil {
+			c.PID, _ = strconv.Atoi(m[1])
+			c.Package = m[2]
+		} else if nativeSignalRe.MatchString(msg) && c.Summary == "" {
+			c.Summary = msg
+		} else if strings.HasPrefix(msg, "Abort message: ") {
+			c.Summary = msg
+		}
+	}
+}
+
+// finish returns the completed report
+func (o *openCrash) finish() *Crash {
+	c := o.crash
+	if c.Summary == "" && c.Kind == CrashJava {
+		c.Summary = strings.TrimSpace(c.Entries[0].Message)
+	}
+	return c
+}
@@ -0,0 +1,36 @@
+package logcat
+
+import (
+	"testing"
+)
+
+func TestCrashDetector(t *testing.T) {
+	d := NewCrashDetector()
+	var crashes []*Crash
+	for _, e := range scanFile(t, "testdata/crashes.txt") {
+		crashes = append(crashes, d.Feed(e)...)
+	}
+	crashes = append(crashes, d.Flush()...)
+
+	if len(crashes) != 3 {
+		t.Fatalf("got %d crashes, want 3", len(crashes))
+	}
+	tests := []struct {
+		kind    CrashKind
+		pkg     string
+		pid     int
+		summary string
+		lines   int
+	}{
+		{CrashJava, "com.example.app", 4321, "java.lang.NullPointerException: Attempt to invoke a virtual method on a null object reference", 5},
+		{CrashANR, "com.example.other", 5555, "Input dispatching timed out (Waiting to send non-key event)", 4},
+		{CrashNative, "com.example.native", 7777, "signal 11 (SIGSEGV), code 1 (SEGV_MAPERR), fault addr 0x0", 6},
+	}
+	for i, tt := range tests {
+		c := crashes[i]
+		if c.Kind != tt.kind || c.Package != tt.pkg || c.PID != tt.pid || c.Summary != tt.summary || len(c.Entries) != tt.lines {
+			t.Errorf("crash %d = %v %q %d %q (%d lines), want %v %q %d %q (%d lines)",
+				i, c.Kind, c.Package, c.PID, c.Summary, len(c.Entries), tt.kind, tt.pkg, tt.pid, tt.summary, tt.lines)
+		}
+	}
+}
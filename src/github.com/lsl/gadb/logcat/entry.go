@@ -0,0 +1,104 @@
+package logcat
+
+import (
+	"fmt"
+	"time"
+)
+
+// Level is a log priority
+type Level int
+
+const (
+	LevelUnknown Level = iota
+	LevelVerbose
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+	LevelSilent
+)
+
+// levelLetters maps priority letters used by logcat to levels
+var levelLetters = map[byte]Level{
+	'V': LevelVerbose,
+	'D': LevelDebug,
+	'I': LevelInfo,
+	'W': LevelWarn,
+	'E': LevelError,
+	'F': LevelFatal,
+	'A': LevelFatal, // assert
+	'S': LevelSilent,
+}
+
+// ParseLevel parses a priority letter such as 'W'
+func ParseLevel(c byte) (Level, bool) {
+	l, ok := levelLetters[c]
+	return l, ok
+}
+
+// Letter returns the single-letter form used by logcat
+func (l Level) Letter() string {
+	if l < LevelVerbose || l > LevelSilent {
+		return "?"
+	}
+	return string("VDIWEFS"[l-LevelVerbose])
+}
+
+// String returns the level name
+func (l Level) String() string {
+	switch l {
+	case LevelVerbose:
+		return "verbose"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	case LevelSilent:
+		return "silent"
+	}
+	return "unknown"
+}
+
+// Entry is one parsed log record
+type Entry struct {
+	// Time is when the message was logged; formats without a year get
+	// the parser's year
+	Time time.Time
+	// UID is the user id or name when logcat printed one (-v uid)
+	UID   string
+	PID   int
+	TID   int
+	Level Level
+	Tag   string
+	// Message is the log text; long format entries may span several lines
+	Message string
+	// Continuation marks a line without a header of its own, carried
+	// over from the entry before it
+	Continuation bool
+	// Buffer is set for "--------- beginning of <buffer>" lines
+	Buffer string
+	// Raw is the line (or lines) the entry was parsed from
+	Raw string
+}
+
+// IsLog reports whether the entry is a log record, as opposed to a
+// buffer divider or a line logcat did not format
+func (e *Entry) IsLog() bool {
+	return e.Level != LevelUnknown
+}
+
+// String renders the entry in threadtime format
+func (e *Entry) String() string {
+	if !e.IsLog() {
+		return e.Raw
+	}
+	return fmt.Sprintf("%s %5d %5d %s %-8s: %s",
+		e.Time.Format("01-02 15:04:05.000"), e.PID, e.TID, e.Level.Letter(), e.Tag, e.Message)
+}
@@ -0,0 +1,272 @@
+package logcat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ExportFormats are the structured formats entries can be written in
+var ExportFormats = []string{"ndjson", "csv", "html"}
+
+// IsExportFormat reports whether name is one of ExportFormats
+func IsExportFormat(name string) bool {
+	for _, f := range ExportFormats {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Exporter writes log records in a structured format for other tools
+// Dividers set the buffer of the records that follow them; other lines
+// that are not log records are left out
+type Exporter interface {
+	// Write adds an entry; source names the device or file it came
+	// from and may be empty
+	Write(source string, e *Entry) error
+	// Close finishes the output; it does not close the writer
+	Close() error
+}
+
+// NewExporter returns an exporter writing format to w
+func NewExporter(format string, w io.Writer) (Exporter, error) {
+	switch format {
+	case "ndjson":
+		return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvExporter{w: csv.NewWriter(w)}, nil
+	case "html":
+		return &htmlExporter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q (want ndjson, csv or html)", format)
+}
+
+// record is the exported form of an entry
+type record struct {
+	Time    string `json:"time"`
+	Source  string `json:"source,omitempty"`
+	Buffer  string `json:"buffer,omitempty"`
+	UID     string `json:"uid,omitempty"`
+	PID     int    `json:"pid"`
+	TID     int    `json:"tid"`
+	Level   string `json:"level"`
+	Tag     string `json:"tag"`
+	Message string `json:"message"`
+}
+
+// buffers tracks the buffer each source is in from its dividers
+type buffers map[string]string
+
+// record converts an entry, reporting false for lines that are not
+// log records
+func (b buffers) record(source string, e *Entry) (*record, bool) {
+	if e.Buffer != "" {
+		b[source] = e.Buffer
+	}
+	if !e.IsLog() {
+		return nil, false
+	}
+	return &record{
+		Time:    e.Time.Format(time.RFC3339Nano),
+		Source:  source,
+		Buffer:  b[source],
+		UID:     e.UID,
+		PID:     e.PID,
+		TID:     e.TID,
+		Level:   string(e.Level.Letter()),
+		Tag:     e.Tag,
+		Message: e.Message,
+	}, true
+}
+
+// ndjsonExporter writes one JSON object per line
+type ndjsonExporter struct {
+	enc     *json.Encoder
+	buffers buffers
+}
+
+func (x *ndjsonExporter) Write(source string, e *Entry) error {
+	if x.buffers == nil {
+		x.buffers = make(buffers)
+	}
+	r, ok := x.buffers.record(source, e)
+	if !ok {
+		return nil
+	}
+	return x.enc.Encode(r)
+}
+
+func (x *ndjsonExporter) Close() error {
+	return nil
+}
+
+// csvExporter writes a header row and one row per record
+type csvExporter struct {
+	w       *csv.Writer
+	buffers buffers
+	started bool
+}
+
+func (x *csvExporter) Write(source string, e *Entry) error {
+	if x.buffers == nil {
+		x.buffers = make(buffers)
+	}
+	if !x.started {
+		x.started = true
+		if err := x.w.Write([]string{"time", "source", "buffer", "uid", "pid", "tid", "level", "tag", "message"}); err != nil {
+			return err
+		}
+	}
+	r, ok := x.buffers.record(source, e)
+	if !ok {
+		return nil
+	}
+	return x.w.Write([]string{r.Time, r.Source, r.Buffer, r.UID,
+		strconv.Itoa(r.PID), strconv.Itoa(r.TID), r.Level, r.Tag, r.Message})
+}
+
+func (x *csvExporter) Close() error {
+	x.w.Flush()
+	return x.w.Error()
+}
+
+// htmlExporter writes a single page with the records embedded as JSON
+// and a small script to filter them, so the file opens anywhere
+// without network access
+type htmlExporter struct {
+	w       io.Writer
+	buffers buffers
+	count   int
+	err     error
+}
+
+func (x *htmlExporter) Write(source string, e *Entry) error {
+	if x.buffers == nil {
+		x.buffers = make(buffers)
+	}
+	r, ok := x.buffers.record(source, e)
+	if !ok || x.err != nil {
+		return x.err
+	}
+	// json.Marshal escapes '<', '>' and '&', so messages cannot close
+	// the script element
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if x.count == 0 {
+		sep = htmlHead
+	}
+	x.count++
+	_, x.err = io.WriteString(x.w, sep+string(data))
+	return x.err
+}
+
+func (x *htmlExporter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.count == 0 {
+		if _, err := io.WriteString(x.w, htmlHead); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(x.w, htmlTail)
+	return err
+}
+
+// htmlHead starts the report page, up to the opening of the records array
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>logcat</title>
+<style>
+body { margin: 0; font: 12px/1.4 ui-monospace, Menlo, Consolas, monospace; background: #fff; color: #222; }
+#bar { position: sticky; top: 0; display: flex; gap: 8px; align-items: center; padding: 8px; background: #f3f3f3; border-bottom: 1px solid #ccc; }
+#bar input { font: inherit; padding: 2px 4px; }
+#count { margin-left: auto; color: #666; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: 1px 6px; vertical-align: top; white-space: pre-wrap; word-break: break-word; }
+td.n { text-align: right; color: #666; }
+td.src, td.time { white-space: nowrap; color: #666; }
+td.tag { white-space: nowrap; font-weight: bold; }
+tr.V td.msg { color: #888; }
+tr.D td.msg { color: #2a6ebb; }
+tr.I td.msg { color: #2e7d32; }
+tr.W td.msg { color: #b26a00; }
+tr.E td.msg, tr.F td.msg, tr.A td.msg { color: #c62828; }
+td.lvl { font-weight: bold; text-align: center; }
+</style>
+</head>
+<body>
+<div id="bar">
+<label>Level <select id="level">
+<option value="V">Verbose</option><option value="D">Debug</option><option value="I">Info</option>
+<option value="W">Warn</option><option value="E">Error</option><option value="F">Fatal</option>
+</select></label>
+<label>Tag <input id="tag" placeholder="tag"></label>
+<label>PID <input id="pid" size="8" placeholder="pid"></label>
+<label>Text <input id="text" placeholder="message"></label>
+<span id="count"></span>
+</div>
+<table><tbody id="rows"></tbody></table>
+<script>
+const records = [
+`
+
+// htmlTail closes the records array and adds the filter script
+const htmlTail = `
+];
+const levels = "VDIWEFA";
+const rows = document.getElementById("rows");
+const multiSource = records.some(r => r.source && r.source !== records[0].source);
+function cell(tr, cls, text) {
+  const td = document.createElement("td");
+  td.className = cls;
+  td.textContent = text;
+  tr.appendChild(td);
+}
+const trs = records.map(r => {
+  const tr = document.createElement("tr");
+  tr.className = r.level;
+  if (multiSource) cell(tr, "src", r.source);
+  cell(tr, "time", r.time.replace("T", " ").replace(/([.]\d{3})\d*/, "$1").replace(/(Z|[+-]\d\d:\d\d)$/, ""));
+  cell(tr, "n", r.pid);
+  cell(tr, "n", r.tid);
+  cell(tr, "lvl", r.level);
+  cell(tr, "tag", r.tag);
+  cell(tr, "msg", r.message);
+  rows.appendChild(tr);
+  return tr;
+});
+function apply() {
+  const min = levels.indexOf(document.getElementById("level").value);
+  const tag = document.getElementById("tag").value.toLowerCase();
+  const pid = document.getElementById("pid").value.trim();
+  const text = document.getElementById("text").value.toLowerCase();
+  let shown = 0;
+  records.forEach((r, i) => {
+    const ok = levels.indexOf(r.level) >= min &&
+      (!tag || r.tag.toLowerCase().includes(tag)) &&
+      (!pid || String(r.pid) === pid) &&
+      (!text || r.message.toLowerCase().includes(text));
+    trs[i].style.display = ok ? "" : "none";
+    if (ok) shown++;
+  });
+  document.getElementById("count").textContent = shown + " / " + records.length + " lines";
+}
+for (const id of ["level", "tag", "pid", "text"]) {
+  document.getElementById(id).addEventListener("input", apply);
+}
+apply();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,81 @@
+package logcat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func exportFile(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	x, err := NewExporter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range scanFile(t, "testdata/threadtime.txt") {
+		if err := x.Write("emulator-5554", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestExportNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(exportFile(t, "ndjson")), "\n")
+	var first, last record
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatal(err)
+	}
+	want := record{
+		Time: "2024-01-15T10:23:45.123Z", Source: "emulator-5554", Buffer: "main",
+		PID: 1234, TID: 1250, Level: "I", Tag: "ActivityManager",
+		Message: "Start proc 4321:com.example.app/u0a123 for activity {com.example.app/com.example.app.MainActivity}",
+	}
+	if first != want {
+		t.Errorf("first record = %+v, want %+v", first, want)
+	}
+	if last.Buffer != "crash" {
+		t.Errorf("last record buffer = %q, want crash", last.Buffer)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(exportFile(t, "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rows[0], ","); got != "time,source,buffer,uid,pid,tid,level,tag,message" {
+		t.Errorf("header = %s", got)
+	}
+	if rows[2][7] != "OkHttp" || rows[2][8] != "--> GET https://example.com/api" {
+		t.Errorf("row 2 = %v", rows[2])
+	}
+}
+
+func TestExportHTMLIsSelfContained(t *testing.T) {
+	var buf bytes.Buffer
+	x, _ := NewExporter("html", &buf)
+	e := &Entry{Level: LevelInfo, Tag: "Web", Message: "</script><b>x</b>"}
+	if err := x.Write("", e); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Count(out, "</script>") != 1 {
+		t.Errorf("message was not escaped inside the script element")
+	}
+	if strings.Contains(out, "http://") || strings.Contains(out, "https://") || strings.Contains(out, "src=") {
+		t.Errorf("report refers to external resources")
+	}
+}
@@ -0,0 +1,132 @@
+package logcat
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ANSI escape sequences used by the formatter
+const (
+	ansiReset = "\033[0m"
+	ansiDim   = "\033[2m"
+	ansiBold  = "\033[1m"
+)
+
+// levelBadges colors the level letter by priority
+var levelBadges = map[Level]string{
+	LevelVerbose: "\033[30;47m",
+	LevelDebug:   "\033[30;44m",
+	LevelInfo:    "\033[30;42m",
+	LevelWarn:    "\033[30;43m",
+	LevelError:   "\033[30;41m",
+	LevelFatal:   "\033[1;37;41m",
+}
+
+// levelMessages colors message text for the louder priorities
+var levelMessages = map[Level]string{
+	LevelVerbose: ansiDim,
+	LevelWarn:    "\033[33m",
+	LevelError:   "\033[31m",
+	LevelFatal:   "\033[1;31m",
+}
+
+// tagColors is the palette tags are assigned from, so the same tag
+// keeps its color across lines and sessions
+var tagColors = []string{
+	"\033[36m", "\033[32m", "\033[35m", "\033[34m", "\033[33m",
+	"\033[96m", "\033[92m", "\033[95m", "\033[94m", "\033[93m",
+}
+
+// DefaultTagWidth is the tag column width
+const DefaultTagWidth = 23
+
+// Formatter renders entries as aligned, optionally colored lines
+type Formatter struct {
+	// Color enables ANSI colors
+	Color bool
+	// TagWidth is the tag column width; longer tags are shortened
+	TagWidth int
+	// Rules highlight matching messages in their color
+	Rules Rules
+}
+
+// NewFormatter returns a formatter with the default tag width
+func NewFormatter(color bool) *Formatter {
+	return &Formatter{Color: color, TagWidth: DefaultTagWidth}
+}
+
+// Format renders an entry without a trailing newline
+// Multi-line messages are indented to the message column
+func (f *Formatter) Format(e *Entry) string {
+	if !e.IsLog() {
+		if e.Buffer != "" {
+			return f.paint(ansiDim, e.Raw)
+		}
+		return e.Raw
+	}
+
+	stamp := fmt.Sprintf("%s %5d %5d ", e.Time.Format("01-02 15:04:05.000"), e.PID, e.TID)
+	tag := f.tagColumn(e.Tag) + " "
+	// Visible width of everything before the message
+	width := len(stamp) + f.tagWidth() + 1 + 4
+
+	var header string
+	switch {
+	case e.Continuation:
+		header = strings.Repeat(" ", width-4)
+	case f.Color:
+		header = f.paint(ansiDim, stamp) + f.paint(tagColor(e.Tag), tag)
+	default:
+		header = stamp + tag
+	}
+
+	badge := " " + e.Level.Letter() + " "
+	if f.Color {
+		badge = levelBadges[e.Level] + badge + ansiReset
+	}
+
+	color := levelMessages[e.Level]
+	if name := f.Rules.Highlight(e); name != "" {
+		color = ansiBold + Colors[name]
+	}
+	lines := strings.Split(e.Message, "\n")
+	for i, line := range lines {
+		lines[i] = f.paint(color, line)
+	}
+	return header + badge + " " + strings.Join(lines, "\n"+strings.Repeat(" ", width))
+}
+
+// tagWidth returns the tag column width
+func (f *Formatter) tagWidth() int {
+	if f.TagWidth <= 0 {
+		return DefaultTagWidth
+	}
+	return f.TagWidth
+}
+
+// tagColumn pads or shortens a tag to the column width, keeping the
+// end of long tags
+func (f *Formatter) tagColumn(tag string) string {
+	width := f.tagWidth()
+	r := []rune(tag)
+	if len(r) > width {
+		return "…" + string(r[len(r)-width+1:])
+	}
+	return tag + strings.Repeat(" ", width-len(r))
+}
+
+// paint wraps s in a color when colors are enabled
+func (f *Formatter) paint(color, s string) string {
+	if !f.Color || color == "" || s == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// tagColor picks a stable color for a tag
+func tagColor(tag string) string {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	return tagColors[h.Sum32()%uint32(len(tagColors))]
+}
@@ -0,0 +1,151 @@
+package logcat
+
+import (
+	"time"
+)
+
+// DefaultMergeWindow is how long Merge holds an entry back waiting for
+// earlier entries from other sources
+const DefaultMergeWindow = 500 * time.Millisecond
+
+// maxMergeBuffered bounds the entries Merge holds at once
+const maxMergeBuffered = 50000
+
+// Merged is an entry tagged with the index of the source it came from
+type Merged struct {
+	Source int
+	Entry  *Entry
+}
+
+// pendingEntry is an entry waiting in a source's queue
+type pendingEntry struct {
+	entry   *Entry
+	at      time.Time // timestamp used for ordering
+	arrived time.Time
+}
+
+// Merge interleaves entries from several sources by timestamp
+//
+// Each source is assumed to be in order already and is never
+// reordered internally. An entry is released once every open source
+// has a later entry queued, which gives an exact merge for finite
+// inputs such as saved files. For live streams a quiet source would
+// hold everything back, so an entry is also released once it has
+// waited window, bounding the reorder delay.
+//
+// Entries without a timestamp (dividers, adb messages) take the time
+// of the entry before them in their source.
+// The output channel is closed when every source is closed, or when
+// done is closed, which stops Merge without draining the sources.
+func Merge(sources []<-chan *Entry, window time.Duration, done <-chan struct{}) <-chan Merged {
+	type incoming struct {
+		source int
+		entry  *Entry
+		closed bool
+	}
+	in := make(chan incoming)
+	for i, ch := range sources {
+		go func(i int, ch <-chan *Entry) {
+			for {
+				msg := incoming{source: i}
+				select {
+				case e, ok := <-ch:
+					msg.entry, msg.closed = e, !ok
+				case <-done:
+					return
+				}
+				select {
+				case in <- msg:
+				case <-done:
+					return
+				}
+				if msg.closed {
+					return
+				}
+			}
+		}(i, ch)
+	}
+
+	out := make(chan Merged, 64)
+	go func() {
+		defer close(out)
+		queues := make([][]pendingEntry, len(sources))
+		lastTime := make([]time.Time, len(sources))
+		open := len(sources)
+		closed := make([]bool, len(sources))
+		buffered := 0
+
+		tick := window / 4
+		if tick <= 0 {
+			tick = 10 * time.Millisecond
+		}
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		// release sends every entry that may go out now, reporting
+		// false when done was closed
+		release := func(now time.Time) bool {
+			for {
+				best := -1
+				waiting := false
+				for i, q := range queues {
+					if len(q) == 0 {
+						if !closed[i] {
+							waiting = true
+						}
+						continue
+					}
+					if best < 0 || q[0].at.Before(queues[best][0].at) {
+						best = i
+					}
+				}
+				if best < 0 {
+					return true
+				}
+				head := queues[best][0]
+				if waiting && now.Sub(head.arrived) < window && buffered < maxMergeBuffered {
+					return true
+				}
+				queues[best] = queues[best][1:]
+				buffered--
+				select {
+				case out <- Merged{Source: best, Entry: head.entry}:
+				case <-done:
+					return false
+				}
+			}
+		}
+
+		for open > 0 {
+			select {
+			case msg := <-in:
+				if msg.closed {
+					closed[msg.source] = true
+					open--
+				} else {
+					at := msg.entry.Time
+					if at.IsZero() {
+						at = lastTime[msg.source]
+					} else {
+						lastTime[msg.source] = at
+					}
+					queues[msg.source] = append(queues[msg.source], pendingEntry{
+						entry: msg.entry, at: at, arrived: time.Now(),
+					})
+					buffered++
+				}
+				if !release(time.Now()) {
+					return
+				}
+			case now := <-ticker.C:
+				if !release(now) {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+		release(time.Now())
+	}()
+	return out
+}
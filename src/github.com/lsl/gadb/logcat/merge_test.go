@@ -0,0 +1,92 @@
+package logcat
+
+import (
+	"testing"
+	"time"
+)
+
+// entriesAt builds entries logged at the given offsets in seconds
+func entriesAt(tag string, offsets ...float64) []*Entry {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var entries []*Entry
+	for _, o := range offsets {
+		entries = append(entries, &Entry{Time: base.Add(time.Duration(o * float64(time.Second))), Level: LevelInfo, Tag: tag})
+	}
+	return entries
+}
+
+// feed sends entries on a new channel, closing it at the end
+func feed(entries []*Entry) <-chan *Entry {
+	ch := make(chan *Entry)
+	go func() {
+		defer close(ch)
+		for _, e := range entries {
+			ch <- e
+		}
+	}()
+	return ch
+}
+
+func TestMergeOrdersFiniteSources(t *testing.T) {
+	a := entriesAt("a", 1, 3, 5, 7)
+	b := entriesAt("b", 2, 4, 6)
+	divider := &Entry{Buffer: "crash", Raw: "--------- beginning of crash"}
+	b = append(b[:1], append([]*Entry{divider}, b[1:]...)...)
+
+	var got []string
+	for m := range Merge([]<-chan *Entry{feed(a), feed(b)}, time.Hour, nil) {
+		got = append(got, m.Entry.Tag)
+		if m.Entry == divider && m.Source != 1 {
+			t.Errorf("divider tagged with source %d", m.Source)
+		}
+	}
+	want := []string{"a", "b", "", "a", "b", "a", "b", "a"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMergeReleasesAfterWindow(t *testing.T) {
+	quiet := make(chan *Entry)
+	defer close(quiet)
+	busy := make(chan *Entry, 1)
+	busy <- entriesAt("busy", 1)[0]
+
+	out := Merge([]<-chan *Entry{busy, quiet}, 50*time.Millisecond, nil)
+	select {
+	case m := <-out:
+		if m.Entry.Tag != "busy" {
+			t.Errorf("got %q", m.Entry.Tag)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("entry held back by a quiet source past the window")
+	}
+	close(busy)
+}
+
+func TestMergeStopsWhenDone(t *testing.T) {
+	// Neither source closes, and the queued entry waits for the quiet one
+	quiet := make(chan *Entry)
+	held := make(chan *Entry, 1)
+	held <- entriesAt("held", 1)[0]
+	done := make(chan struct{})
+
+	out := Merge([]<-chan *Entry{quiet, held}, time.Hour, done)
+	close(done)
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-out:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("output not closed after done")
+		}
+	}
+}
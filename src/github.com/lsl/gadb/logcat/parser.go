@@ -0,0 +1,208 @@
+// Package logcat parses Android logcat output into structured entries
+// and renders them for the terminal
+package logcat
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timePattern matches the timestamp of threadtime and long headers:
+// "01-02 03:04:05.678", with -v year "2024-01-02 03:04:05.678"
+// (microseconds with -v usec), or -v epoch "1704164645.678"
+// -v monotonic prints seconds since boot in the epoch layout, so it is
+// passed through unparsed rather than read as a wall clock time
+const timePattern = `(?:(?:(\d{4})-)?(\d\d)-(\d\d) (\d\d):(\d\d):(\d\d)\.(\d+)|(\d+)\.(\d+))(?: [+-]\d{4})?`
+
+var (
+	// threadtimeRe matches "<time>  <uid>  <pid>  <tid> <level> <tag>: <message>"
+	// where the uid is only printed with -v uid
+	// The tag ends at the first ": ", as tags may contain colons, or at
+	// a colon ending the line when the message is empty
+	threadtimeRe = regexp.MustCompile(`^\s*` + timePattern + `\s+(?:(\S+)\s+)?(\d+)\s+(\d+) ([VDIWEFAS]) (.*?)\s*(?:: (.*)|:)$`)
+	// longRe matches "[ <time> <uid>:<pid>:<tid> <level>/<tag> ]"
+	longRe = regexp.MustCompile(`^\[ ` + timePattern + `\s+(?:(\S+):\s*)?(\d+):\s*(\d+) ([VDIWEFAS])/(.*?)\s*\]$`)
+	// dividerRe matches "--------- beginning of main"
+	dividerRe = regexp.MustCompile(`^-+ beginning of (\S+)`)
+)
+
+// Parser turns logcat output lines into entries
+// It accepts the threadtime and long formats, detected per line, so
+// one parser can read mixed or concatenated output
+type Parser struct {
+	// Year is used for timestamps printed without one
+	Year int
+	// Location is the time zone timestamps are interpreted in
+	Location *time.Location
+
+	// last is the most recent entry with a header
+	last *Entry
+	// pending is a long format entry still collecting message lines
+	pending *Entry
+}
+
+// NewParser returns a parser for output logged this year in local time
+func NewParser() *Parser {
+	return &Parser{Year: time.Now().Year(), Location: time.Local}
+}
+
+// Feed parses one line and returns the entries it completes
+// Threadtime lines complete immediately; long format entries complete
+// at the blank line that ends them, or at the next header
+func (p *Parser) Feed(line string) []*Entry {
+	line = strings.TrimRight(line, "\r\n")
+
+	if m := longRe.FindStringSubmatch(line); m != nil {
+		done := p.Flush()
+		p.pending = p.header(m, line)
+		p.last = p.pending
+		if done != nil {
+			return []*Entry{done}
+		}
+		return nil
+	}
+
+	if p.pending != nil {
+		if line == "" {
+			return []*Entry{p.Flush()}
+		}
+		// Raw has a newline once the first message line is in
+		if strings.Contains(p.pending.Raw, "\n") {
+			p.pending.Message += "\n"
+		}
+		p.pending.Message += line
+		p.pending.Raw += "\n" + line
+		return nil
+	}
+
+	if m := threadtimeRe.FindStringSubmatch(line); m != nil {
+		e := p.header(m, line)
+		e.Message = m[15]
+		p.last = e
+		return []*Entry{e}
+	}
+
+	if m := dividerRe.FindStringSubmatch(line); m != nil {
+		return []*Entry{{Buffer: m[1], Raw: line}}
+	}
+
+	// A line without a header continues the previous entry, as with
+	// messages containing newlines or a blank line in long format
+	if p.last != nil && line != "" {
+		e := *p.last
+		e.Message = line
+		e.Raw = line
+		e.Continuation = true
+		return []*Entry{&e}
+	}
+	return []*Entry{{Message: line, Raw: line}}
+}
+
+// Flush returns the long format entry still being collected, if any
+func (p *Parser) Flush() *Entry {
+	e := p.pending
+	p.pending = nil
+	return e
+}
+
+// header builds an entry from a threadtime or long header match
+// Both patterns share the group layout: time (9 groups), uid, pid,
+// tid, level and tag
+func (p *Parser) header(m []string, raw string) *Entry {
+	e := &Entry{Time: p.parseTime(m[1:10]), UID: m[10], Tag: m[14], Raw: raw}
+	e.PID, _ = strconv.Atoi(m[11])
+	e.TID, _ = strconv.Atoi(m[12])
+	e.Level, _ = ParseLevel(m[13][0])
+	return e
+}
+
+// parseTime converts the timestamp groups of timePattern
+func (p *Parser) parseTime(g []string) time.Time {
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	if g[7] != "" {
+		sec, _ := strconv.ParseInt(g[7], 10, 64)
+		return time.Unix(sec, fractionNanos(g[8])).In(loc)
+	}
+	year := p.Year
+	if g[0] != "" {
+		year, _ = strconv.Atoi(g[0])
+	}
+	num := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return time.Date(year, time.Month(num(g[1])), num(g[2]),
+		num(g[3]), num(g[4]), num(g[5]), int(fractionNanos(g[6])), loc)
+}
+
+// fractionNanos converts the digits after a decimal point to nanoseconds
+func fractionNanos(digits string) int64 {
+	if len(digits) > 9 {
+		digits = digits[:9]
+	}
+	digits += strings.Repeat("0", 9-len(digits))
+	n, _ := strconv.ParseInt(digits, 10, 64)
+	return n
+}
+
+// Scanner reads entries from a stream of logcat output
+type Scanner struct {
+	r      *bufio.Reader
+	parser *Parser
+	queue  []*Entry
+	entry  *Entry
+	err    error
+}
+
+// NewScanner returns a scanner reading from r with a new Parser
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReaderSize(r, 64*1024), parser: NewParser()}
+}
+
+// Parser returns the scanner's parser, to adjust its year or location
+func (s *Scanner) Parser() *Parser {
+	return s.parser
+}
+
+// Scan advances to the next entry, returning false at the end of the
+// input or on a read error
+func (s *Scanner) Scan() bool {
+	for len(s.queue) == 0 {
+		if s.err != nil {
+			if e := s.parser.Flush(); e != nil {
+				s.queue = append(s.queue, e)
+				break
+			}
+			return false
+		}
+		line, err := s.r.ReadString('\n')
+		if line != "" {
+			s.queue = append(s.queue, s.parser.Feed(line)...)
+		}
+		if err != nil {
+			s.err = err
+		}
+	}
+	s.entry, s.queue = s.queue[0], s.queue[1:]
+	return true
+}
+
+// Entry returns the entry read by the last Scan
+func (s *Scanner) Entry() *Entry {
+	return s.entry
+}
+
+// Err returns the first read error other than io.EOF
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
@@ -0,0 +1,164 @@
+package logcat
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// scanFile parses a sample file with a fixed year and time zone
+func scanFile(t *testing.T, name string) []*Entry {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := NewScanner(f)
+	s.Parser().Year = 2024
+	s.Parser().Location = time.UTC
+	var entries []*Entry
+	for s.Scan() {
+		entries = append(entries, s.Entry())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestParseThreadtime(t *testing.T) {
+	entries := scanFile(t, "testdata/threadtime.txt")
+	if len(entries) != 12 {
+		t.Fatalf("got %d entries, want 12", len(entries))
+	}
+
+	if entries[0].Buffer != "main" || entries[0].IsLog() {
+		t.Errorf("entry 0 = %+v, want main divider", entries[0])
+	}
+
+	e := entries[1]
+	want := time.Date(2024, 1, 15, 10, 23, 45, 123000000, time.UTC)
+	if !e.Time.Equal(want) || e.PID != 1234 || e.TID != 1250 || e.Level != LevelInfo || e.Tag != "ActivityManager" {
+		t.Errorf("entry 1 header = %v %d %d %v %q", e.Time, e.PID, e.TID, e.Level, e.Tag)
+	}
+	if !strings.HasPrefix(e.Message, "Start proc 4321:com.example.app") {
+		t.Errorf("entry 1 message = %q", e.Message)
+	}
+
+	if e := entries[2]; e.Tag != "OkHttp" || e.Message != "--> GET https://example.com/api" {
+		t.Errorf("padded tag parsed as %q / %q", e.Tag, e.Message)
+	}
+
+	// The stack frame without a header continues the AndroidRuntime entry
+	trace := entries[8]
+	if trace.Tag != "AndroidRuntime" || trace.Message != "\tat com.example.app.MainActivity.onCreate(MainActivity.java:42)" {
+		t.Errorf("stack frame = %q / %q", trace.Tag, trace.Message)
+	}
+	cont := entries[9]
+	if !cont.Continuation || cont.PID != 4321 || cont.Level != LevelError || cont.Tag != "AndroidRuntime" {
+		t.Errorf("continuation = %+v", cont)
+	}
+
+	if e := entries[10]; e.Level != LevelFatal || e.Tag != "libc" {
+		t.Errorf("fatal entry = %v %q", e.Level, e.Tag)
+	}
+	if e := entries[11]; e.Level != LevelVerbose || e.Message != "" {
+		t.Errorf("empty message = %v %q", e.Level, e.Message)
+	}
+}
+
+func TestParseLong(t *testing.T) {
+	entries := scanFile(t, "testdata/long.txt")
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	if e := entries[0]; e.Tag != "ActivityManager" || e.Message != "Start proc 4321:com.example.app/u0a123" {
+		t.Errorf("entry 0 = %q / %q", e.Tag, e.Message)
+	}
+
+	crash := entries[1]
+	lines := strings.Split(crash.Message, "\n")
+	if crash.Level != LevelError || len(lines) != 4 || lines[0] != "FATAL EXCEPTION: main" {
+		t.Errorf("crash entry = %v %q", crash.Level, crash.Message)
+	}
+
+	// -v year, usec and uid, without a trailing blank line
+	last := entries[2]
+	want := time.Date(2024, 1, 15, 10, 23, 47, 500123000, time.UTC)
+	if !last.Time.Equal(want) || last.UID != "10123" || last.PID != 4321 || last.TID != 4400 || last.Message != "slow response" {
+		t.Errorf("entry 2 = %v %q %d %d %q", last.Time, last.UID, last.PID, last.TID, last.Message)
+	}
+}
+
+func TestParseThreadtimeVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		uid  string
+		time time.Time
+	}{
+		{"uid", "01-15 10:23:45.123  u0_a123  4321  4321 I Tag: msg", "u0_a123", time.Date(2024, 1, 15, 10, 23, 45, 123000000, time.UTC)},
+		{"year", "2023-12-31 23:59:59.999  4321  4321 I Tag: msg", "", time.Date(2023, 12, 31, 23, 59, 59, 999000000, time.UTC)},
+		{"epoch", "1705314225.500  4321  4321 I Tag: msg", "", time.Unix(1705314225, 500000000)},
+		{"zone", "01-15 10:23:45.123 +0000  4321  4321 I Tag: msg", "", time.Date(2024, 1, 15, 10, 23, 45, 123000000, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Parser{Year: 2024, Location: time.UTC}
+			entries := p.Feed(tt.line)
+			if len(entries) != 1 || !entries[0].IsLog() {
+				t.Fatalf("got %+v", entries)
+			}
+			e := entries[0]
+			if e.UID != tt.uid || !e.Time.Equal(tt.time) || e.PID != 4321 || e.Tag != "Tag" || e.Message != "msg" {
+				t.Errorf("got %q %v %d %q %q", e.UID, e.Time, e.PID, e.Tag, e.Message)
+			}
+		})
+	}
+}
+
+func TestParseThreadtimeTags(t *testing.T) {
+	tests := []struct{ line, tag, message string }{
+		{"01-15 10:23:45.123  4321  4321 I chromium:net: error: -105", "chromium:net", "error: -105"},
+		{"01-15 10:23:45.123  4321  4321 I Tag     : padded", "Tag", "padded"},
+		{"01-15 10:23:45.123  4321  4321 I Tag: ", "Tag", ""},
+		{"01-15 10:23:45.123  4321  4321 I Tag:", "Tag", ""},
+	}
+	for _, tt := range tests {
+		p := &Parser{Year: 2024, Location: time.UTC}
+		entries := p.Feed(tt.line)
+		if len(entries) != 1 || !entries[0].IsLog() {
+			t.Fatalf("%q: got %+v", tt.line, entries)
+		}
+		if e := entries[0]; e.Tag != tt.tag || e.Message != tt.message {
+			t.Errorf("%q: got %q / %q, want %q / %q", tt.line, e.Tag, e.Message, tt.tag, tt.message)
+		}
+	}
+}
+
+func TestFormatAlignsMessages(t *testing.T) {
+	entries := scanFile(t, "testdata/threadtime.txt")
+	f := NewFormatter(false)
+	f.TagWidth = 10
+
+	first := f.Format(entries[1])
+	cont := f.Format(entries[9])
+	// Compare columns in runes: the shortened tag starts with "…"
+	col := utf8.RuneCountInString(first[:strings.Index(first, "Start proc")])
+	if utf8.RuneCountInString(cont[:strings.Index(cont, "\tat android")]) != col {
+		t.Errorf("continuation not aligned:\n%s\n%s", first, cont)
+	}
+	if !strings.Contains(first, "…tyManager") {
+		t.Errorf("long tag not shortened: %s", first)
+	}
+
+	colored := NewFormatter(true).Format(entries[5])
+	if !strings.Contains(colored, levelBadges[LevelError]) {
+		t.Errorf("error entry not colored: %q", colored)
+	}
+}
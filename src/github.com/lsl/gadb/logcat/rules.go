@@ -0,0 +1,238 @@
+package logcat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RuleAction is what a rule does to the entries it matches
+type RuleAction int
+
+const (
+	// RuleHighlight colors matching messages
+	RuleHighlight RuleAction = iota
+	// RuleMute hides matching entries
+	RuleMute
+	// RuleAlert announces matching entries and may run a command
+	RuleAlert
+)
+
+// ruleActions maps rule keywords to actions
+var ruleActions = map[string]RuleAction{
+	"highlight": RuleHighlight,
+	"mute":      RuleMute,
+	"alert":     RuleAlert,
+}
+
+// IsRuleLine reports whether a config line is a rule, that is starts
+// with highlight, mute or alert
+func IsRuleLine(line string) bool {
+	word, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+	_, ok := ruleActions[word]
+	return ok
+}
+
+// Colors are the color names rules accept
+var Colors = map[string]string{
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+	"white":   "\033[37m",
+	"bold":    ansiBold,
+}
+
+// condition is one "field=value" or "field~regexp" test of a rule
+type condition struct {
+	field string
+	// value is compared exactly when re is nil
+	value string
+	re    *regexp.Regexp
+}
+
+// ruleFields are the entry fields a condition can test
+var ruleFields = map[string]bool{"tag": true, "message": true, "pid": true, "tid": true, "level": true}
+
+// Rule is a highlight, mute or alert rule from the config file:
+//
+//	highlight tag=OkHttp color=cyan
+//	mute tag=chatty
+//	alert message~"OutOfMemoryError" run="adb exec-out screencap -p > oom.png"
+//
+// "field=value" matches exactly and "field~regexp" searches; the
+// fields are tag, message, pid, tid and level (a letter such as E).
+// Values may be double-quoted. A rule matches when all of its
+// conditions do.
+type Rule struct {
+	Action RuleAction
+	// Color is the highlight or alert color name, empty for the default
+	Color string
+	// Run is a local command an alert starts, empty for none
+	Run string
+	// Text is the rule as written, to show which rule fired
+	Text string
+
+	conditions []condition
+}
+
+// ParseRule parses one rule line
+func ParseRule(line string) (*Rule, error) {
+	words, err := splitRuleWords(strings.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty rule")
+	}
+	action, ok := ruleActions[words[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule %q (want highlight, mute or alert)", words[0])
+	}
+	r := &Rule{Action: action, Text: strings.TrimSpace(line)}
+	for _, w := range words[1:] {
+		i := strings.IndexAny(w, "=~")
+		if i <= 0 {
+			return nil, fmt.Errorf("expected field=value or field~regexp, got %q", w)
+		}
+		field, op := w[:i], w[i]
+		value, err := unquoteRuleValue(w[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == "color" && op == '=' && action != RuleMute:
+			if _, ok := Colors[value]; !ok {
+				return nil, fmt.Errorf("unknown color %q", value)
+			}
+			r.Color = value
+		case field == "run" && op == '=' && action == RuleAlert:
+			r.Run = value
+		case ruleFields[field] && op == '=':
+			r.conditions = append(r.conditions, condition{field: field, value: value})
+		case ruleFields[field] && op == '~':
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("bad regexp for %s: %w", field, err)
+			}
+			r.conditions = append(r.conditions, condition{field: field, re: re})
+		default:
+			return nil, fmt.Errorf("%s rules do not take %q", words[0], w)
+		}
+	}
+	if len(r.conditions) == 0 {
+		return nil, fmt.Errorf("%s rule needs at least one condition", words[0])
+	}
+	return r, nil
+}
+
+// splitRuleWords splits a rule at spaces outside double quotes
+func splitRuleWords(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inQuote, escaped := false, false
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && c == '\\':
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case !inQuote && (c == ' ' || c == '\t'):
+			if cur.Len() > 0 {
+				words = append(words, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(c)
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if cur.Len() > 0 {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// unquoteRuleValue removes the double quotes around a value
+func unquoteRuleValue(v string) (string, error) {
+	if strings.HasPrefix(v, `"`) {
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", fmt.Errorf("bad quoted value %s", v)
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+// Match reports whether an entry satisfies every condition
+// Lines that are not log records never match
+func (r *Rule) Match(e *Entry) bool {
+	if !e.IsLog() {
+		return false
+	}
+	for _, c := range r.conditions {
+		var v string
+		switch c.field {
+		case "tag":
+			v = e.Tag
+		case "message":
+			v = e.Message
+		case "pid":
+			v = strconv.Itoa(e.PID)
+		case "tid":
+			v = strconv.Itoa(e.TID)
+		case "level":
+			v = e.Level.Letter()
+		}
+		if c.re != nil && !c.re.MatchString(v) || c.re == nil && v != c.value {
+			return false
+		}
+	}
+	return true
+}
+
+// Rules is a list of rules applied in order
+type Rules []*Rule
+
+// Muted reports whether a mute rule matches the entry
+func (rs Rules) Muted(e *Entry) bool {
+	for _, r := range rs {
+		if r.Action == RuleMute && r.Match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Highlight returns the color of the first highlight rule matching the
+// entry, "" when none does
+func (rs Rules) Highlight(e *Entry) string {
+	for _, r := range rs {
+		if r.Action == RuleHighlight && r.Match(e) {
+			if r.Color == "" {
+				return "yellow"
+			}
+			return r.Color
+		}
+	}
+	return ""
+}
+
+// Alerts returns the alert rules matching the entry
+func (rs Rules) Alerts(e *Entry) []*Rule {
+	var alerts []*Rule
+	for _, r := range rs {
+		if r.Action == RuleAlert && r.Match(e) {
+			alerts = append(alerts, r)
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,88 @@
+package logcat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		line    string
+		action  RuleAction
+		color   string
+		run     string
+		wantErr string
+	}{
+		{line: "highlight tag=OkHttp color=cyan", action: RuleHighlight, color: "cyan"},
+		{line: "mute tag=chatty", action: RuleMute},
+		{line: `alert message~"OutOfMemoryError" run="adb exec-out screencap -p > \"oom shot.png\""`, action: RuleAlert,
+			run: `adb exec-out screencap -p > "oom shot.png"`},
+		{line: "highlight tag=OkHttp color=pink", wantErr: "unknown color"},
+		{line: "mute tag=chatty run=true", wantErr: "do not take"},
+		{line: "alert color=red", wantErr: "at least one condition"},
+		{line: `alert message~"(" `, wantErr: "bad regexp"},
+		{line: `mute message~"open`, wantErr: "unterminated quote"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRule(tt.line)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRule(%q) error = %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", tt.line, err)
+			continue
+		}
+		if r.Action != tt.action || r.Color != tt.color || r.Run != tt.run {
+			t.Errorf("ParseRule(%q) = %+v", tt.line, r)
+		}
+	}
+}
+
+func TestRulesApply(t *testing.T) {
+	var rules Rules
+	for _, line := range []string{
+		"highlight tag=OkHttp color=cyan",
+		"highlight level=E",
+		"mute tag=chatty",
+		`alert message~"OutOfMemory(Error)?" level=E`,
+	} {
+		r, err := ParseRule(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+
+	entries := scanFile(t, "testdata/threadtime.txt")
+	var highlighted, muted []string
+	for _, e := range entries {
+		if c := rules.Highlight(e); c != "" {
+			highlighted = append(highlighted, e.Tag+":"+c)
+		}
+		if rules.Muted(e) {
+			muted = append(muted, e.Tag)
+		}
+	}
+	if got := strings.Join(muted, ","); got != "chatty" {
+		t.Errorf("muted = %s", got)
+	}
+	if len(highlighted) == 0 || highlighted[0] != "OkHttp:cyan" {
+		t.Errorf("highlighted = %v", highlighted)
+	}
+
+	oom := &Entry{Level: LevelError, Tag: "art", Message: "Throwing OutOfMemoryError"}
+	if got := rules.Alerts(oom); len(got) != 1 {
+		t.Errorf("alerts for OOM = %d, want 1", len(got))
+	}
+	oom.Level = LevelWarn
+	if got := rules.Alerts(oom); len(got) != 0 {
+		t.Errorf("alert fired for a warning")
+	}
+	divider := &Entry{Buffer: "main", Raw: "--------- beginning of main"}
+	if rules.Muted(divider) || rules.Highlight(divider) != "" {
+		t.Error("rules matched a divider")
+	}
+}
@@ -0,0 +1,245 @@
+package gadb
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+)
+
+// pkgPollInterval is how often the process list is checked for new
+// processes of a filtered package
+const pkgPollInterval = 2 * time.Second
+
+var (
+	// "Start proc 4321:com.example.app/u0a123 for activity ..." (Android 7+)
+	startProcRe = regexp.MustCompile(`^Start proc (\d+):([^/\s]+)/`)
+	// "Start proc com.example.app for activity ...: pid=4321 uid=..." (older)
+	startProcOldRe = regexp.MustCompile(`^Start proc ([^\s]+) for .*?: pid=(\d+)`)
+	// "Process com.example.app (pid 4321) has died"
+	procDiedRe = regexp.MustCompile(`^Process ([^\s]+) \(pid (\d+)\) has died`)
+	// "Killing 4321:com.example.app/u0a123 (adj 900): ..."
+	procKilledRe = regexp.MustCompile(`^Killing (\d+):([^/\s]+)/`)
+	// am_proc_start events: "[0,4321,10123,com.example.app,activity,...]"
+	amProcStartRe = regexp.MustCompile(`^\[\d+,(\d+),\d+,([^,\]]+),`)
+	// am_proc_died events: "[0,4321,com.example.app,900,17]"
+	amProcDiedRe = regexp.MustCompile(`^\[\d+,(\d+),([^,\]]+)`)
+)
+
+// pkgFilter keeps logcat entries from the processes of one package,
+// following the app across restarts the way pidcat does: new pids come
+// from ActivityManager's "Start proc" lines, am_proc_start events and
+// from polling ps
+type pkgFilter struct {
+	serial string
+	pkg    string
+
+	mu   sync.Mutex
+	pids map[int]bool
+}
+
+// newPkgFilter returns a filter seeded with the package's running processes
+func newPkgFilter(serial, pkg string) *pkgFilter {
+	f := &pkgFilter{serial: serial, pkg: pkg, pids: make(map[int]bool)}
+	for _, pid := range packagePids(serial, pkg) {
+		f.pids[pid] = true
+	}
+	return f
+}
+
+// ownsProcess reports whether a process name belongs to the package,
+// including secondary processes such as "com.example.app:remote"
+func (f *pkgFilter) ownsProcess(name string) bool {
+	return name == f.pkg || strings.HasPrefix(name, f.pkg+":")
+}
+
+// Pids returns the tracked pids in order
+func (f *pkgFilter) Pids() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pids := make([]int, 0, len(f.pids))
+	for pid := range f.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// add starts tracking a pid, reporting whether it is new
+func (f *pkgFilter) add(pid int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pids[pid] {
+		return false
+	}
+	f.pids[pid] = true
+	return true
+}
+
+// remove stops tracking a pid, reporting whether it was tracked
+func (f *pkgFilter) remove(pid int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.pids[pid] {
+		return false
+	}
+	delete(f.pids, pid)
+	return true
+}
+
+// Observe follows process starts and deaths announced by
+// ActivityManager or the am_proc_start and am_proc_died events, and
+// returns a notice to show when the package's processes change
+// Call it for every entry, before Match
+func (f *pkgFilter) Observe(e *logcat.Entry) string {
+	if !e.IsLog() || e.Continuation {
+		return ""
+	}
+	switch e.Tag {
+	case "ActivityManager":
+		return f.observeActivityManager(e.Message)
+	case "am_proc_start":
+		if m := amProcStartRe.FindStringSubmatch(e.Message); m != nil && f.ownsProcess(m[2]) {
+			return f.started(m[1], m[2])
+		}
+	case "am_proc_died":
+		if m := amProcDiedRe.FindStringSubmatch(e.Message); m != nil && f.ownsProcess(m[2]) {
+			return f.ended(m[1], m[2])
+		}
+	}
+	return ""
+}
+
+// observeActivityManager follows the process lines ActivityManager logs
+func (f *pkgFilter) observeActivityManager(msg string) string {
+	if m := startProcRe.FindStringSubmatch(msg); m != nil && f.ownsProcess(m[2]) {
+		return f.started(m[1], m[2])
+	}
+	if m := startProcOldRe.FindStringSubmatch(msg); m != nil && f.ownsProcess(m[1]) {
+		return f.started(m[2], m[1])
+	}
+	if m := procDiedRe.FindStringSubmatch(msg); m != nil && f.ownsProcess(m[1]) {
+		return f.ended(m[2], m[1])
+	}
+	if m := procKilledRe.FindStringSubmatch(msg); m != nil && f.ownsProcess(m[2]) {
+		return f.ended(m[1], m[2])
+	}
+	return ""
+}
+
+// started records a process start announced in the log
+func (f *pkgFilter) started(pidStr, name string) string {
+	pid, _ := strconv.Atoi(pidStr)
+	if !f.add(pid) {
+		return ""
+	}
+	return fmt.Sprintf("Process %s started (pid %d)", name, pid)
+}
+
+// ended records a process death announced in the log
+func (f *pkgFilter) ended(pidStr, name string) string {
+	pid, _ := strconv.Atoi(pidStr)
+	if !f.remove(pid) {
+		return ""
+	}
+	return fmt.Sprintf("Process %s ended (pid %d)", name, pid)
+}
+
+// Match reports whether an entry comes from one of the package's processes
+func (f *pkgFilter) Match(e *logcat.Entry) bool {
+	if !e.IsLog() {
+		// Keep adb's own messages, drop buffer dividers
+		return e.Buffer == ""
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pids[e.PID]
+}
+
+// poll adds processes found by ps until stop is closed, for starts
+// the log does not announce; notify is called for each new pid
+// Pids are only removed by death messages, so lines a dying process
+// logged just before exiting are still shown
+func (f *pkgFilter) poll(stop <-chan struct{}, notify func(string)) {
+	ticker := time.NewTicker(pkgPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, pid := range packagePids(f.serial, f.pkg) {
+				if f.add(pid) {
+					notify(fmt.Sprintf("Process %s started (pid %d)", f.pkg, pid))
+				}
+			}
+		}
+	}
+}
+
+// packagePids lists the pids of a package's processes on a device
+// It reads ps so secondary processes ("pkg:remote") are included, and
+// falls back to pidof
+func packagePids(serial, pkg string) []int {
+	cmd := exec.Command("adb", "-s", serial, "shell", "ps -A 2>/dev/null || ps")
+	setupCommand(cmd)
+	out, err := cmd.Output()
+	f := &pkgFilter{pkg: pkg}
+	if err == nil {
+		if pids := parsePsPids(string(out), f.ownsProcess); len(pids) > 0 {
+			return pids
+		}
+	}
+
+	cmd = exec.Command("adb", "-s", serial, "shell", "pidof", pkg)
+	setupCommand(cmd)
+	out, err = cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(out)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// parsePsPids returns the pids of ps output rows whose process name
+// (the last column) satisfies match
+// The PID column is located from the header, which differs between
+// toybox and the older toolbox ps
+func parsePsPids(out string, match func(name string) bool) []int {
+	lines := strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	pidCol := -1
+	for i, h := range strings.Fields(lines[0]) {
+		if h == "PID" {
+			pidCol = i
+			break
+		}
+	}
+	if pidCol < 0 {
+		return nil
+	}
+	var pids []int
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) <= pidCol || !match(fields[len(fields)-1]) {
+			continue
+		}
+		if pid, err := strconv.Atoi(fields[pidCol]); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,61 @@
+package gadb
+
+import (
+	"reflect"
+	"testing"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+)
+
+func TestParsePsPids(t *testing.T) {
+	f := &pkgFilter{pkg: "com.example.app"}
+	tests := []struct {
+		name string
+		out  string
+		want []int
+	}{
+		{"toybox", "USER PID PPID VSZ RSS WCHAN ADDR S NAME\r\nu0_a1 4321 1 0 0 0 0 S com.example.app\r\nu0_a1 4400 1 0 0 0 0 S com.example.app:remote\r\nu0_a2 5000 1 0 0 0 0 S com.example.application\r\n", []int{4321, 4400}},
+		{"toolbox", "USER     PID   PPID  VSIZE  RSS     WCHAN    PC        NAME\nu0_a1     4321  1     0      0     ffffffff 00000000 S com.example.app\n", []int{4321}},
+		{"no header", "4321 com.example.app\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePsPids(tt.out, f.ownsProcess); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPkgFilterFollowsRestarts(t *testing.T) {
+	f := &pkgFilter{pkg: "com.example.app", pids: map[int]bool{100: true}}
+	p := logcat.NewParser()
+	feed := func(line string) *logcat.Entry {
+		e := p.Feed(line)[0]
+		f.Observe(e)
+		return e
+	}
+
+	if e := feed("01-15 10:00:00.000   100   100 I App: first run"); !f.Match(e) {
+		t.Error("line from the running process was dropped")
+	}
+	feed("01-15 10:00:01.000  1234  1250 I ActivityManager: Process com.example.app (pid 100) has died: fg TOP")
+	feed("01-15 10:00:02.000  1234  1250 I ActivityManager: Start proc 200:com.example.app/u0a123 for activity {com.example.app/.Main}")
+	if e := feed("01-15 10:00:03.000   100   100 I Other: reused pid"); f.Match(e) {
+		t.Error("line from the dead pid was kept")
+	}
+	if e := feed("01-15 10:00:04.000   200   200 I App: second run"); !f.Match(e) {
+		t.Error("line from the restarted process was dropped")
+	}
+	if got := f.Pids(); !reflect.DeepEqual(got, []int{200}) {
+		t.Errorf("pids = %v, want [200]", got)
+	}
+
+	// Only ActivityManager and the am_proc events announce processes
+	feed("01-15 10:00:05.000   200   200 I App: Start proc 300:com.example.app/u0a123 for test")
+	feed("01-15 10:00:06.000  1234  1250 I am_proc_start: [0,400,10123,com.example.app:remote,service,{com.example.app/.Sync}]")
+	feed("01-15 10:00:07.000  1234  1250 I am_proc_died: [0,200,com.example.app,900,17]")
+	if got := f.Pids(); !reflect.DeepEqual(got, []int{400}) {
+		t.Errorf("pids = %v, want [400]", got)
+	}
+}
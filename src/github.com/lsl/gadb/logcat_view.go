@@ -0,0 +1,770 @@
+package gadb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+
+	"github.com/chzyer/readline"
+)
+
+// rawLogcatFormats are -v formats and modifiers the parser cannot read
+var rawLogcatFormats = map[string]bool{
+	"brief": true, "process": true, "raw": true, "tag": true,
+	"thread": true, "time": true, "color": true, "monotonic": true,
+}
+
+// rawLogcatFlags are logcat options that do not print a log stream,
+// or print one gadb does not parse
+var rawLogcatFlags = map[string]bool{
+	"-c": true, "--clear": true, "-g": true, "--buffer-size": true,
+	"-G": true, "-S": true, "--statistics": true, "-p": true,
+	"--prune": true, "-P": true, "-f": true, "--file": true,
+	"-h": true, "--help": true,
+}
+
+// logcatFormats returns the -v / --format values in logcat arguments
+func logcatFormats(args []string) []string {
+	var formats []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case (a == "-v" || a == "--format") && i+1 < len(args):
+			formats = append(formats, args[i+1])
+			i++
+		case strings.HasPrefix(a, "--format="):
+			formats = append(formats, strings.TrimPrefix(a, "--format="))
+		case strings.HasPrefix(a, "-v") && len(a) > 2:
+			formats = append(formats, a[2:])
+		}
+	}
+	return formats
+}
+
+// parsesLogcat reports whether gadb should parse and format a logcat
+// command itself rather than pass it through the PTY
+func parsesLogcat(args []string) bool {
+	if len(args) == 0 || args[0] != "logcat" {
+		return false
+	}
+	for _, a := range args[1:] {
+		if rawLogcatFlags[a] {
+			return false
+		}
+	}
+	for _, f := range logcatFormats(args[1:]) {
+		if rawLogcatFormats[f] {
+			return false
+		}
+	}
+	return true
+}
+
+// parsesLogcatText reports whether a redirected logcat command can go
+// through a view, which writes the same lines while detecting crashes
+// Binary output is left to adb so the bytes stay untouched
+func parsesLogcatText(args []string) bool {
+	return parsesLogcat(args) && !isBinaryLogcat(args)
+}
+
+// isBinaryLogcat reports whether logcat arguments ask for binary
+// output (-B), which is decoded rather than parsed as text
+func isBinaryLogcat(args []string) bool {
+	for _, a := range args[1:] {
+		if a == "-B" || a == "--binary" {
+			return true
+		}
+	}
+	return false
+}
+
+// logcatArgs returns the adb arguments for a parsed logcat view,
+// asking for threadtime output unless a parseable format was chosen
+// Binary output has no format to choose
+func logcatArgs(args []string) []string {
+	if isBinaryLogcat(args) {
+		return args
+	}
+	for _, f := range logcatFormats(args[1:]) {
+		if f == "threadtime" || f == "long" {
+			return args
+		}
+	}
+	return append([]string{"logcat", "-v", "threadtime"}, args[1:]...)
+}
+
+// useColor reports whether output to f should be colored
+func useColor(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && readline.IsTerminal(int(f.Fd()))
+}
+
+// logcatViewOptions are gadb's own logcat flags
+type logcatViewOptions struct {
+	// pkg limits the view to one package's processes (--pkg)
+	pkg string
+	// devices selects devices to merge by list index, or "all" (--devices)
+	devices string
+	// files are saved logcat files to merge instead of devices (--files)
+	files string
+	// export writes records as ndjson, csv or html instead of log
+	// lines (--format); other --format values go to logcat
+	export string
+}
+
+// splitLogcatArgs separates gadb's logcat flags from the ones for adb
+func splitLogcatArgs(args []string) ([]string, logcatViewOptions, error) {
+	var opts logcatViewOptions
+	flags := map[string]*string{"--pkg": &opts.pkg, "--devices": &opts.devices, "--files": &opts.files}
+	adbArgs := []string{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, value, hasValue := strings.Cut(a, "=")
+		if name == "--format" {
+			if !hasValue && i+1 < len(args) {
+				value = args[i+1]
+			}
+			if logcat.IsExportFormat(value) {
+				opts.export = value
+				if !hasValue {
+					i++
+				}
+				continue
+			}
+		}
+		target, ok := flags[name]
+		switch {
+		case !ok:
+			adbArgs = append(adbArgs, a)
+		case hasValue:
+			*target = value
+		case i+1 < len(args):
+			*target = args[i+1]
+			i++
+		default:
+			return nil, opts, fmt.Errorf("%s requires a value", a)
+		}
+	}
+	return adbArgs, opts, nil
+}
+
+// hasLogcatViewFlags reports whether a logcat command uses gadb's own
+// flags, which only a parsed view can honor
+func hasLogcatViewFlags(args []string) bool {
+	if len(args) == 0 || args[0] != "logcat" {
+		return false
+	}
+	_, opts, err := splitLogcatArgs(args)
+	return err != nil || opts != logcatViewOptions{}
+}
+
+// isMergedLogcat reports whether a logcat command reads several
+// devices or files, which needs the device list rather than one device
+func isMergedLogcat(args []string) bool {
+	if len(args) == 0 || args[0] != "logcat" {
+		return false
+	}
+	_, opts, err := splitLogcatArgs(args)
+	return err == nil && (opts.devices != "" || opts.files != "")
+}
+
+// sourceColors tell merged streams apart
+var sourceColors = []string{"cyan", "magenta", "yellow", "green", "blue"}
+
+// logcatSource is one stream shown in a logcat view
+type logcatSource struct {
+	// label tags lines from this source when several are merged
+	label string
+	color string
+	// device names the source in crash reports
+	device string
+	// serial is the device serial, empty for files
+	serial  string
+	pkg     *pkgFilter
+	crashes *logcat.CrashDetector
+	// lastSeen is when the source last produced an entry
+	lastSeen time.Time
+}
+
+// logcatView shows parsed entries, filtered by the view options
+type logcatView struct {
+	// mu serializes output from the streams and the pid pollers
+	mu  sync.Mutex
+	out io.Writer
+	// formatter renders entries; nil writes the original lines so the
+	// output stays parseable logcat, as when redirecting to a file
+	formatter *logcat.Formatter
+	// labelWidth aligns source labels
+	labelWidth int
+	// crashCount counts the crashes reported by this view
+	crashCount int
+	// exporter, when set, receives the entries instead of out
+	exporter  logcat.Exporter
+	exportErr error
+	// outErr is the first error writing lines to out
+	outErr error
+	// rules are the highlight, mute and alert rules from the config
+	rules logcat.Rules
+	// alerted is when each alert rule last fired
+	alerted map[*logcat.Rule]time.Time
+}
+
+// alertCooldown is the least time between two firings of an alert rule,
+// so a burst of matching lines starts its command once
+const alertCooldown = 5 * time.Second
+
+// newLogcatView returns a view writing to out that applies the
+// highlight, mute and alert rules
+func newLogcatView(out io.Writer, formatter *logcat.Formatter, rules logcat.Rules) *logcatView {
+	if formatter != nil {
+		formatter.Rules = rules
+	}
+	return &logcatView{out: out, formatter: formatter, rules: rules, alerted: make(map[*logcat.Rule]time.Time)}
+}
+
+// addSource registers a stream from a device (or file), labeled when
+// label is not empty
+func (v *logcatView) addSource(label, device string, index int) *logcatSource {
+	if n := len([]rune(label)); n > v.labelWidth {
+		v.labelWidth = n
+	}
+	return &logcatSource{
+		label:    label,
+		color:    sourceColors[index%len(sourceColors)],
+		device:   device,
+		crashes:  logcat.NewCrashDetector(),
+		lastSeen: time.Now(),
+	}
+}
+
+// export writes the view's entries in a structured format instead
+// of log lines
+func (v *logcatView) export(format string) error {
+	exporter, err := logcat.NewExporter(format, v.out)
+	if err != nil {
+		return err
+	}
+	v.exporter, v.formatter = exporter, nil
+	return nil
+}
+
+// finish completes exported output, returning the first write error
+func (v *logcatView) finish() error {
+	if v.exporter == nil {
+		return nil
+	}
+	if err := v.exporter.Close(); err != nil && v.exportErr == nil {
+		v.exportErr = err
+	}
+	if v.exportErr != nil {
+		return fmt.Errorf("failed to export logcat: %w", v.exportErr)
+	}
+	return nil
+}
+
+// tag renders the source label column, empty for a single source
+func (v *logcatView) tag(src *logcatSource) string {
+	if src.label == "" {
+		return ""
+	}
+	label := src.label + strings.Repeat(" ", v.labelWidth-len([]rune(src.label)))
+	if v.formatter == nil {
+		return "[" + src.label + "] "
+	}
+	if v.formatter.Color {
+		return promptColors[src.color] + label + promptColors["reset"] + " "
+	}
+	return label + " "
+}
+
+// show writes an entry if it passes the source's filters
+// Every entry goes through crash detection, filtered or not
+func (v *logcatView) show(src *logcatSource, e *logcat.Entry) {
+	src.lastSeen = time.Now()
+	for _, c := range src.crashes.Feed(e) {
+		v.reportCrash(src, c)
+	}
+	if src.pkg != nil {
+		if msg := src.pkg.Observe(e); msg != "" {
+			v.notice(src, msg)
+		}
+		if !src.pkg.Match(e) {
+			return
+		}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Alerts fire for muted lines too; muting only hides them
+	defer v.alert(src, e)
+	if v.rules.Muted(e) {
+		return
+	}
+	if v.exporter != nil {
+		if err := v.exporter.Write(src.device, e); err != nil && v.exportErr == nil {
+			v.exportErr = err
+		}
+		return
+	}
+	text := v.tag(src) + e.Raw
+	if v.formatter != nil {
+		text = v.formatter.Format(e)
+		if tag := v.tag(src); tag != "" {
+			// Keep the label in front of every line of multi-line messages
+			text = tag + strings.ReplaceAll(text, "\n", "\n"+tag)
+		}
+	}
+	if _, err := fmt.Fprintln(v.out, text); err != nil && v.outErr == nil {
+		v.outErr = err
+	}
+}
+
+// writeFailed reports whether the output can no longer be written, as
+// when the command reading a pipe has exited
+func (v *logcatView) writeFailed() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.outErr != nil || v.exportErr != nil
+}
+
+// notice shows a gadb status line among the entries
+func (v *logcatView) notice(src *logcatSource, msg string) {
+	if v.formatter == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.formatter.Color {
+		fmt.Fprintf(v.out, "%s\033[1;36m--- %s\033[0m\n", v.tag(src), msg)
+		return
+	}
+	fmt.Fprintf(v.out, "%s--- %s\n", v.tag(src), msg)
+}
+
+// alert announces an entry matching alert rules and starts their
+// commands, at most once per rule every alertCooldown; v.mu must be held
+func (v *logcatView) alert(src *logcatSource, e *logcat.Entry) {
+	for _, r := range v.rules.Alerts(e) {
+		if time.Since(v.alerted[r]) < alertCooldown {
+			continue
+		}
+		v.alerted[r] = time.Now()
+
+		w, color := v.out, v.formatter != nil && v.formatter.Color
+		if v.formatter == nil {
+			w, color = commandStderr(), useColor(os.Stderr)
+		}
+		if color {
+			code := logcat.Colors[r.Color]
+			if code == "" {
+				code = logcat.Colors["yellow"]
+			}
+			fmt.Fprintf(w, "%s\033[1;30;43m ALERT \033[0m %s%s\033[0m  (%s)\n", v.tag(src), code, e.Message, r.Text)
+		} else {
+			fmt.Fprintf(w, "%s[ALERT] %s  (%s)\n", v.tag(src), e.Message, r.Text)
+		}
+		if r.Run != "" {
+			runAlertCommand(src, r, e)
+		}
+	}
+}
+
+// runAlertCommand starts an alert rule's local command in the
+// background, describing the entry in GADB_* environment variables
+func runAlertCommand(src *logcatSource, r *logcat.Rule, e *logcat.Entry) {
+	cmd := localCommand(r.Run)
+	cmd.Env = append(os.Environ(),
+		"GADB_SERIAL="+src.serial,
+		"GADB_DEVICE="+src.device,
+		"GADB_PID="+strconv.Itoa(e.PID),
+		"GADB_TAG="+e.Tag,
+		"GADB_LEVEL="+e.Level.Letter(),
+		"GADB_MESSAGE="+e.Message,
+	)
+	if src.serial != "" {
+		// Plain adb commands then target the device the alert came from
+		cmd.Env = append(cmd.Env, "ANDROID_SERIAL="+src.serial)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: alert command failed: %v\n", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// reportCrash saves a crash and prints its summary among the entries,
+// or on stderr when the entries go to a file
+// With --pkg only the package's own crashes are reported
+func (v *logcatView) reportCrash(src *logcatSource, c *logcat.Crash) {
+	if src.pkg != nil && !src.pkg.ownsProcess(c.Package) {
+		return
+	}
+	cc, err := captureCrash(src.device, c)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.crashCount++
+	if v.formatter == nil {
+		printCrashAlert(commandStderr(), useColor(os.Stderr), cc)
+	} else {
+		printCrashAlert(v.out, v.formatter.Color, cc)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// idle completes crash reports on sources that have gone quiet, so a
+// crash is reported even when nothing is logged after it
+func (v *logcatView) idle(sources []*logcatSource) {
+	for _, src := range sources {
+		if src.crashes.Pending() && time.Since(src.lastSeen) > time.Second {
+			for _, c := range src.crashes.Flush() {
+				v.reportCrash(src, c)
+			}
+		}
+	}
+}
+
+// drain shows merged entries until every source ends or the output
+// fails, then completes pending crash reports and recaps the crashes
+// found
+func (v *logcatView) drain(sources []*logcatSource, channels []<-chan *logcat.Entry) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	stop := make(chan struct{})
+	defer close(stop)
+	merged := logcat.Merge(channels, logcat.DefaultMergeWindow, stop)
+	for ended := false; !ended; {
+		select {
+		case m, ok := <-merged:
+			if !ok {
+				ended = true
+				break
+			}
+			v.show(sources[m.Source], m.Entry)
+			ended = v.writeFailed()
+		case <-ticker.C:
+			v.idle(sources)
+		}
+	}
+	for _, src := range sources {
+		for _, c := range src.crashes.Flush() {
+			v.reportCrash(src, c)
+		}
+	}
+	if v.crashCount > 0 && v.formatter != nil {
+		fmt.Fprintf(v.out, "%d crash(es) captured; type 'crashes' to list them\n", v.crashCount)
+	}
+}
+
+// catchInterrupt keeps Ctrl+C from terminating gadb while a stream runs,
+// calling stop when it is pressed
+// The returned function ends the watch and reports whether Ctrl+C was
+// pressed, in which case stopping the stream is the normal way out
+func catchInterrupt(stop func()) func() bool {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	interrupted := false
+	done := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-sigCh:
+			interrupted = true
+			stop()
+		case <-done:
+		}
+	}()
+	return func() bool {
+		close(done)
+		<-watcherDone
+		signal.Stop(sigCh)
+		select {
+		case <-sigCh:
+			interrupted = true
+		default:
+		}
+		return interrupted
+	}
+}
+
+// logcatStream is a running "adb logcat" on one device
+type logcatStream struct {
+	cmd     *exec.Cmd
+	entries chan *logcat.Entry
+}
+
+// startLogcatStream starts logcat on a device and parses its output
+// in the background; the entries channel closes when logcat exits
+func startLogcatStream(serial string, args []string) (*logcatStream, error) {
+	binary := isBinaryLogcat(args)
+	adbArgs := append([]string{"-s", serial}, logcatArgs(args)...)
+	if binary {
+		// exec-out keeps the stream byte-exact; a shell may translate
+		// line endings on older devices
+		adbArgs = append([]string{"-s", serial, "exec-out"}, args...)
+	}
+	cmd := exec.Command("adb", adbArgs...)
+	setupCommand(cmd)
+	cmd.Stderr = commandStderr()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start logcat: %w", err)
+	}
+	s := &logcatStream{cmd: cmd, entries: make(chan *logcat.Entry, 256)}
+	var scanner logcat.EntryScanner = logcat.NewScanner(stdout)
+	if binary {
+		scanner = logcat.NewBinaryScanner(stdout)
+	}
+	go scanEntries(scanner, s.entries)
+	return s, nil
+}
+
+// scanEntries sends the scanner's entries to ch, closing ch at the end
+func scanEntries(scanner logcat.EntryScanner, ch chan<- *logcat.Entry) {
+	defer close(ch)
+	for scanner.Scan() {
+		ch <- scanner.Entry()
+	}
+}
+
+// runLogcatView streams logcat from a device through the parser and
+// prints entries to out, formatted with formatter when it is not nil
+// Ctrl+C stops the stream and returns to the prompt
+func runLogcatView(device *Device, args []string, rules logcat.Rules, out io.Writer, formatter *logcat.Formatter) error {
+	return runLogcatDevices([]Device{*device}, nil, args, rules, out, formatter)
+}
+
+// runLogcatDevices streams logcat from several devices at once, merged
+// by timestamp and tagged with each device's label
+func runLogcatDevices(devices []Device, labels []string, args []string, rules logcat.Rules, out io.Writer, formatter *logcat.Formatter) error {
+	args, opts, err := splitLogcatArgs(args)
+	if err != nil {
+		return err
+	}
+	if !parsesLogcat(args) {
+		return fmt.Errorf("gadb logcat options need threadtime or long output")
+	}
+	view := newLogcatView(out, formatter, rules)
+	if opts.export != "" {
+		if err := view.export(opts.export); err != nil {
+			return err
+		}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	sources := make([]*logcatSource, len(devices))
+	for i, d := range devices {
+		label := ""
+		if i < len(labels) {
+			label = labels[i]
+		}
+		device := label
+		if device == "" {
+			device = d.Serial
+		}
+		sources[i] = view.addSource(label, device, i)
+		sources[i].serial = d.Serial
+	}
+	if opts.pkg != "" {
+		for i, d := range devices {
+			src := sources[i]
+			src.pkg = newPkgFilter(d.Serial, opts.pkg)
+			if pids := src.pkg.Pids(); len(pids) > 0 {
+				view.notice(src, fmt.Sprintf("Showing %s (pid %s)", opts.pkg, joinInts(pids, ", ")))
+			} else {
+				view.notice(src, fmt.Sprintf("Waiting for %s to start...", opts.pkg))
+			}
+			go src.pkg.poll(stop, func(msg string) { view.notice(src, msg) })
+		}
+	}
+
+	streams := make([]*logcatStream, 0, len(devices))
+	stopStreams := func() {
+		for _, s := range streams {
+			_ = s.cmd.Process.Kill()
+		}
+	}
+	for _, d := range devices {
+		s, err := startLogcatStream(d.Serial, args)
+		if err != nil {
+			stopStreams()
+			return err
+		}
+		streams = append(streams, s)
+	}
+	interrupted := catchInterrupt(stopStreams)
+
+	// A single stream passes through Merge without delay
+	channels := make([]<-chan *logcat.Entry, len(streams))
+	for i, s := range streams {
+		channels[i] = s.entries
+	}
+	view.drain(sources, channels)
+	failed := view.writeFailed()
+	if failed {
+		// Stop the streams and let their scanners finish
+		stopStreams()
+		for _, ch := range channels {
+			go func(ch <-chan *logcat.Entry) {
+				for range ch {
+				}
+			}(ch)
+		}
+	}
+	exportErr := view.finish()
+	if exportErr == nil && view.outErr != nil {
+		exportErr = fmt.Errorf("failed to write logcat: %w", view.outErr)
+	}
+
+	var firstErr error
+	for _, s := range streams {
+		if err := s.cmd.Wait(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if interrupted() || failed {
+		return exportErr
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return exportErr
+}
+
+// runLogcatFiles merges saved logcat files by timestamp, labeling each
+// line with its file name
+func runLogcatFiles(paths []string, args []string, rules logcat.Rules, out io.Writer, formatter *logcat.Formatter) error {
+	_, opts, err := splitLogcatArgs(args)
+	if err != nil {
+		return err
+	}
+	if opts.pkg != "" {
+		return fmt.Errorf("--pkg needs a device to look up the package's processes")
+	}
+	view := newLogcatView(out, formatter, rules)
+	if opts.export != "" {
+		if err := view.export(opts.export); err != nil {
+			return err
+		}
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	sources := make([]*logcatSource, len(paths))
+	channels := make([]<-chan *logcat.Entry, len(paths))
+	for i, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		sources[i] = view.addSource(filepath.Base(p), filepath.Base(p), i)
+		ch := make(chan *logcat.Entry, 256)
+		go scanEntries(logcat.NewEntryScanner(f), ch)
+		channels[i] = ch
+	}
+	view.drain(sources, channels)
+	return view.finish()
+}
+
+// runMergedLogcat runs "logcat --devices" or "logcat --files" from the
+// REPL or normal mode, where the device list is known
+// Output goes to the terminal or, unformatted, to a redirect file
+func runMergedLogcat(devices []Device, cfg *Config, parsed *ParsedCommand) error {
+	if len(parsed.PipeCmd) > 0 {
+		return fmt.Errorf("merged logcat cannot be piped; redirect it to a file instead")
+	}
+	out := commandStdout()
+	formatter := logcat.NewFormatter(useColor(os.Stdout))
+	if parsed.Redirect != RedirectNone {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if parsed.Redirect == RedirectAppend {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(parsed.RedirectFile, flags, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open output file: %w", err)
+		}
+		defer file.Close()
+		out, formatter = teeOutput(file), nil
+	}
+
+	_, opts, err := splitLogcatArgs(parsed.Args)
+	if err != nil {
+		return err
+	}
+	if opts.files != "" {
+		return runLogcatFiles(strings.Split(opts.files, ","), parsed.Args, cfg.logcatRules(), out, formatter)
+	}
+
+	selected, err := selectDevicesByIndex(devices, opts.devices)
+	if err != nil {
+		return err
+	}
+	labels := make([]string, len(selected))
+	for i, d := range selected {
+		labels[i] = deviceLabel(cfg, &d)
+	}
+	return runLogcatDevices(selected, labels, parsed.Args, cfg.logcatRules(), out, formatter)
+}
+
+// selectDevicesByIndex picks devices from a comma-separated list of
+// 1-based indexes, or all of them for "all"
+func selectDevicesByIndex(devices []Device, list string) ([]Device, error) {
+	if list == "all" {
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("no device found")
+		}
+		return devices, nil
+	}
+	var selected []Device
+	for _, part := range strings.Split(list, ",") {
+		idx, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || idx < 1 || idx > len(devices) {
+			return nil, fmt.Errorf("invalid device index: %s", part)
+		}
+		selected = append(selected, devices[idx-1])
+	}
+	return selected, nil
+}
+
+// deviceLabel names a device for tagged output: its alias, else its
+// model, else its serial
+func deviceLabel(cfg *Config, d *Device) string {
+	if cfg != nil {
+		if alias := cfg.Alias(d.Serial); alias != "" {
+			return alias
+		}
+	}
+	if model := devicePropValue(d.Model); model != "" {
+		return model
+	}
+	return d.Serial
+}
+
+// joinInts joins numbers with a separator
+func joinInts(nums []int, sep string) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,95 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
+)
+
+func TestLogcatPipeExportsThroughView(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fixture, err := filepath.Abs(crashLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_LOGCAT", fixture)
+
+	out := filepath.Join(t.TempDir(), "out.json")
+	input := "logcat -d --format ndjson | cp /dev/stdin " + out
+	if err := ExecWithRedirect(&Device{Serial: "fake-1"}, ParseCommand(input), nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("pipe got %q, want NDJSON: %v", lines[0], err)
+	}
+	if first["tag"] != "AndroidRuntime" {
+		t.Errorf("first entry = %v", first)
+	}
+}
+
+func TestLogcatPipeStopsWhenReaderExits(t *testing.T) {
+	t.Setenv("FAKE_LOGCAT_REPEAT", "01-15 10:00:00.000  4321  4321 I Tag: again")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ExecWithRedirect(&Device{Serial: "fake-1"}, ParseCommand("logcat | head -n 1"), nil)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("logcat kept streaming after head exited")
+	}
+}
+
+func TestLogcatViewMutesAndAlerts(t *testing.T) {
+	var rules logcat.Rules
+	for _, line := range []string{"mute tag=chatty", `alert message~"OutOfMemoryError"`} {
+		r, err := logcat.ParseRule(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+
+	var out bytes.Buffer
+	view := newLogcatView(&out, logcat.NewFormatter(false), rules)
+	src := view.addSource("", "fake-1", 0)
+	p := logcat.NewParser()
+	for _, line := range []string{
+		"01-15 10:00:00.000  4321  4321 I chatty  : uid=10123 expire 3 lines",
+		"01-15 10:00:01.000  4321  4321 E chatty  : java.lang.OutOfMemoryError: Failed to allocate",
+		"01-15 10:00:02.000  4321  4321 I App     : still running",
+	} {
+		for _, e := range p.Feed(line) {
+			view.show(src, e)
+		}
+	}
+
+	got := out.String()
+	if strings.Contains(got, "expire 3 lines") {
+		t.Errorf("muted line shown:\n%s", got)
+	}
+	if !strings.Contains(got, "[ALERT] java.lang.OutOfMemoryError: Failed to allocate") {
+		t.Errorf("alert did not fire for the muted line:\n%s", got)
+	}
+	if !strings.Contains(got, "still running") {
+		t.Errorf("unmuted line missing:\n%s", got)
+	}
+}
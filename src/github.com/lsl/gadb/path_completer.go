@@ -0,0 +1,382 @@
+package gadb
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// remoteDirCacheTTL is how long a device directory listing is reused
+// for completion before it is fetched again
+const remoteDirCacheTTL = 5 * time.Second
+
+// pathKind tells which filesystem an argument should be completed against
+type pathKind int
+
+const (
+	pathNone pathKind = iota
+	pathLocal
+	pathRemote
+	// pathRemoteShell is a device path the device's sh parses, so
+	// candidates are escaped
+	pathRemoteShell
+)
+
+// dirCacheEntry is a cached device directory listing
+type dirCacheEntry struct {
+	names   []string
+	fetched time.Time
+}
+
+// remoteDirCache caches device directory listings keyed by serial and
+// directory; expired entries are dropped whenever a listing is stored
+var remoteDirCache = struct {
+	sync.Mutex
+	entries map[string]dirCacheEntry
+}{entries: make(map[string]dirCacheEntry)}
+
+// Shell commands whose arguments are completed as device paths
+var remotePathCommands = map[string]bool{
+	"ls":  true,
+	"cat": true,
+	"rm":  true,
+}
+
+// pathCompleter wraps a prefix completer and adds local/device path
+// completion for push, pull and file-oriented shell commands, and
+// package and component names for am and pm
+type pathCompleter struct {
+	ctx  *Context
+	base readline.AutoCompleter
+	// shellMode is true when the line is typed inside shell mode,
+	// where commands are not prefixed with "shell"
+	shellMode bool
+	// remoteCwd returns the directory relative device paths resolve against
+	remoteCwd func() string
+}
+
+// newPathCompleter creates a path-aware completer around base
+func newPathCompleter(ctx *Context, base readline.AutoCompleter, shellMode bool) *pathCompleter {
+	return &pathCompleter{
+		ctx:       ctx,
+		base:      base,
+		shellMode: shellMode,
+		remoteCwd: func() string { return "/" },
+	}
+}
+
+// Do implements readline.AutoCompleter
+func (p *pathCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	fields, word := splitCompletionLine(string(line[:pos]))
+
+	if candidates, offset, ok := p.completeComponent(fields, word); ok {
+		return candidates, offset
+	}
+	if candidates, offset, ok := p.completePackageArg(fields, word); ok {
+		return candidates, offset
+	}
+
+	kind := p.argKind(fields, word)
+	if kind == pathNone || p.ctx == nil {
+		return p.base.Do(line, pos)
+	}
+	if kind == pathRemote || kind == pathRemoteShell {
+		if p.ctx.CurrentDevice == nil {
+			return nil, 0
+		}
+		return completePath(word, kind == pathRemoteShell, func(dir string) []string {
+			return listRemoteDir(p.ctx.CurrentDevice.Serial, resolveRemotePath(p.remoteCwd(), dir))
+		})
+	}
+	return completePath(word, false, listLocalDir)
+}
+
+// splitCompletionLine splits the text before the cursor into the
+// complete fields and the word being typed; a backslash keeps the next
+// character, such as an escaped space, in the word
+func splitCompletionLine(text string) (fields []string, word string) {
+	var cur strings.Builder
+	escaped := false
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	return fields, cur.String()
+}
+
+// argKind decides how the word following fields should be completed
+func (p *pathCompleter) argKind(fields []string, word string) pathKind {
+	if strings.HasPrefix(word, "-") || len(fields) == 0 {
+		return pathNone
+	}
+
+	cmd := fields[0]
+	args := fields[1:]
+	if !p.shellMode {
+		if cmd == "shell" && len(args) > 0 && remotePathCommands[args[0]] {
+			return pathRemoteShell
+		}
+		if len(args) > 0 && args[len(args)-1] == "--record" {
+			return pathLocal
+		}
+		positional := countPositional(args)
+		switch cmd {
+		case "push":
+			if positional == 0 {
+				return pathLocal
+			}
+			return pathRemote
+		case "pull":
+			if positional == 0 {
+				return pathRemote
+			}
+			return pathLocal
+		case "run-script", "replay", "apkinfo", "watch-install":
+			if positional == 0 {
+				return pathLocal
+			}
+		case "install":
+			return pathLocal
+		case "record":
+			if positional == 1 && args[0] == "on" {
+				return pathLocal
+			}
+		}
+		return pathNone
+	}
+
+	positional := countPositional(args)
+	switch cmd {
+	case "put":
+		if positional == 0 {
+			return pathLocal
+		}
+		return pathRemote
+	case "get":
+		if positional == 0 {
+			return pathRemote
+		}
+		return pathLocal
+	case "lcd", "lls":
+		return pathLocal
+	case "source":
+		if positional == 0 {
+			return pathLocal
+		}
+		return pathNone
+	case "edit":
+		return pathRemote
+	}
+	if remotePathCommands[cmd] {
+		return pathRemoteShell
+	}
+	return pathNone
+}
+
+// countPositional counts arguments that are not options
+func countPositional(args []string) int {
+	n := 0
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			n++
+		}
+	}
+	return n
+}
+
+// completePath completes word using the listing function for its directory
+// Directories complete with a trailing slash, files with a trailing space
+// With escape, word is shell-escaped text and candidates are escaped too
+func completePath(word string, escape bool, list func(dir string) []string) ([][]rune, int) {
+	dir, typed := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dir, typed = word[:i+1], word[i+1:]
+	}
+	prefix := typed
+	if escape {
+		dir, prefix = shellUnescape(dir), shellUnescape(typed)
+	}
+
+	var candidates [][]rune
+	for _, name := range list(dir) {
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		base := strings.TrimSuffix(name, "/")
+		if !strings.HasPrefix(base, prefix) {
+			continue
+		}
+		suffix := strings.TrimSuffix(name[len(prefix):], "@")
+		if escape {
+			suffix = shellEscape(suffix)
+		}
+		if !strings.HasSuffix(name, "/") && !strings.HasSuffix(name, "@") {
+			suffix += " "
+		}
+		candidates = append(candidates, []rune(suffix))
+	}
+	return candidates, len([]rune(typed))
+}
+
+// shellSpecial are the characters shellEscape puts a backslash before
+const shellSpecial = " \t\\'\"`$&|;<>()*?[]{}!#~"
+
+// shellEscape backslash-escapes the characters sh would interpret; the
+// escaping is per character so an escaped prefix plus the escaped rest
+// equals the escaped whole
+func shellEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(shellSpecial, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// shellUnescape removes the backslashes of backslash-escaped text
+func shellUnescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// listLocalDir lists a local directory for completion
+func listLocalDir(dir string) []string {
+	path := dir
+	if path == "" {
+		path = "."
+	}
+	path = expandHome(path)
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		} else if e.Type()&os.ModeSymlink != 0 {
+			if fi, err := os.Stat(filepath.Join(path, name)); err == nil && fi.IsDir() {
+				name += "/"
+			}
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolveRemotePath resolves a device path against a working directory
+func resolveRemotePath(cwd, p string) string {
+	if p == "" {
+		return cwd
+	}
+	if strings.HasPrefix(p, "/") {
+		return p
+	}
+	return strings.TrimSuffix(cwd, "/") + "/" + p
+}
+
+// listRemoteDir lists a device directory for completion, using the
+// sync protocol when available and falling back to "ls" otherwise
+// Directories are suffixed with "/" and symlinks with "@" since a link
+// may point to either a file or a directory
+func listRemoteDir(serial, dir string) []string {
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	key := serial + "\x00" + dir
+
+	remoteDirCache.Lock()
+	cached, ok := remoteDirCache.entries[key]
+	remoteDirCache.Unlock()
+	if ok && time.Since(cached.fetched) < remoteDirCacheTTL {
+		return cached.names
+	}
+
+	names, err := listRemoteDirSync(serial, dir)
+	if err != nil {
+		names = listRemoteDirShell(serial, dir)
+	}
+	sort.Strings(names)
+
+	remoteDirCache.Lock()
+	now := time.Now()
+	for k, e := range remoteDirCache.entries {
+		if now.Sub(e.fetched) >= remoteDirCacheTTL {
+			delete(remoteDirCache.entries, k)
+		}
+	}
+	remoteDirCache.entries[key] = dirCacheEntry{names: names, fetched: now}
+	remoteDirCache.Unlock()
+	return names
+}
+
+// listRemoteDirSync lists a device directory with the sync LIST request
+func listRemoteDirSync(serial, dir string) ([]string, error) {
+	entries, err := SyncList(serial, dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		switch {
+		case e.IsDir():
+			names = append(names, e.Name+"/")
+		case e.IsLink():
+			names = append(names, e.Name+"@")
+		default:
+			names = append(names, e.Name)
+		}
+	}
+	return names, nil
+}
+
+// listRemoteDirShell lists a device directory by running ls over adb shell
+func listRemoteDirShell(serial, dir string) []string {
+	cmd := exec.Command("adb", "-s", serial, "shell", "ls", "-a", "-p", shellQuote(dir))
+	setupCommand(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		name := strings.TrimRight(string(line), "\r")
+		if name == "" || name == "./" || name == "../" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,126 @@
+package gadb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCompletePath(t *testing.T) {
+	listing := map[string][]string{
+		"":        {"Documents/", "notes.txt", "My File.txt", ".hidden", "link@"},
+		"sdcard/": {"DCIM/", "Download/"},
+	}
+	list := func(dir string) []string { return listing[dir] }
+	tests := []struct {
+		word       string
+		escape     bool
+		candidates []string
+		offset     int
+	}{
+		{"no", false, []string{"tes.txt "}, 2},
+		{"", false, []string{"Documents/", "notes.txt ", "My File.txt ", "link"}, 0},
+		{".", false, []string{"hidden "}, 1},
+		{"sdcard/D", false, []string{"CIM/", "ownload/"}, 1},
+		{"My", true, []string{`\ File.txt `}, 2},
+		{`My\ F`, true, []string{"ile.txt "}, 5},
+	}
+	for _, tt := range tests {
+		got, offset := completePath(tt.word, tt.escape, list)
+		var candidates []string
+		for _, c := range got {
+			candidates = append(candidates, string(c))
+		}
+		if !reflect.DeepEqual(candidates, tt.candidates) || offset != tt.offset {
+			t.Errorf("completePath(%q, %v) = %q, %d, want %q, %d", tt.word, tt.escape, candidates, offset, tt.candidates, tt.offset)
+		}
+	}
+}
+
+func TestArgKind(t *testing.T) {
+	normal := &pathCompleter{}
+	shell := &pathCompleter{shellMode: true}
+	tests := []struct {
+		p    *pathCompleter
+		line string
+		want pathKind
+	}{
+		{normal, "push ", pathLocal},
+		{normal, "push app.apk ", pathRemote},
+		{normal, "pull ", pathRemote},
+		{normal, "pull /sdcard/a ", pathLocal},
+		{normal, "push -", pathNone},
+		{normal, "shell ls ", pathRemoteShell},
+		{normal, `shell cat My\ Fi`, pathRemoteShell},
+		{normal, "shell ps ", pathNone},
+		{normal, "install -r ", pathLocal},
+		{normal, "logcat --record ", pathLocal},
+		{normal, "record on ", pathLocal},
+		{normal, "record off ", pathNone},
+		{shell, "put ", pathLocal},
+		{shell, "put a.txt ", pathRemote},
+		{shell, "edit ", pathRemote},
+		{shell, "source ", pathLocal},
+		{shell, "source a.sh ", pathNone},
+		{shell, "ls ", pathRemoteShell},
+	}
+	for _, tt := range tests {
+		fields, word := splitCompletionLine(tt.line)
+		if got := tt.p.argKind(fields, word); got != tt.want {
+			t.Errorf("argKind(%q, shell mode %v) = %v, want %v", tt.line, tt.p.shellMode, got, tt.want)
+		}
+	}
+}
+
+func TestIsPmPackageArg(t *testing.T) {
+	normal := &pathCompleter{}
+	shell := &pathCompleter{shellMode: true}
+	tests := []struct {
+		p    *pathCompleter
+		line string
+		want bool
+	}{
+		{normal, "shell pm clear ", true},
+		{normal, "shell pm uninstall -k ", true},
+		{normal, "shell pm list ", false},
+		{normal, "pm clear ", false},
+		{shell, "pm suspend ", true},
+		{shell, "pm install ", false},
+	}
+	for _, tt := range tests {
+		fields, _ := splitCompletionLine(tt.line)
+		if got := tt.p.isPmPackageArg(fields); got != tt.want {
+			t.Errorf("isPmPackageArg(%q, shell mode %v) = %v, want %v", tt.line, tt.p.shellMode, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRemotePath(t *testing.T) {
+	tests := []struct{ cwd, path, want string }{
+		{"/sdcard", "", "/sdcard"},
+		{"/sdcard", "/data/local/tmp", "/data/local/tmp"},
+		{"/sdcard", "DCIM/", "/sdcard/DCIM/"},
+		{"/", "sdcard", "/sdcard"},
+	}
+	for _, tt := range tests {
+		if got := resolveRemotePath(tt.cwd, tt.path); got != tt.want {
+			t.Errorf("resolveRemotePath(%q, %q) = %q, want %q", tt.cwd, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParsePackageComponents(t *testing.T) {
+	out, err := os.ReadFile("testdata/dumpsys_package.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parsePackageComponents(string(out), "com.example.app")
+	want := &PackageComponents{
+		Activities: []string{"com.example.app/com.example.app.MainActivity", "com.example.app/com.example.app.share.ShareActivity"},
+		Services:   []string{"com.example.app/com.example.app.sync.SyncService"},
+		Receivers:  []string{"com.example.app/com.example.sync.BootReceiver"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePackageComponents = %+v, want %+v", got, want)
+	}
+}
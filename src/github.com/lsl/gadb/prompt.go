@@ -0,0 +1,194 @@
+package gadb
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deviceInfoTTL is how long fetched device properties are shown
+// before a background refresh is started
+const deviceInfoTTL = 30 * time.Second
+
+// deviceInfoTimeout bounds a single background property fetch
+const deviceInfoTimeout = 5 * time.Second
+
+// disconnectedMarker is shown when the current device goes away
+const disconnectedMarker = "\033[31m(disconnected)\033[0m"
+
+// ANSI color names usable as prompt template fields
+var promptColors = map[string]string{
+	"reset":   "\033[0m",
+	"bold":    "\033[1m",
+	"dim":     "\033[2m",
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+	"white":   "\033[37m",
+}
+
+// promptFieldRe matches a template field such as {sdk} or {alias|model}
+var promptFieldRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// renderPrompt expands a prompt template
+// {name} is replaced by the named field, {a|b} by the first non-empty
+// of a and b, and color names such as {red} or {reset} by ANSI codes
+// Unknown fields render as empty strings
+func renderPrompt(tmpl string, fields map[string]string) string {
+	return promptFieldRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		if code, ok := promptColors[name]; ok {
+			return code
+		}
+		for _, alt := range strings.Split(name, "|") {
+			if v := fields[strings.TrimSpace(alt)]; v != "" {
+				return v
+			}
+		}
+		return ""
+	})
+}
+
+// deviceInfo holds device properties that are expensive to query
+type deviceInfo struct {
+	SDK     string
+	Release string
+	Battery string
+	fetched time.Time
+	loading bool
+}
+
+// deviceInfoCache holds device properties fetched in the background
+// so rendering the prompt never waits on adb
+type deviceInfoCache struct {
+	mu       sync.Mutex
+	infos    map[string]*deviceInfo
+	onUpdate func()
+}
+
+// newDeviceInfoCache creates an empty cache
+func newDeviceInfoCache() *deviceInfoCache {
+	return &deviceInfoCache{infos: make(map[string]*deviceInfo)}
+}
+
+// setOnUpdate sets the function run after each successful refresh
+func (c *deviceInfoCache) setOnUpdate(f func()) {
+	c.mu.Lock()
+	c.onUpdate = f
+	c.mu.Unlock()
+}
+
+// get returns the cached properties of a device, starting a background
+// refresh if they are missing or stale
+func (c *deviceInfoCache) get(serial string) deviceInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, ok := c.infos[serial]
+	if !ok {
+		info = &deviceInfo{}
+		c.infos[serial] = info
+	}
+	if !info.loading && time.Since(info.fetched) > deviceInfoTTL {
+		info.loading = true
+		go c.refresh(serial)
+	}
+	return *info
+}
+
+// refresh fetches device properties and stores them in the cache
+func (c *deviceInfoCache) refresh(serial string) {
+	ctx, cancel := context.WithTimeout(context.Background(), deviceInfoTimeout)
+	defer cancel()
+
+	script := "getprop ro.build.version.sdk; getprop ro.build.version.release; dumpsys battery | grep level"
+	cmd := exec.CommandContext(ctx, "adb", "-s", serial, "shell", script)
+	setupCommand(cmd)
+	out, err := cmd.Output()
+
+	c.mu.Lock()
+	info := c.infos[serial]
+	info.loading = false
+	info.fetched = time.Now()
+	if err == nil {
+		info.SDK, info.Release, info.Battery = parseDeviceInfo(string(out))
+	}
+	onUpdate := c.onUpdate
+	c.mu.Unlock()
+
+	if err == nil && onUpdate != nil {
+		onUpdate()
+	}
+}
+
+// parseDeviceInfo parses the output of the device info script:
+// sdk and release on the first two lines, then the battery dump
+func parseDeviceInfo(out string) (sdk, release, battery string) {
+	lines := strings.Split(strings.ReplaceAll(out, "\r", ""), "\n")
+	if len(lines) > 0 {
+		sdk = strings.TrimSpace(lines[0])
+	}
+	if len(lines) > 1 {
+		release = strings.TrimSpace(lines[1])
+	}
+	for _, line := range lines[min(2, len(lines)):] {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "level:") {
+			battery = strings.TrimSpace(strings.TrimPrefix(line, "level:"))
+		}
+	}
+	return sdk, release, battery
+}
+
+// promptFields collects the values available to the prompt template
+func (c *Context) promptFields(s *promptState) map[string]string {
+	d := s.device
+	fields := map[string]string{
+		"serial":  d.Serial,
+		"alias":   c.Config.Alias(d.Serial),
+		"model":   devicePropValue(d.Model),
+		"product": devicePropValue(d.Product),
+		"device":  devicePropValue(d.Device),
+		"devices": strconv.Itoa(s.devices),
+	}
+	if s.lastExit != 0 {
+		fields["exit_status"] = strconv.Itoa(s.lastExit)
+	}
+
+	state, known := "device", false
+	if c.Tracker != nil {
+		state, known = c.Tracker.State(d.Serial)
+	}
+	switch {
+	case !known:
+		fields["state"] = "device"
+	case state == "":
+		fields["state"] = disconnectedMarker
+	default:
+		fields["state"] = state
+	}
+
+	if c.info != nil && fields["state"] == "device" {
+		info := c.info.get(d.Serial)
+		fields["sdk"] = info.SDK
+		fields["release"] = info.Release
+		fields["battery"] = info.Battery
+	}
+	return fields
+}
+
+// devicePropValue strips the "key:" prefix that "adb devices -l" puts
+// in front of product, model and device values
+func devicePropValue(v string) string {
+	if i := strings.Index(v, ":"); i >= 0 {
+		return v[i+1:]
+	}
+	return v
+}
@@ -0,0 +1,53 @@
+package gadb
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	fields := map[string]string{"serial": "emulator-5554", "model": "Pixel_7", "sdk": "34", "alias": ""}
+	tests := []struct{ tmpl, want string }{
+		{defaultPrompt, "[GADB] emulator-5554 > "},
+		{"{alias|model} sdk{sdk}> ", "Pixel_7 sdk34> "},
+		{"{ alias | serial }> ", "emulator-5554> "},
+		{"{red}{battery}%{reset}", "\033[31m%\033[0m"},
+		{"{unknown}{", "{"},
+	}
+	for _, tt := range tests {
+		if got := renderPrompt(tt.tmpl, fields); got != tt.want {
+			t.Errorf("renderPrompt(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestGetPromptUsesPublishedState(t *testing.T) {
+	ctx := &Context{Config: DefaultConfig()}
+	if got := ctx.GetPrompt(); got != "[GADB] > " {
+		t.Errorf("prompt before publishing = %q", got)
+	}
+	ctx.AvailableDevices = []Device{{Serial: "fake-1"}, {Serial: "fake-2"}}
+	ctx.CurrentDevice = &ctx.AvailableDevices[0]
+	ctx.Config.Prompt = "{serial} {devices} {exit_status}> "
+	ctx.publishPrompt()
+
+	// Redraws from other goroutines only read the published copy
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx.GetPrompt()
+		}()
+	}
+	ctx.CurrentDevice = &ctx.AvailableDevices[1]
+	ctx.LastExitCode = 2
+	wg.Wait()
+	if got := ctx.GetPrompt(); got != "fake-1 2 > " {
+		t.Errorf("prompt = %q, want the published fake-1 state", got)
+	}
+	ctx.publishPrompt()
+	if got := ctx.GetPrompt(); got != "fake-2 2 2> " {
+		t.Errorf("prompt = %q after publishing", got)
+	}
+}
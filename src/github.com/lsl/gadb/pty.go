@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+
+	"gadb/src/github.com/lsl/gadb/logcat"
 )
 
 // IsInteractiveCommand checks if the given command requires PTY support
@@ -16,20 +18,40 @@ func IsInteractiveCommand(args []string) bool {
 	interactiveCmds := map[string]bool{
 		"shell":  true,
 		"sh":     true,
-		"logcat": true, // logcat needs PTY for proper Ctrl+C handling
+		"logcat": true, // formats gadb does not parse go through the PTY
 	}
 	return interactiveCmds[cmd]
 }
 
 // ExecCommand executes a command on the specified device
 // Automatically uses PTY for interactive commands
-func ExecCommand(device *Device, args []string) error {
+// cfg supplies the logcat rules of logcat views
+func ExecCommand(device *Device, args []string, cfg *Config) error {
 	if device == nil {
 		return fmt.Errorf("no device specified")
 	}
 
+	// Installed apps browser
+	if len(args) > 0 && args[0] == "apps" {
+		return runAppsCommand(device.Serial, args[1:], commandStdout())
+	}
+
+	// Install, after checking the APK suits the device
+	if len(args) > 0 && args[0] == "install" {
+		return runInstallCommand(device, args[1:])
+	}
+
+	// Parse and format logcat streams
+	if parsesLogcat(args) || hasLogcatViewFlags(args) {
+		return runLogcatView(device, args, cfg.logcatRules(), commandStdout(), logcat.NewFormatter(useColor(os.Stdout)))
+	}
+
 	if IsInteractiveCommand(args) {
-		// Use PTY for interactive commands
+		// Use PTY for interactive commands, recorded on request
+		args, record := extractRecordFlag(args)
+		if record != "" {
+			return execWithRecording(device.Serial, args, record)
+		}
 		return ExecWithPTY(device.Serial, args)
 	}
 
@@ -41,17 +63,17 @@ func ExecCommand(device *Device, args []string) error {
 	setupCommand(cmd)
 
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = commandStdout()
+	cmd.Stderr = commandStderr()
 
-	fmt.Printf("adb %s\n", adbArgs)
+	fmt.Fprintf(commandStdout(), "adb %s\n", adbArgs)
 	return cmd.Run()
 }
 
 // ExecCommandOnAll executes a command on all available devices
-func ExecCommandOnAll(devices []Device, args []string) error {
+func ExecCommandOnAll(devices []Device, args []string, cfg *Config) error {
 	for _, d := range devices {
-		if err := ExecCommand(&d, args); err != nil {
+		if err := ExecCommand(&d, args, cfg); err != nil {
 			return err
 		}
 	}
@@ -3,67 +3,13 @@
 package gadb
 
 import (
-	"fmt"
-	"io"
 	"os"
 	"os/exec"
-	"os/signal"
+	"syscall"
 
-	"github.com/creack/pty"
 	"golang.org/x/sys/unix"
 )
 
-// ExecWithPTY executes an adb command with PTY support for full interactivity
-// This is needed for commands like 'adb shell' that require a terminal
-func ExecWithPTY(deviceSerial string, args []string) error {
-	// Build adb command with device serial
-	adbArgs := append([]string{"-s", deviceSerial}, args...)
-	cmd := exec.Command("adb", adbArgs...)
-
-	// Start PTY
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		return fmt.Errorf("failed to start PTY: %w", err)
-	}
-	// Make sure to close the pty at the end
-	defer func() { _ = ptmx.Close() }()
-
-	// Handle terminal size changes
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, unix.SIGWINCH)
-	go func() {
-		for range ch {
-			_ = pty.InheritSize(os.Stdin, ptmx)
-		}
-	}()
-	defer signal.Stop(ch)
-
-	// Initial terminal size
-	_ = pty.InheritSize(os.Stdin, ptmx)
-
-	// Set stdin to raw mode
-	oldState, err := makeRaw(os.Stdin)
-	if err != nil {
-		return fmt.Errorf("failed to set terminal: %w", err)
-	}
-	defer restoreTerminal(os.Stdin, oldState)
-
-	// Copy stdin to PTY and PTY to stdout
-	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
-
-	_, err = io.Copy(os.Stdout, ptmx)
-	if err != nil {
-		return fmt.Errorf("error copying output: %w", err)
-	}
-
-	// Get command exit status
-	if err := cmd.Wait(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // makeRaw puts the terminal into raw mode (macOS version)
 func makeRaw(f *os.File) (*unix.Termios, error) {
 	fd := int(f.Fd())
@@ -102,3 +48,9 @@ func restoreTerminal(f *os.File, state *unix.Termios) error {
 func setupCommand(cmd *exec.Cmd) {
 	// macOS handles signals properly by default
 }
+
+// detachCommand starts a command in its own process group, so Ctrl+C
+// in the terminal does not reach it
+func detachCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
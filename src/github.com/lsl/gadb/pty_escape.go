@@ -0,0 +1,151 @@
+package gadb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ptyEscapeChar starts an escape sequence at the beginning of a line
+const ptyEscapeChar = '~'
+
+// ptyDetachKey (Ctrl+]) leaves the PTY session from anywhere in a line
+const ptyDetachKey = 0x1d
+
+// ErrPTYDetached is returned when the user leaves a PTY session with
+// an escape sequence while the remote process is still running
+var ErrPTYDetached = errors.New("detached from PTY session")
+
+// PTYSwitchError is returned when the user asks to continue in a PTY
+// session on another device; Index is the 1-based device number
+type PTYSwitchError struct {
+	Index int
+}
+
+func (e *PTYSwitchError) Error() string {
+	return fmt.Sprintf("switch to device %d", e.Index)
+}
+
+// escapeAction is what an escape sequence asks the PTY session to do
+type escapeAction int
+
+const (
+	escapeNone escapeAction = iota
+	escapeDetach
+	escapeSwitch
+)
+
+// ptyEscapeHelp is shown for ~? in raw mode, so lines end in \r\n
+const ptyEscapeHelp = "\r\nSupported escape sequences (at the start of a line):\r\n" +
+	"  ~.   - leave the PTY session\r\n" +
+	"  ~1-9 - switch to the PTY session of device N\r\n" +
+	"  ~B   - send a break (Ctrl+C) to the remote process\r\n" +
+	"  ~?   - show this help\r\n" +
+	"  ~~   - send a literal ~\r\n" +
+	"  Ctrl+] leaves the session from anywhere\r\n"
+
+// escapeFilter scans keyboard input for ssh-style escape sequences
+type escapeFilter struct {
+	// atLineStart is true when the next byte starts a new line
+	atLineStart bool
+	// pending is true after an escape character at line start
+	pending bool
+	// help receives the escape help text
+	help io.Writer
+}
+
+// newEscapeFilter creates a filter positioned at the start of a line
+func newEscapeFilter(help io.Writer) *escapeFilter {
+	return &escapeFilter{atLineStart: true, help: help}
+}
+
+// Feed filters a chunk of input, returning the bytes to forward to the
+// remote process and any session action that was requested
+// Input after an action is discarded
+func (f *escapeFilter) Feed(in []byte) (out []byte, action escapeAction, index int) {
+	out = make([]byte, 0, len(in))
+	for _, b := range in {
+		if b == ptyDetachKey {
+			return out, escapeDetach, 0
+		}
+
+		if f.pending {
+			f.pending = false
+			switch {
+			case b == '.':
+				return out, escapeDetach, 0
+			case b >= '1' && b <= '9':
+				return out, escapeSwitch, int(b - '0')
+			case b == '?':
+				if f.help != nil {
+					_, _ = io.WriteString(f.help, ptyEscapeHelp)
+				}
+				f.atLineStart = true
+				continue
+			case b == 'B':
+				// The remote PTY turns the interrupt character into SIGINT
+				out = append(out, 0x03)
+				f.atLineStart = false
+				continue
+			case b == ptyEscapeChar:
+				out = append(out, ptyEscapeChar)
+				f.atLineStart = false
+				continue
+			default:
+				// Not an escape: send the held escape character too
+				out = append(out, ptyEscapeChar)
+			}
+		} else if b == ptyEscapeChar && f.atLineStart {
+			f.pending = true
+			continue
+		}
+
+		out = append(out, b)
+		f.atLineStart = b == '\r' || b == '\n'
+	}
+	return out, escapeNone, 0
+}
+
+// escapeError converts an escape action into the error ExecWithPTY returns
+func escapeError(action escapeAction, index int) error {
+	switch action {
+	case escapeDetach:
+		return ErrPTYDetached
+	case escapeSwitch:
+		return &PTYSwitchError{Index: index}
+	}
+	return nil
+}
+
+// forwardStdin copies keyboard input from in to the PTY through an
+// escape filter, reporting the first requested action on actions
+// done is closed once the forwarder stops reading; callers must cancel
+// in and wait for done so no keystroke is consumed after the session
+func forwardStdin(ptmx io.Writer, in io.Reader, help io.Writer) (actions <-chan error, done <-chan struct{}) {
+	actionCh := make(chan error, 1)
+	doneCh := make(chan struct{})
+	filter := newEscapeFilter(help)
+	go func() {
+		defer close(doneCh)
+		buf := make([]byte, 1024)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 {
+				out, action, index := filter.Feed(buf[:n])
+				if len(out) > 0 {
+					if _, werr := ptmx.Write(out); werr != nil {
+						return
+					}
+				}
+				if action != escapeNone {
+					actionCh <- escapeError(action, index)
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return actionCh, doneCh
+}
@@ -0,0 +1,142 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// ExecWithPTY executes an adb command with PTY support for full interactivity
+// This is needed for commands like 'adb shell' that require a terminal
+// Escape sequences typed at line start (see pty_escape.go) end the session
+// early with ErrPTYDetached or a *PTYSwitchError; otherwise the remote
+// process's exit status is returned as an *exec.ExitError
+func ExecWithPTY(deviceSerial string, args []string) error {
+	return runPTYSession(os.Stdin, commandStdout(), deviceSerial, args)
+}
+
+// runPTYSession runs adb in a PTY wired to the given terminal
+// stdin must be a terminal; it is put in raw mode for the session
+// and restored on every exit path
+func runPTYSession(stdin *os.File, stdout io.Writer, deviceSerial string, args []string) error {
+	// Build adb command with device serial
+	adbArgs := append([]string{"-s", deviceSerial}, args...)
+	cmd := exec.Command("adb", adbArgs...)
+
+	// Start PTY
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start PTY: %w", err)
+	}
+	// Make sure to close the pty at the end
+	defer func() { _ = ptmx.Close() }()
+
+	// Handle terminal size changes and signals sent to gadb itself;
+	// keyboard Ctrl+C and Ctrl+Z arrive as bytes in raw mode
+	sigCh := make(chan os.Signal, 4)
+	signal.Notify(sigCh, unix.SIGWINCH, unix.SIGINT, unix.SIGTERM, unix.SIGHUP, unix.SIGTSTP)
+	defer signal.Stop(sigCh)
+
+	// Record the session if a recording is active
+	rec := activeRecorder()
+	resize := func() {
+		_ = pty.InheritSize(stdin, ptmx)
+		if rec != nil {
+			if rows, cols, err := pty.Getsize(stdin); err == nil {
+				rec.Resize(cols, rows)
+			}
+		}
+	}
+
+	// Initial terminal size
+	resize()
+
+	// Set stdin to raw mode
+	oldState, err := makeRaw(stdin)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("failed to set terminal: %w", err)
+	}
+	defer restoreTerminal(stdin, oldState)
+
+	// Copy stdin to PTY through a cancelable reader, so the forwarder
+	// is gone before the REPL reads from the terminal again
+	in, err := newCancelReader(stdin)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	defer in.Close()
+	actions, forwarderDone := forwardStdin(ptmx, in, stdout)
+	defer func() {
+		in.Cancel()
+		<-forwarderDone
+	}()
+
+	// Copy PTY to stdout
+	output := stdout
+	if rec != nil {
+		output = io.MultiWriter(stdout, rec)
+	}
+	copyDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(output, ptmx)
+		copyDone <- err
+	}()
+
+	for {
+		select {
+		case escErr := <-actions:
+			// Leave the session: stop the remote side
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return escErr
+
+		case err := <-copyDone:
+			// Output ended, so the remote process has exited
+			waitErr := cmd.Wait()
+			if err != nil && !isPTYClosed(err) {
+				return fmt.Errorf("error copying output: %w", err)
+			}
+			return waitErr
+
+		case sig := <-sigCh:
+			switch sig {
+			case unix.SIGWINCH:
+				resize()
+			case unix.SIGINT:
+				// Sent from outside the terminal: pass it on
+				_ = cmd.Process.Signal(sig)
+			case unix.SIGTSTP:
+				// Suspend gadb with a usable terminal, resume in raw mode
+				_ = restoreTerminal(stdin, oldState)
+				_ = unix.Kill(os.Getpid(), unix.SIGSTOP)
+				if _, err := makeRaw(stdin); err == nil {
+					resize()
+				}
+			default:
+				// SIGTERM, SIGHUP: end the session cleanly
+				_ = cmd.Process.Signal(sig)
+				_ = cmd.Wait()
+				return fmt.Errorf("PTY session terminated by %v", sig)
+			}
+		}
+	}
+}
+
+// isPTYClosed reports whether a PTY read error just means the other
+// side has gone away; Linux returns EIO once the child exits
+func isPTYClosed(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, os.ErrClosed)
+}
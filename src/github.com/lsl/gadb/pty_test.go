@@ -0,0 +1,163 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPTYReportsExitStatus(t *testing.T) {
+	term := newFakeTerminal(t)
+	var out syncBuffer
+
+	err := waitForSession(t, runPTYAsync(term, &out, "shell", "echo hello; exit 3"))
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("got error %v, want exit status 3", err)
+	}
+	if !strings.Contains(out.String(), "hello") {
+		t.Errorf("output %q does not contain hello", out.String())
+	}
+}
+
+func TestPTYReleasesStdinAfterExit(t *testing.T) {
+	term := newFakeTerminal(t)
+	var out syncBuffer
+
+	if err := waitForSession(t, runPTYAsync(term, &out, "shell", "exit 0")); err != nil {
+		t.Fatalf("session failed: %v", err)
+	}
+
+	// The next line typed must reach the next reader, not a leftover forwarder
+	term.typeKeys(t, "next\n")
+	got := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := term.tty.Read(buf)
+		got <- string(buf[:n])
+	}()
+	select {
+	case line := <-got:
+		if !strings.HasPrefix(line, "next") {
+			t.Errorf("read %q, want next", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("keystrokes were swallowed after the session ended")
+	}
+}
+
+func TestPTYEscapeDetach(t *testing.T) {
+	term := newFakeTerminal(t)
+	var out syncBuffer
+
+	done := runPTYAsync(term, &out, "shell", "sleep 0.3; echo ready; sleep 30")
+	waitForOutput(t, &out, "ready")
+	term.typeKeys(t, "~.")
+
+	if err := waitForSession(t, done); !errors.Is(err, ErrPTYDetached) {
+		t.Fatalf("got %v, want ErrPTYDetached", err)
+	}
+}
+
+func TestPTYEscapeSwitch(t *testing.T) {
+	term := newFakeTerminal(t)
+	var out syncBuffer
+
+	done := runPTYAsync(term, &out, "shell", "sleep 0.3; echo ready; sleep 30")
+	waitForOutput(t, &out, "ready")
+	term.typeKeys(t, "~2")
+
+	var sw *PTYSwitchError
+	if err := waitForSession(t, done); !errors.As(err, &sw) || sw.Index != 2 {
+		t.Fatalf("got %v, want switch to device 2", err)
+	}
+}
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []string
+		output string
+		action escapeAction
+		index  int
+	}{
+		{"plain text", []string{"ls -l\r"}, "ls -l\r", escapeNone, 0},
+		{"tilde mid-line", []string{"cd ~/x\r"}, "cd ~/x\r", escapeNone, 0},
+		{"literal tilde", []string{"~~"}, "~", escapeNone, 0},
+		{"not an escape", []string{"~x"}, "~x", escapeNone, 0},
+		{"detach", []string{"~."}, "", escapeDetach, 0},
+		{"detach after line", []string{"ls\r", "~."}, "ls\r", escapeDetach, 0},
+		{"detach key", []string{"ab\x1d"}, "ab", escapeDetach, 0},
+		{"switch", []string{"~3"}, "", escapeSwitch, 3},
+		{"split sequence", []string{"\r~", "2"}, "\r", escapeSwitch, 2},
+		{"break", []string{"~B"}, "\x03", escapeNone, 0},
+		{"break mid-line", []string{"a~B"}, "a~B", escapeNone, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newEscapeFilter(nil)
+			var output string
+			var action escapeAction
+			var index int
+			for _, chunk := range tt.input {
+				var out []byte
+				out, action, index = f.Feed([]byte(chunk))
+				output += string(out)
+			}
+			if output != tt.output || action != tt.action || index != tt.index {
+				t.Errorf("got (%q, %d, %d), want (%q, %d, %d)",
+					output, action, index, tt.output, tt.action, tt.index)
+			}
+		})
+	}
+}
+
+func TestPTYRecording(t *testing.T) {
+	term := newFakeTerminal(t)
+	path := filepath.Join(t.TempDir(), "session.cast")
+	rec, err := NewCastRecorder(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := setActiveRecorder(rec)
+	defer setActiveRecorder(previous)
+
+	var out syncBuffer
+	if err := waitForSession(t, runPTYAsync(term, &out, "shell", "printf 'caf\\303\\251\\n'")); err != nil {
+		t.Fatalf("session failed: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 {
+		t.Fatalf("bad header %q: %v", lines[0], err)
+	}
+	var output string
+	for _, line := range lines[1:] {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil || len(event) != 3 {
+			t.Fatalf("bad event %q: %v", line, err)
+		}
+		if event[1] == "o" {
+			output += event[2].(string)
+		}
+	}
+	if !strings.Contains(output, "café") {
+		t.Errorf("recorded output %q does not contain café", output)
+	}
+}
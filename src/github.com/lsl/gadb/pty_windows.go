@@ -3,8 +3,10 @@
 package gadb
 
 import (
+	"io"
 	"os"
 	"os/exec"
+	"syscall"
 )
 
 // ExecWithPTY executes an adb command with PTY support for full interactivity
@@ -16,8 +18,12 @@ func ExecWithPTY(deviceSerial string, args []string) error {
 
 	// Windows has limited PTY support, use regular execution with stdin/stdout
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = commandStdout()
+	cmd.Stderr = commandStderr()
+	if rec := activeRecorder(); rec != nil {
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, rec)
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, rec)
+	}
 
 	return cmd.Run()
 }
@@ -26,3 +32,9 @@ func ExecWithPTY(deviceSerial string, args []string) error {
 func setupCommand(cmd *exec.Cmd) {
 	// No special setup needed on Windows
 }
+
+// detachCommand starts a command in a new process group, so Ctrl+C in
+// the console does not reach it
+func detachCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -0,0 +1,364 @@
+package gadb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Terminal size written to a recording when the real size is unknown
+const (
+	defaultCastWidth  = 80
+	defaultCastHeight = 24
+)
+
+// castHeader is the first line of an asciicast v2 file
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// CastRecorder writes PTY output and resize events to an asciicast v2
+// file (https://docs.asciinema.org/manual/asciicast/v2/)
+// The header is written with the first event, so the first Resize
+// call determines the recorded terminal size
+type CastRecorder struct {
+	mu            sync.Mutex
+	f             *os.File
+	w             *bufio.Writer
+	path          string
+	title         string
+	start         time.Time
+	width, height int
+	headerWritten bool
+	// partial holds an incomplete UTF-8 sequence from the last write
+	partial []byte
+}
+
+// NewCastRecorder creates a recording file
+func NewCastRecorder(path, title string) (*CastRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	return &CastRecorder{
+		f:      f,
+		w:      bufio.NewWriter(f),
+		path:   path,
+		title:  title,
+		start:  time.Now(),
+		width:  defaultCastWidth,
+		height: defaultCastHeight,
+	}, nil
+}
+
+// Path returns the recording file path
+func (r *CastRecorder) Path() string {
+	return r.path
+}
+
+// Write records p as terminal output; it implements io.Writer so the
+// recorder can be teed with the real terminal
+func (r *CastRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	// Keep a trailing incomplete UTF-8 sequence for the next write so
+	// multi-byte characters split across reads are not mangled
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.partial = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.writeEventLocked("o", string(data[:cut]))
+	}
+	return len(p), nil
+}
+
+// Resize records a terminal size change
+func (r *CastRecorder) Resize(width, height int) {
+	if width <= 0 || height <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.headerWritten {
+		r.width, r.height = width, height
+		return
+	}
+	r.writeEventLocked("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Close flushes and closes the recording
+func (r *CastRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.partial) > 0 {
+		r.writeEventLocked("o", string(r.partial))
+		r.partial = nil
+	}
+	r.writeHeaderLocked()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// writeHeaderLocked writes the header once; r.mu must be held
+func (r *CastRecorder) writeHeaderLocked() {
+	if r.headerWritten {
+		return
+	}
+	r.headerWritten = true
+	header := castHeader{
+		Version:   2,
+		Width:     r.width,
+		Height:    r.height,
+		Timestamp: r.start.Unix(),
+		Title:     r.title,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	}
+	line, _ := json.Marshal(header)
+	r.w.Write(line)
+	r.w.WriteByte('\n')
+}
+
+// writeEventLocked appends an event line; r.mu must be held
+func (r *CastRecorder) writeEventLocked(kind, data string) {
+	r.writeHeaderLocked()
+	elapsed := time.Since(r.start).Seconds()
+	line, _ := json.Marshal([]interface{}{elapsed, kind, data})
+	r.w.Write(line)
+	r.w.WriteByte('\n')
+	// Flush often so a crash still leaves a usable recording
+	r.w.Flush()
+}
+
+// ptyRecorder is the recorder PTY sessions write to, if any
+var ptyRecorder struct {
+	sync.Mutex
+	rec *CastRecorder
+}
+
+// activeRecorder returns the current PTY recorder or nil
+func activeRecorder() *CastRecorder {
+	ptyRecorder.Lock()
+	defer ptyRecorder.Unlock()
+	return ptyRecorder.rec
+}
+
+// setActiveRecorder replaces the current PTY recorder, returning the old one
+func setActiveRecorder(rec *CastRecorder) *CastRecorder {
+	ptyRecorder.Lock()
+	defer ptyRecorder.Unlock()
+	old := ptyRecorder.rec
+	ptyRecorder.rec = rec
+	return old
+}
+
+// startRecording starts recording all following PTY sessions to path;
+// an empty path picks a timestamped name in the current directory
+func startRecording(path string) error {
+	if activeRecorder() != nil {
+		return fmt.Errorf("already recording to %s", activeRecorder().Path())
+	}
+	if path == "" {
+		path = time.Now().Format("gadb-20060102-150405.cast")
+	}
+	rec, err := NewCastRecorder(path, "gadb session")
+	if err != nil {
+		return err
+	}
+	setActiveRecorder(rec)
+	fmt.Fprintf(commandStdout(), "Recording PTY sessions to %s\n", path)
+	return nil
+}
+
+// stopRecording stops the current recording, if any
+func stopRecording() error {
+	rec := setActiveRecorder(nil)
+	if rec == nil {
+		return nil
+	}
+	fmt.Fprintf(commandStdout(), "Recording saved to %s\n", rec.Path())
+	return rec.Close()
+}
+
+// runRecordCommand handles the REPL "record" command:
+// "record on [file]", "record off" and "record" to show the status
+func runRecordCommand(args []string) error {
+	if len(args) == 0 {
+		if rec := activeRecorder(); rec != nil {
+			fmt.Fprintf(commandStdout(), "Recording to %s\n", rec.Path())
+		} else {
+			fmt.Fprintln(commandStdout(), "Not recording")
+		}
+		return nil
+	}
+	switch args[0] {
+	case "on", "start":
+		path := ""
+		if len(args) > 1 {
+			path = args[1]
+		}
+		return startRecording(path)
+	case "off", "stop":
+		return stopRecording()
+	}
+	return fmt.Errorf("usage: record [on [file] | off]")
+}
+
+// extractRecordFlag removes "--record <file>" from interactive command
+// arguments, along with a leading "--pty" which recording implies;
+// without --record the arguments are returned unchanged
+func extractRecordFlag(args []string) ([]string, string) {
+	var out []string
+	path := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--record" && i+1 < len(args):
+			path = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--record="):
+			path = strings.TrimPrefix(args[i], "--record=")
+		case args[i] == "--pty" && i == 1:
+			// PTY is already used for recorded commands
+		default:
+			out = append(out, args[i])
+		}
+	}
+	if path == "" {
+		return args, ""
+	}
+	return out, path
+}
+
+// execWithRecording runs an interactive command with PTY sessions
+// recorded to path for the duration of the command
+func execWithRecording(serial string, args []string, path string) error {
+	rec, err := NewCastRecorder(path, "adb "+strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	previous := setActiveRecorder(rec)
+	err = ExecWithPTY(serial, args)
+	setActiveRecorder(previous)
+	if cerr := rec.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	fmt.Fprintf(commandStdout(), "Recording saved to %s\n", path)
+	return err
+}
+
+// ReplayCast plays an asciicast v2 recording in the terminal
+// speed scales playback and idle caps pauses between events
+// (0 means no cap); Ctrl+C stops playback
+func ReplayCast(path string, speed float64, idle time.Duration) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if speed <= 0 {
+		speed = 1
+	}
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	line, err := reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return fmt.Errorf("empty recording")
+	}
+	var header castHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("%s is not an asciicast v2 recording", path)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	previous := 0.0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var event []interface{}
+			if jerr := json.Unmarshal(line, &event); jerr == nil && len(event) == 3 {
+				at, _ := event[0].(float64)
+				kind, _ := event[1].(string)
+				data, _ := event[2].(string)
+
+				delay := time.Duration((at - previous) / speed * float64(time.Second))
+				if idle > 0 && delay > idle {
+					delay = idle
+				}
+				previous = at
+				select {
+				case <-interrupt:
+					fmt.Println("\nReplay stopped")
+					return nil
+				case <-time.After(delay):
+				}
+				if kind == "o" {
+					io.WriteString(os.Stdout, data)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runReplayCommand handles "replay <file> [--speed N] [--idle SECONDS]"
+func runReplayCommand(args []string) error {
+	usage := fmt.Errorf("usage: replay <file.cast> [--speed N] [--idle SECONDS]")
+	path := ""
+	speed := 1.0
+	var idle time.Duration
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--speed", "--idle":
+			if i+1 >= len(args) {
+				return usage
+			}
+			var v float64
+			if _, err := fmt.Sscanf(args[i+1], "%g", &v); err != nil {
+				return usage
+			}
+			if args[i] == "--speed" {
+				speed = v
+			} else {
+				idle = time.Duration(v * float64(time.Second))
+			}
+			i++
+		default:
+			path = args[i]
+		}
+	}
+	if path == "" {
+		return usage
+	}
+	return ReplayCast(path, speed, idle)
+}
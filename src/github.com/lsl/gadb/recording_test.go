@@ -0,0 +1,26 @@
+package gadb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractRecordFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+		path string
+	}{
+		{[]string{"shell", "--pty", "--record", "s.cast"}, []string{"shell"}, "s.cast"},
+		{[]string{"shell", "--record=s.cast", "top"}, []string{"shell", "top"}, "s.cast"},
+		// Nothing to do with recording: left alone
+		{[]string{"shell", "--pty", "ls"}, []string{"shell", "--pty", "ls"}, ""},
+		{[]string{"shell", "echo", "--pty"}, []string{"shell", "echo", "--pty"}, ""},
+	}
+	for _, tt := range tests {
+		got, path := extractRecordFlag(tt.args)
+		if !reflect.DeepEqual(got, tt.want) || path != tt.path {
+			t.Errorf("extractRecordFlag(%q) = %q, %q, want %q, %q", tt.args, got, path, tt.want, tt.path)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package gadb
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 )
 
 // RedirectMode represents the type of output redirection
@@ -123,27 +125,28 @@ func isInQuotes(s string, idx int) bool {
 }
 
 // ExecWithRedirect executes a command with redirection support
-func ExecWithRedirect(device *Device, parsed *ParsedCommand) error {
+// cfg supplies the logcat rules of logcat views
+func ExecWithRedirect(device *Device, parsed *ParsedCommand, cfg *Config) error {
 	if device == nil {
 		return fmt.Errorf("no device specified")
 	}
 
 	// Check for pipeline
 	if len(parsed.PipeCmd) > 0 {
-		return execPipeline(device, parsed)
+		return execPipeline(device, parsed, cfg)
 	}
 
 	// Check for redirection
 	if parsed.Redirect != RedirectNone {
-		return execWithFileRedirect(device, parsed)
+		return execWithFileRedirect(device, parsed, cfg)
 	}
 
 	// No redirection or pipeline, use normal execution
-	return ExecCommand(device, parsed.Args)
+	return ExecCommand(device, parsed.Args, cfg)
 }
 
 // execWithFileRedirect executes command with output redirected to a file
-func execWithFileRedirect(device *Device, parsed *ParsedCommand) error {
+func execWithFileRedirect(device *Device, parsed *ParsedCommand, cfg *Config) error {
 	// Open output file
 	var file *os.File
 	var err error
@@ -159,6 +162,16 @@ func execWithFileRedirect(device *Device, parsed *ParsedCommand) error {
 	}
 	defer file.Close()
 
+	if len(parsed.Args) > 0 && parsed.Args[0] == "apps" {
+		return runAppsCommand(device.Serial, parsed.Args[1:], teeOutput(file))
+	}
+
+	// Filtered logcat views write the matching lines unformatted, and
+	// plain logcat goes through a view too so crashes are detected
+	if hasLogcatViewFlags(parsed.Args) || parsesLogcatText(parsed.Args) {
+		return runLogcatView(device, parsed.Args, cfg.logcatRules(), teeOutput(file), nil)
+	}
+
 	// For PTY commands, we can't easily redirect, so use non-PTY mode
 	if IsInteractiveCommand(parsed.Args) {
 		// Build adb command
@@ -167,8 +180,8 @@ func execWithFileRedirect(device *Device, parsed *ParsedCommand) error {
 		setupCommand(cmd)
 
 		cmd.Stdin = os.Stdin
-		cmd.Stdout = file
-		cmd.Stderr = file
+		cmd.Stdout = teeOutput(file)
+		cmd.Stderr = cmd.Stdout
 
 		return cmd.Run()
 	}
@@ -179,14 +192,19 @@ func execWithFileRedirect(device *Device, parsed *ParsedCommand) error {
 	setupCommand(cmd)
 
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = file
-	cmd.Stderr = os.Stderr // Keep stderr on console
+	cmd.Stdout = teeOutput(file)
+	cmd.Stderr = commandStderr() // Keep stderr on console
 
 	return cmd.Run()
 }
 
 // execPipeline executes a command pipeline: adb cmd | other_cmd
-func execPipeline(device *Device, parsed *ParsedCommand) error {
+func execPipeline(device *Device, parsed *ParsedCommand, cfg *Config) error {
+	// Logcat that gadb parses is piped through a view, like redirects
+	if hasLogcatViewFlags(parsed.Args) || parsesLogcatText(parsed.Args) {
+		return execLogcatPipeline(device, parsed, cfg)
+	}
+
 	// For PTY commands, we need to capture output differently
 	if IsInteractiveCommand(parsed.Args) {
 		return execPipelinePTY(device, parsed)
@@ -206,8 +224,8 @@ func execPipeline(device *Device, parsed *ParsedCommand) error {
 	// Second command: the piped command
 	cmd2 := exec.Command(parsed.PipeCmd[0], parsed.PipeCmd[1:]...)
 	cmd2.Stdin = stdout1
-	cmd2.Stdout = os.Stdout
-	cmd2.Stderr = os.Stderr
+	cmd2.Stdout = commandStdout()
+	cmd2.Stderr = commandStderr()
 
 	// Start first command
 	if err := cmd1.Start(); err != nil {
@@ -227,6 +245,33 @@ func execPipeline(device *Device, parsed *ParsedCommand) error {
 	return nil
 }
 
+// execLogcatPipeline streams a logcat view's unformatted lines, or its
+// export, into the piped command
+// A piped command that exits early, such as head, stops the stream
+func execLogcatPipeline(device *Device, parsed *ParsedCommand, cfg *Config) error {
+	cmd2 := exec.Command(parsed.PipeCmd[0], parsed.PipeCmd[1:]...)
+	stdin, err := cmd2.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+	cmd2.Stdout = commandStdout()
+	cmd2.Stderr = commandStderr()
+	if err := cmd2.Start(); err != nil {
+		return fmt.Errorf("failed to run piped command: %w", err)
+	}
+
+	viewErr := runLogcatView(device, parsed.Args, cfg.logcatRules(), stdin, nil)
+	stdin.Close()
+	if err := cmd2.Wait(); err != nil {
+		return fmt.Errorf("failed to run piped command: %w", err)
+	}
+	// The pipe breaks when the command stops reading, which is not an error
+	if viewErr != nil && !errors.Is(viewErr, syscall.EPIPE) {
+		return viewErr
+	}
+	return nil
+}
+
 // execPipelinePTY executes a pipeline with PTY commands (like shell)
 func execPipelinePTY(device *Device, parsed *ParsedCommand) error {
 	// For PTY commands, we need to capture output in memory
@@ -245,8 +290,8 @@ func execPipelinePTY(device *Device, parsed *ParsedCommand) error {
 	// Pipe output to second command
 	cmd2 := exec.Command(parsed.PipeCmd[0], parsed.PipeCmd[1:]...)
 	cmd2.Stdin = &output
-	cmd2.Stdout = os.Stdout
-	cmd2.Stderr = os.Stderr
+	cmd2.Stdout = commandStdout()
+	cmd2.Stderr = commandStderr()
 	cmd2.Stdin = bytes.NewReader(output.Bytes())
 
 	return cmd2.Run()
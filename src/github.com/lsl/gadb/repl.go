@@ -1,6 +1,7 @@
 package gadb
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -42,11 +43,12 @@ func RunREPL(devices []Device) error {
 	printWelcome(ctx)
 
 	// Create readline instance with completer
+	ctx.publishPrompt()
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          ctx.GetPrompt(),
 		HistoryFile:     os.TempDir() + "/gadb_history",
 		HistoryLimit:    100,
-		AutoComplete:    getCompleter(),
+		AutoComplete:    newPathCompleter(ctx, getCompleter(), false),
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 	})
@@ -55,9 +57,25 @@ func RunREPL(devices []Device) error {
 	}
 	defer rl.Close()
 
+	// Redraw the prompt when device state or info changes in the background
+	ctx.StartTracking(func() {
+		rl.SetPrompt(ctx.GetPrompt())
+		rl.Refresh()
+	})
+	defer ctx.Stop(ctx.ExitCode)
+
+	// Log the session from the start when the config asks for it
+	if ctx.Config.Transcript != "" {
+		if err := ctx.startTranscript(ctx.Config.Transcript); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	defer ctx.stopTranscript()
+
 	// Main REPL loop
 	for ctx.Running {
 		// Update prompt in case device changed
+		ctx.publishPrompt()
 		rl.SetPrompt(ctx.GetPrompt())
 
 		line, err := rl.Readline()
@@ -81,14 +99,31 @@ func RunREPL(devices []Device) error {
 		}
 
 		// Execute command
-		if err := executeREPLInput(ctx, line); err != nil {
-			fmt.Printf("Error: %v\n", err)
+		finish := ctx.beginTranscriptEntry("repl", line)
+		err = executeREPLInput(ctx, line)
+		ctx.LastExitCode = exitCodeOf(err)
+		if err != nil {
+			fmt.Fprintf(commandStdout(), "Error: %v\n", err)
 		}
+		finish(ctx.LastExitCode)
 	}
 
 	return nil
 }
 
+// exitCodeOf returns the process exit code carried by err
+// Errors that are not process exits map to 1
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
 // executeREPLInput parses and executes REPL input
 func executeREPLInput(ctx *Context, input string) error {
 	ctx.AddToHistory(input)
@@ -101,7 +136,7 @@ func executeREPLInput(ctx *Context, input string) error {
 
 	// Check for exit commands
 	if input == "q" || input == "exit" || input == "quit" {
-		fmt.Println("Exiting...")
+		fmt.Fprintln(commandStdout(), "Exiting...")
 		ctx.Stop(0)
 		return nil
 	}
@@ -133,6 +168,75 @@ func executeREPLInput(ctx *Context, input string) error {
 		return RunLocalShellMode(ctx)
 	}
 
+	// Upload and run a local script on the current device or all devices
+	if strings.HasPrefix(input, "run-script ") || input == "run-script" {
+		all, script, scriptArgs, err := parseRunScriptArgs(strings.Fields(input)[1:])
+		if err != nil {
+			return err
+		}
+		if all {
+			ctx.RefreshDevices()
+			return runScriptCommand(ctx.AvailableDevices, script, scriptArgs)
+		}
+		if !ctx.EnsureDevice() {
+			return fmt.Errorf("no device selected")
+		}
+		return runScriptCommand([]Device{*ctx.CurrentDevice}, script, scriptArgs)
+	}
+
+	// Reinstall APKs from a build directory as they change
+	if strings.HasPrefix(input, "watch-install ") || input == "watch-install" {
+		all, dir, installArgs, err := parseWatchInstallArgs(strings.Fields(input)[1:])
+		if err != nil {
+			return err
+		}
+		if all {
+			ctx.RefreshDevices()
+			return runWatchInstall(dir, ctx.AvailableDevices, installArgs)
+		}
+		if !ctx.EnsureDevice() {
+			return fmt.Errorf("no device selected")
+		}
+		return runWatchInstall(dir, []Device{*ctx.CurrentDevice}, installArgs)
+	}
+
+	// Crashes captured from logcat views
+	if input == "crashes" || strings.HasPrefix(input, "crashes ") {
+		return runCrashesCommand(strings.Fields(input)[1:])
+	}
+
+	// Background logcat capture of every device, and the jobs running
+	if input == "capture" || strings.HasPrefix(input, "capture ") {
+		return runCaptureCommand(ctx, strings.Fields(input)[1:])
+	}
+	if input == "jobs" {
+		return runJobsCommand(ctx)
+	}
+
+	// Transcript logging
+	if input == "log" || strings.HasPrefix(input, "log ") {
+		return runLogCommand(ctx, strings.Fields(input)[1:])
+	}
+
+	// Record PTY sessions, or play a recording back
+	if input == "record" || strings.HasPrefix(input, "record ") {
+		return runRecordCommand(strings.Fields(input)[1:])
+	}
+	if input == "replay" || strings.HasPrefix(input, "replay ") {
+		return runReplayCommand(strings.Fields(input)[1:])
+	}
+
+	// Inspect a local APK
+	if input == "apkinfo" || strings.HasPrefix(input, "apkinfo ") {
+		return runApkInfoCommand(strings.Fields(input)[1:], commandStdout())
+	}
+
+	// Logcat merged from several devices or saved files
+	if parsed := ParseCommand(input); isMergedLogcat(parsed.Args) {
+		ctx.RefreshDevices()
+		return runMergedLogcat(ctx.AvailableDevices, ctx.Config, parsed)
+	}
+
 	// Pass through to adb
 	if !ctx.EnsureDevice() {
 		return fmt.Errorf("no device selected")
@@ -140,7 +244,36 @@ func executeREPLInput(ctx *Context, input string) error {
 
 	// Parse command for redirection and pipeline
 	parsed := ParseCommand(input)
-	return ExecWithRedirect(ctx.CurrentDevice, parsed)
+	device, err := followPTYSwitches(ctx.CurrentDevice, parsed, ctx.Config, ExecWithRedirect(ctx.CurrentDevice, parsed, ctx.Config))
+	ctx.useDevice(device)
+	return err
+}
+
+// followPTYSwitches handles how a PTY session on device ended: a switch
+// request runs the same command, redirection and pipe included, on the
+// chosen device, and detaching returns to the prompt without an error
+// It returns the device the last session ran on
+func followPTYSwitches(device *Device, parsed *ParsedCommand, cfg *Config, err error) (*Device, error) {
+	for {
+		var sw *PTYSwitchError
+		if !errors.As(err, &sw) {
+			break
+		}
+		fmt.Fprintln(commandStdout(), "")
+		devices := readDevices()
+		if sw.Index < 1 || sw.Index > len(devices) {
+			fmt.Fprintf(commandStdout(), "Invalid device index: %d\n", sw.Index)
+			return device, nil
+		}
+		device = &devices[sw.Index-1]
+		fmt.Fprintf(commandStdout(), "Switched to: %s\n", device.String())
+		err = ExecWithRedirect(device, parsed, cfg)
+	}
+	if errors.Is(err, ErrPTYDetached) {
+		fmt.Fprintln(commandStdout(), "\nDetached from PTY session")
+		return device, nil
+	}
+	return device, err
 }
 
 // switchDeviceByIndex switches the current device by index
@@ -148,7 +281,7 @@ func switchDeviceByIndex(ctx *Context, idx int) error {
 	ctx.RefreshDevices()
 
 	if len(ctx.AvailableDevices) == 0 {
-		fmt.Println("No devices found")
+		fmt.Fprintln(commandStdout(), "No devices found")
 		return nil
 	}
 
@@ -159,13 +292,13 @@ func switchDeviceByIndex(ctx *Context, idx int) error {
 	}
 
 	if idx < 1 || idx > len(ctx.AvailableDevices) {
-		fmt.Printf("Invalid device index: %d\n", idx)
+		fmt.Fprintf(commandStdout(), "Invalid device index: %d\n", idx)
 		printDeviceList(ctx)
 		return nil
 	}
 
 	ctx.CurrentDevice = &ctx.AvailableDevices[idx-1]
-	fmt.Printf("Switched to: %s\n", ctx.CurrentDevice.String())
+	fmt.Fprintf(commandStdout(), "Switched to: %s\n", ctx.CurrentDevice.String())
 	return nil
 }
 
@@ -198,64 +331,124 @@ func printDeviceStatus(ctx *Context) {
 
 // printDeviceList shows all available devices
 func printDeviceList(ctx *Context) {
-	fmt.Println("")
+	fmt.Fprintln(commandStdout(), "")
 	for i, d := range ctx.AvailableDevices {
 		prefix := "  "
 		if ctx.CurrentDevice != nil && d.Serial == ctx.CurrentDevice.Serial {
 			prefix = "* "
 		}
-		fmt.Printf("%s[%d] %s\n", prefix, i+1, d.String())
+		fmt.Fprintf(commandStdout(), "%s[%d] %s\n", prefix, i+1, d.String())
 	}
-	fmt.Println("")
+	fmt.Fprintln(commandStdout(), "")
 }
 
 // printHelp shows detailed help information
 func printHelp() {
-	fmt.Println("")
-	fmt.Println("  GADB - Fast ADB Device Switcher")
-	fmt.Println("")
-	fmt.Println("USAGE:")
-	fmt.Println("  gadb              - Start interactive REPL mode")
-	fmt.Println("  gadb <command>    - Execute adb command on selected device")
-	fmt.Println("  gadb devices      - List all connected devices")
-	fmt.Println("")
-	fmt.Println("REPL COMMANDS:")
-	fmt.Println("  help, h, ?       - Show this help message")
-	fmt.Println("  <number>         - Switch to device (1, 2, 3...)")
-	fmt.Println("  0                - Show device list")
-	fmt.Println("  !<command>       - Execute local shell command")
-	fmt.Println("  Enter (empty)    - Show current device status")
-	fmt.Println("  q, exit, quit    - Quit REPL")
-	fmt.Println("")
-	fmt.Println("ADB COMMANDS (passed through):")
-	fmt.Println("  shell            - Enter local shell mode (with history & auto-completion)")
-	fmt.Println("  shell <cmd>      - Execute shell command once")
-	fmt.Println("  shell --pty      - Enter PTY interactive shell mode")
-	fmt.Println("  logcat [args]    - View logcat output")
-	fmt.Println("  install <apk>    - Install APK file")
-	fmt.Println("  uninstall <pkg>  - Uninstall package")
-	fmt.Println("  push <src> <dst> - Push file to device")
-	fmt.Println("  pull <src> <dst> - Pull file from device")
-	fmt.Println("  ...any adb cmd   - All other adb commands work too")
-	fmt.Println("")
-	fmt.Println("REDIRECTION & PIPELINE:")
-	fmt.Println("  cmd > file       - Redirect output to file (overwrite)")
-	fmt.Println("  cmd >> file      - Append output to file")
-	fmt.Println("  cmd | grep x     - Pipe output to another command")
-	fmt.Println("")
-	fmt.Println("EXAMPLES:")
-	fmt.Println("  !ls -la                     - List local files")
-	fmt.Println("  !pwd                        - Show local directory")
-	fmt.Println("  shell                       - Enter local shell mode (with history)")
-	fmt.Println("  shell ps                    - List processes")
-	fmt.Println("  shell ps | grep com.android - Filter processes")
-	fmt.Println("  logcat -d > log.txt         - Save logcat to file")
-	fmt.Println("  install app.apk             - Install app")
-	fmt.Println("")
+	out := commandStdout()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "  GADB - Fast ADB Device Switcher")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "USAGE:")
+	fmt.Fprintln(out, "  gadb              - Start interactive REPL mode")
+	fmt.Fprintln(out, "  gadb <command>    - Execute adb command on selected device")
+	fmt.Fprintln(out, "  gadb devices      - List all connected devices")
+	fmt.Fprintln(out, "  gadb run-script [--all] <script> [args]")
+	fmt.Fprintln(out, "                    - Upload and run a local script on the device(s)")
+	fmt.Fprintln(out, "  gadb replay <file.cast> [--speed N] [--idle SECONDS]")
+	fmt.Fprintln(out, "                    - Play back a recorded PTY session")
+	fmt.Fprintln(out, "  gadb apkinfo [--json] <file.apk>")
+	fmt.Fprintln(out, "                    - Show an APK's package, versions, launcher, permissions and ABIs")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "REPL COMMANDS:")
+	fmt.Fprintln(out, "  help, h, ?       - Show this help message")
+	fmt.Fprintln(out, "  <number>         - Switch to device (1, 2, 3...)")
+	fmt.Fprintln(out, "  0                - Show device list")
+	fmt.Fprintln(out, "  !<command>       - Execute local shell command")
+	fmt.Fprintln(out, "  run-script [--all] <script> [args]")
+	fmt.Fprintln(out, "                   - Upload and run a local script (on all devices with --all)")
+	fmt.Fprintln(out, "  record on [file] - Record following PTY sessions (asciicast v2)")
+	fmt.Fprintln(out, "  record off       - Stop recording")
+	fmt.Fprintln(out, "  replay <file>    - Play back a recording")
+	fmt.Fprintln(out, "  apkinfo <apk>    - Show a local APK's manifest details")
+	fmt.Fprintln(out, "  log on <file>    - Log inputs and output to an NDJSON transcript")
+	fmt.Fprintln(out, "  log off          - Stop logging")
+	fmt.Fprintln(out, "  watch-install [--all] <dir> [install flags]")
+	fmt.Fprintln(out, "                   - Reinstall and relaunch APKs from a build directory as they change")
+	fmt.Fprintln(out, "                     (file notifications on Linux only; polls the build tree elsewhere)")
+	fmt.Fprintln(out, "  crashes [n]      - List crashes seen in logcat this session, or show one")
+	fmt.Fprintln(out, "  capture start [--dir d] [--size 10M] [--count 10]")
+	fmt.Fprintln(out, "                   - Capture logcat of every device in the background")
+	fmt.Fprintln(out, "  capture stop     - Stop capturing and zip the session directory")
+	fmt.Fprintln(out, "  jobs             - List background jobs")
+	fmt.Fprintln(out, "  Enter (empty)    - Show current device status")
+	fmt.Fprintln(out, "  q, exit, quit    - Quit REPL")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "ADB COMMANDS (passed through):")
+	fmt.Fprintln(out, "  shell            - Enter local shell mode (with history & auto-completion)")
+	fmt.Fprintln(out, "  shell <cmd>      - Execute shell command once")
+	fmt.Fprintln(out, "  shell --pty      - Enter PTY interactive shell mode")
+	fmt.Fprintln(out, "  shell --pty --record <file>")
+	fmt.Fprintln(out, "                   - PTY shell recorded to an asciicast file")
+	fmt.Fprintln(out, "  logcat [args]    - View logcat output (parsed and colored by level)")
+	fmt.Fprintln(out, "  logcat -d --format ndjson|csv|html > file")
+	fmt.Fprintln(out, "                   - Export parsed logcat for tickets or other tools")
+	fmt.Fprintln(out, "  apps [-a] [--sort key] [--json] [filter]")
+	fmt.Fprintln(out, "                   - List installed apps with version and install info")
+	fmt.Fprintln(out, "  install <apk>    - Install APK file, refused when its minSdk or ABIs")
+	fmt.Fprintln(out, "                     do not suit the device (--no-check to skip)")
+	fmt.Fprintln(out, "  install --launch [--wait-debugger] [--clear-logcat] <apk>")
+	fmt.Fprintln(out, "                   - Install, then start the launcher activity")
+	fmt.Fprintln(out, "  install <app.apks|app.xapk|dir>")
+	fmt.Fprintln(out, "                   - Install the splits matching the device's ABI, density and locale")
+	fmt.Fprintln(out, "  install --if-newer|--skip-same <apk>")
+	fmt.Fprintln(out, "                   - Skip devices already on a newer or the same versionCode")
+	fmt.Fprintln(out, "  uninstall <pkg>  - Uninstall package")
+	fmt.Fprintln(out, "  push <src> <dst> - Push file to device")
+	fmt.Fprintln(out, "  pull <src> <dst> - Pull file from device")
+	fmt.Fprintln(out, "  ...any adb cmd   - All other adb commands work too")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "REDIRECTION & PIPELINE:")
+	fmt.Fprintln(out, "  cmd > file       - Redirect output to file (overwrite)")
+	fmt.Fprintln(out, "  cmd >> file      - Append output to file")
+	fmt.Fprintln(out, "  cmd | grep x     - Pipe output to another command")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "EXAMPLES:")
+	fmt.Fprintln(out, "  !ls -la                     - List local files")
+	fmt.Fprintln(out, "  !pwd                        - Show local directory")
+	fmt.Fprintln(out, "  shell                       - Enter local shell mode (with history)")
+	fmt.Fprintln(out, "  shell ps                    - List processes")
+	fmt.Fprintln(out, "  shell ps | grep com.android - Filter processes")
+	fmt.Fprintln(out, "  logcat -d > log.txt         - Save logcat to file")
+	fmt.Fprintln(out, "  logcat --pkg com.example    - Show one app's log, across restarts")
+	fmt.Fprintln(out, "  logcat --devices 1,2        - Merge logcat from devices 1 and 2 by time")
+	fmt.Fprintln(out, "  logcat --files a.txt,b.txt  - Merge saved logcat files by time")
+	fmt.Fprintln(out, "  install app.apk             - Install app")
+	fmt.Fprintln(out, "")
 }
 
 // RunNormalMode executes gadb in normal (non-REPL) mode
 func RunNormalMode(args []string) error {
+	// Play back a recorded PTY session; no device needed
+	if args[0] == "replay" {
+		return runReplayCommand(args[1:])
+	}
+
+	// Inspect a local APK; no device needed either
+	if args[0] == "apkinfo" {
+		return runApkInfoCommand(args[1:], os.Stdout)
+	}
+
+	cfg := LoadConfig()
+
+	// Logcat merged from several devices or saved files
+	if parsed := ParseCommand(strings.Join(args, " ")); isMergedLogcat(parsed.Args) {
+		var devices []Device
+		if _, opts, _ := splitLogcatArgs(parsed.Args); opts.files == "" {
+			devices = readDevices()
+		}
+		return runMergedLogcat(devices, cfg, parsed)
+	}
+
 	devices := readDevices()
 	count := len(devices)
 
@@ -265,9 +458,49 @@ func RunNormalMode(args []string) error {
 		return nil
 	}
 
-	// Check if it's a single APK file argument
-	if len(args) == 1 && strings.HasSuffix(args[0], ".apk") {
-		args = append([]string{"install", "-r"}, args...)
+	// Upload and run a local script, on every device with --all
+	if args[0] == "run-script" {
+		all, script, scriptArgs, err := parseRunScriptArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		switch {
+		case count == 0:
+			fmt.Println("No device found")
+			return fmt.Errorf("no device found")
+		case all || count == 1:
+			return runScriptCommand(devices, script, scriptArgs)
+		default:
+			return runScriptCommand(selectDevices(devices), script, scriptArgs)
+		}
+	}
+
+	// Reinstall APKs from a build directory as they change, on the
+	// selected devices
+	if args[0] == "watch-install" {
+		all, dir, installArgs, err := parseWatchInstallArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		switch {
+		case count == 0:
+			fmt.Println("No device found")
+			return fmt.Errorf("no device found")
+		case all || count == 1:
+			return runWatchInstall(dir, devices, installArgs)
+		default:
+			return runWatchInstall(dir, selectDevices(devices), installArgs)
+		}
+	}
+
+	// An APK or split bundle, optionally followed by install flags, is
+	// installed; apk.launch in the config launches it too
+	if isAPKShortcut(args) {
+		install := []string{"install", "-r"}
+		if cfg.APKLaunch {
+			install = append(install, "--launch")
+		}
+		args = append(append(install, args[1:]...), args[0])
 	}
 
 	// Parse the full command line for redirection/pipeline
@@ -279,14 +512,18 @@ func RunNormalMode(args []string) error {
 	case count > 1:
 		// Multiple devices - need selection
 		selected := selectDevices(devices)
+		if len(selected) > 1 && isPlainInstall(parsed) {
+			return runFleetInstall(selected, parsed.Args[1:])
+		}
 		for _, d := range selected {
-			if err := ExecWithRedirect(&d, parsed); err != nil {
+			if _, err := followPTYSwitches(&d, parsed, cfg, ExecWithRedirect(&d, parsed, cfg)); err != nil {
 				return err
 			}
 		}
 	case count == 1:
 		// Single device - execute directly
-		return ExecWithRedirect(&devices[0], parsed)
+		_, err := followPTYSwitches(&devices[0], parsed, cfg, ExecWithRedirect(&devices[0], parsed, cfg))
+		return err
 	default:
 		fmt.Println("No device found")
 		return fmt.Errorf("no device found")
@@ -295,29 +532,49 @@ func RunNormalMode(args []string) error {
 	return nil
 }
 
+// isAPKShortcut reports whether args are "<app> [flags]", the app an
+// APK, a split APK archive or a directory of splits
+func isAPKShortcut(args []string) bool {
+	if len(args) == 0 || !isInstallable(args[0]) {
+		return false
+	}
+	for _, a := range args[1:] {
+		if !strings.HasPrefix(a, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// isPlainInstall reports whether a command is an install without
+// redirection or a pipeline
+func isPlainInstall(parsed *ParsedCommand) bool {
+	return len(parsed.Args) > 0 && parsed.Args[0] == "install" &&
+		parsed.Redirect == RedirectNone && len(parsed.PipeCmd) == 0
+}
+
 // ExecLocalCommand executes a local shell command
 func ExecLocalCommand(cmdStr string) error {
-	// Parse the command string
-	// On Windows, use cmd /c; on Unix, use sh -c
-	var cmd *exec.Cmd
+	cmd := localCommand(cmdStr)
+	cmd.Stdout = commandStdout()
+	cmd.Stderr = commandStderr()
+	cmd.Stdin = os.Stdin
+
+	return cmd.Run()
+}
 
+// localCommand builds a command running cmdStr in the local shell
+func localCommand(cmdStr string) *exec.Cmd {
+	// On Windows, use cmd /c; on Unix, use sh -c
 	if strings.Contains(strings.ToLower(os.Getenv("OS")), "windows") || os.Getenv("OSTYPE") == "" && os.Getenv("MSYSTEM") == "" {
 		// Detect Windows by checking if we can run cmd
 		if exec.Command("cmd", "/c", "echo", "1").Run() == nil {
-			cmd = exec.Command("cmd", "/c", cmdStr)
-		} else {
-			// Fallback to sh
-			cmd = exec.Command("sh", "-c", cmdStr)
+			return exec.Command("cmd", "/c", cmdStr)
 		}
-	} else {
-		cmd = exec.Command("sh", "-c", cmdStr)
+		// Fallback to sh
+		return exec.Command("sh", "-c", cmdStr)
 	}
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	return cmd.Run()
+	return exec.Command("sh", "-c", cmdStr)
 }
 
 // Common adb commands for auto-completion
@@ -342,21 +599,30 @@ var shellCommands = []string{
 	"chmod", "chown", "ln", "df", "du", "free", "uname",
 }
 
+// pmCommand is a pm (package manager) subcommand
+type pmCommand struct {
+	name string
+	// takesPackage is true when a package name follows, which
+	// completion offers from the device's installed packages
+	takesPackage bool
+}
+
 // pm (package manager) subcommands
-var pmCommands = []string{
-	"list", "list packages", "list packages -3", "list packages -s",
-	"path", "install", "uninstall",
-	"clear", "enable", "disable", "disable-user",
-	"hide", "unhide",
-	"grant", "revoke",
-	"set-install-location", "get-install-location",
-	"trim-caches", "create-user", "remove-user",
-	"get-max-users", "dump",
+var pmCommands = []pmCommand{
+	{"list", false}, {"list packages", false}, {"list packages -3", false}, {"list packages -s", false},
+	{"path", true}, {"install", false}, {"uninstall", true},
+	{"clear", true}, {"enable", true}, {"disable", true}, {"disable-user", true},
+	{"hide", true}, {"unhide", true}, {"suspend", true}, {"unsuspend", true},
+	{"grant", true}, {"revoke", true},
+	{"set-install-location", false}, {"get-install-location", false},
+	{"trim-caches", false}, {"create-user", false}, {"remove-user", false},
+	{"get-max-users", false}, {"dump", true},
 }
 
 // am (activity manager) subcommands
 var amCommands = []string{
 	"start", "startservice", "stopservice",
+	"start-foreground-service",
 	"broadcast", "force-stop",
 	"kill", "kill-all",
 	"start-activity", "start-activity-as-user",
@@ -385,11 +651,14 @@ var logcatOptions = []string{
 	"-s", "-f", "-r", "-n", "-t", "-d", "-g", "-G", "-c", "-b", "-B",
 	"*:V", "*:D", "*:I", "*:W", "*:E",
 	"*:S", "AndroidRuntime:E", "System.err:W",
+	"--pkg", "--devices", "--files",
+	"--format ndjson", "--format csv", "--format html",
 }
 
 // install options
 var installOptions = []string{
-	"-l", "-r", "-R", "-i", "-t", "-s", "-d", "-g", "--fastdeploy",
+	"-l", "-r", "-R", "-i", "-t", "-s", "-d", "-g", "--fastdeploy", "--no-check",
+	"--launch", "--wait-debugger", "--clear-logcat", "--if-newer", "--skip-same",
 }
 
 // uninstall options
@@ -430,6 +699,21 @@ func getCompleter() *readline.PrefixCompleter {
 		readline.PcItem("exit"),
 		readline.PcItem("q"),
 		readline.PcItem("quit"),
+		readline.PcItem("run-script", readline.PcItem("--all")),
+		readline.PcItem("record", readline.PcItem("on"), readline.PcItem("off")),
+		readline.PcItem("log", readline.PcItem("on"), readline.PcItem("off")),
+		readline.PcItem("watch-install", readline.PcItem("--all")),
+		readline.PcItem("crashes", readline.PcItem("clear")),
+		readline.PcItem("capture",
+			readline.PcItem("start", readline.PcItem("--dir"), readline.PcItem("--size"), readline.PcItem("--count")),
+			readline.PcItem("stop"),
+		),
+		readline.PcItem("jobs"),
+		readline.PcItem("apps", readline.PcItem("-a"), readline.PcItem("--json"), readline.PcItem("--installer"),
+			readline.PcItem("--sort", readline.PcItem("name"), readline.PcItem("version"), readline.PcItem("target"),
+				readline.PcItem("installed"), readline.PcItem("updated"), readline.PcItem("installer"))),
+		readline.PcItem("replay", readline.PcItem("--speed"), readline.PcItem("--idle")),
+		readline.PcItem("apkinfo", readline.PcItem("--json")),
 	)
 
 	return readline.NewPrefixCompleter(completers...)
@@ -442,7 +726,7 @@ func buildShellCompleter() *readline.PrefixCompleter {
 	// pm with subcommands
 	pmItems := make([]readline.PrefixCompleterInterface, len(pmCommands))
 	for i, cmd := range pmCommands {
-		pmItems[i] = readline.PcItem(cmd)
+		pmItems[i] = readline.PcItem(cmd.name)
 	}
 	subItems = append(subItems, readline.PcItem("pm", pmItems...))
 
@@ -0,0 +1,212 @@
+package gadb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scriptRemoteDir is where scripts are uploaded before they run
+const scriptRemoteDir = "/data/local/tmp"
+
+// ScriptResult is the outcome of running a script on one device
+type ScriptResult struct {
+	Device   Device
+	ExitCode int
+	Duration time.Duration
+	// Output holds the script's output when it was captured for a report
+	Output []byte
+	// Err is set when the script could not be uploaded or started
+	Err error
+}
+
+// remoteScriptPath returns a unique device path for a local script
+func remoteScriptPath(local string) string {
+	token := make([]byte, 4)
+	_, _ = rand.Read(token)
+	return path.Join(scriptRemoteDir, "gadb-"+hex.EncodeToString(token)+"-"+filepath.Base(local))
+}
+
+// pushScript uploads a local script, returning its device path
+func pushScript(serial, local string) (string, error) {
+	if _, err := os.Stat(local); err != nil {
+		return "", err
+	}
+	remote := remoteScriptPath(local)
+	cmd := exec.Command("adb", "-s", serial, "push", local, remote)
+	setupCommand(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("push %s failed: %s", local, strings.TrimSpace(string(out)))
+	}
+	return remote, nil
+}
+
+// removeRemote deletes a device file, ignoring errors
+func removeRemote(serial, remote string) {
+	cmd := exec.Command("adb", "-s", serial, "shell", "rm", "-f", remote)
+	setupCommand(cmd)
+	_ = cmd.Run()
+}
+
+// RunScript uploads a local script to the device, runs it with args
+// while streaming its output to out, and removes it afterwards
+func RunScript(device *Device, local string, args []string, out io.Writer) ScriptResult {
+	result := ScriptResult{Device: *device}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	remote, err := pushScript(device.Serial, local)
+	if err != nil {
+		result.Err = err
+		result.ExitCode = -1
+		return result
+	}
+	defer removeRemote(device.Serial, remote)
+
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	cmdLine := strings.TrimSpace("sh " + shellQuote(remote) + " " + strings.Join(quoted, " "))
+	cmd := exec.Command("adb", "-s", device.Serial, "shell", cmdLine)
+	setupCommand(cmd)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err = cmd.Run()
+	result.ExitCode = exitCodeOf(err)
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		result.Err = err
+	}
+	return result
+}
+
+// RunScriptOnDevices runs a script on every device concurrently and
+// returns the results in device order with each device's output captured
+func RunScriptOnDevices(devices []Device, local string, args []string) []ScriptResult {
+	results := make([]ScriptResult, len(devices))
+	var wg sync.WaitGroup
+	for i := range devices {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			results[i] = RunScript(&devices[i], local, args, &buf)
+			results[i].Output = buf.Bytes()
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// printScriptReport prints the combined report of a multi-device run:
+// each device's output followed by a summary table
+func printScriptReport(w io.Writer, script string, results []ScriptResult) {
+	for _, r := range results {
+		fmt.Fprintf(w, "==== %s ====\n", r.Device.String())
+		if r.Err != nil {
+			fmt.Fprintf(w, "error: %v\n", r.Err)
+		}
+		w.Write(r.Output)
+		if len(r.Output) > 0 && r.Output[len(r.Output)-1] != '\n' {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+
+	failed := 0
+	fmt.Fprintf(w, "SUMMARY: %s on %d device(s)\n", filepath.Base(script), len(results))
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil || r.ExitCode != 0 {
+			status = fmt.Sprintf("FAILED (exit %d)", r.ExitCode)
+			failed++
+		}
+		fmt.Fprintf(w, "  %-30s %-18s %s\n", r.Device.String(), status, r.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "  %d succeeded, %d failed\n", len(results)-failed, failed)
+}
+
+// runScriptCommand runs a script on the given devices, streaming the
+// output for a single device and printing a combined report otherwise
+func runScriptCommand(devices []Device, script string, args []string) error {
+	if len(devices) == 1 {
+		r := RunScript(&devices[0], script, args, commandStdout())
+		if r.Err != nil {
+			return r.Err
+		}
+		if r.ExitCode != 0 {
+			return fmt.Errorf("script exited with status %d", r.ExitCode)
+		}
+		return nil
+	}
+
+	results := RunScriptOnDevices(devices, script, args)
+	printScriptReport(commandStdout(), script, results)
+	for _, r := range results {
+		if r.Err != nil || r.ExitCode != 0 {
+			return fmt.Errorf("script failed on one or more devices")
+		}
+	}
+	return nil
+}
+
+// parseRunScriptArgs splits "run-script" arguments into the --all flag,
+// the script path and the script's own arguments
+// --all may come before or after the script, as in "run-script diag.sh
+// --all"; everything after "--" is passed on as is
+func parseRunScriptArgs(args []string) (all bool, script string, scriptArgs []string, err error) {
+	var rest []string
+	for i, a := range args {
+		if a == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if a == "--all" {
+			all = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	if len(rest) == 0 {
+		return false, "", nil, fmt.Errorf("usage: run-script [--all] <script> [args...] [-- args...]")
+	}
+	return all, rest[0], rest[1:], nil
+}
+
+// builtinSource uploads a local script and sources it in the shell
+// session, so directory and environment changes it makes persist
+func builtinSource(m *shellMode, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", shellBuiltins["source"].usage)
+	}
+	if m.session == nil {
+		r := RunScript(m.device, args[0], args[1:], commandStdout())
+		m.lastExit = r.ExitCode
+		return r.Err
+	}
+
+	remote, err := pushScript(m.device.Serial, args[0])
+	if err != nil {
+		return err
+	}
+	defer m.session.Run("rm -f "+shellQuote(remote), io.Discard)
+
+	line := ". " + shellQuote(remote)
+	for _, a := range args[1:] {
+		line += " " + shellQuote(a)
+	}
+	m.run(line)
+	return nil
+}
@@ -0,0 +1,35 @@
+package gadb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRunScriptArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		all    bool
+		script string
+		rest   []string
+		err    bool
+	}{
+		{args: []string{"diag.sh"}, script: "diag.sh"},
+		{args: []string{"--all", "diag.sh", "-v"}, all: true, script: "diag.sh", rest: []string{"-v"}},
+		{args: []string{"diag.sh", "--all"}, all: true, script: "diag.sh"},
+		{args: []string{"diag.sh", "-v", "--all", "--", "--all"}, all: true, script: "diag.sh", rest: []string{"-v", "--all"}},
+		{args: []string{"--all", "--", "--weird.sh", "--all"}, all: true, script: "--weird.sh", rest: []string{"--all"}},
+		{args: []string{"--", "--all"}, script: "--all"},
+		{args: nil, err: true},
+		{args: []string{"--all", "--"}, err: true},
+	}
+	for _, tt := range tests {
+		all, script, rest, err := parseRunScriptArgs(tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("parseRunScriptArgs(%q) error = %v", tt.args, err)
+			continue
+		}
+		if all != tt.all || script != tt.script || len(rest)+len(tt.rest) > 0 && !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("parseRunScriptArgs(%q) = %v, %q, %q, want %v, %q, %q", tt.args, all, script, rest, tt.all, tt.script, tt.rest)
+		}
+	}
+}
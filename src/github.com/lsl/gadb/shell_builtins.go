@@ -0,0 +1,226 @@
+package gadb
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// shellBuiltin is a command handled by gadb itself inside shell mode
+type shellBuiltin struct {
+	usage string
+	help  string
+	run   func(m *shellMode, args []string) error
+}
+
+// shellBuiltins are the sftp-style commands available in shell mode
+// Remote paths are relative to the session's working directory and
+// local paths to gadb's own working directory (see lcd)
+var shellBuiltins map[string]shellBuiltin
+
+func init() {
+	shellBuiltins = map[string]shellBuiltin{
+		"put":    {"put <local> [remote]", "Upload a local file to the device", builtinPut},
+		"get":    {"get <remote> [local]", "Download a file from the device", builtinGet},
+		"lls":    {"lls [args]", "List local files", builtinLls},
+		"lcd":    {"lcd [dir]", "Change the local directory", builtinLcd},
+		"lpwd":   {"lpwd", "Show the local directory", builtinLpwd},
+		"edit":   {"edit <remote>", "Edit a device file with $EDITOR", builtinEdit},
+		"as":     {"as [package]", "Run commands as an app with run-as, or as shell", builtinAs},
+		"root":   {"root", "Run commands as root through su", builtinRoot},
+		"source": {"source <script> [args]", "Upload a local script and source it", builtinSource},
+		"help":   {"help", "Show shell mode commands", builtinHelp},
+	}
+}
+
+// shellBuiltinNames returns the builtin names in sorted order
+func shellBuiltinNames() []string {
+	names := make([]string, 0, len(shellBuiltins))
+	for name := range shellBuiltins {
+		if name != "help" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runBuiltin runs line as a builtin if its first word names one
+// Builtins that run device commands update m.lastExit themselves
+func (m *shellMode) runBuiltin(line string) (bool, error) {
+	fields := strings.Fields(line)
+	b, ok := shellBuiltins[fields[0]]
+	if !ok {
+		return false, nil
+	}
+	m.lastExit = 0
+	return true, b.run(m, fields[1:])
+}
+
+// builtinPut uploads a local file into the remote working directory
+func builtinPut(m *shellMode, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: %s", shellBuiltins["put"].usage)
+	}
+	remote := m.remoteCwd()
+	if len(args) == 2 {
+		remote = m.resolveRemote(args[1])
+	}
+	return m.pushFile(args[0], remote)
+}
+
+// builtinGet downloads a remote file into the local working directory
+func builtinGet(m *shellMode, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: %s", shellBuiltins["get"].usage)
+	}
+	local := "."
+	if len(args) == 2 {
+		local = args[1]
+	}
+	return m.pullFile(m.resolveRemote(args[0]), local)
+}
+
+// builtinLls lists local files
+func builtinLls(m *shellMode, args []string) error {
+	lister := "ls"
+	if runtime.GOOS == "windows" {
+		lister = "dir"
+	}
+	return ExecLocalCommand(strings.TrimSpace(lister + " " + strings.Join(args, " ")))
+}
+
+// builtinLcd changes gadb's local working directory
+func builtinLcd(m *shellMode, args []string) error {
+	dir := ""
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if dir == "" {
+		dir = "~"
+	}
+	if dir = expandHome(dir); dir == "~" {
+		return fmt.Errorf("cannot find the home directory")
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	return builtinLpwd(m, nil)
+}
+
+// builtinLpwd prints gadb's local working directory
+func builtinLpwd(m *shellMode, args []string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(commandStdout(), wd)
+	return nil
+}
+
+// builtinEdit pulls a device file, opens it in the local editor and
+// pushes it back if it changed
+// A file that does not exist yet is created on save
+func builtinEdit(m *shellMode, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", shellBuiltins["edit"].usage)
+	}
+	remote := m.resolveRemote(args[0])
+
+	tmpDir, err := os.MkdirTemp("", "gadb-edit-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	local := filepath.Join(tmpDir, path.Base(remote))
+
+	exists, err := m.remoteExists(remote)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := m.pullFile(remote, local); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(commandStdout(), "New file: %s\n", remote)
+		if err := os.WriteFile(local, nil, 0644); err != nil {
+			return err
+		}
+	}
+
+	before, err := fileDigest(local)
+	if err != nil {
+		return err
+	}
+	if err := runEditor(local); err != nil {
+		return err
+	}
+	after, err := fileDigest(local)
+	if err != nil {
+		return err
+	}
+	if before == after {
+		fmt.Fprintln(commandStdout(), "No changes")
+		return nil
+	}
+	return m.pushFile(local, remote)
+}
+
+// builtinHelp lists the shell mode builtins
+func builtinHelp(m *shellMode, args []string) error {
+	fmt.Fprintln(commandStdout(), "")
+	fmt.Fprintln(commandStdout(), "SHELL MODE COMMANDS:")
+	for _, name := range shellBuiltinNames() {
+		b := shellBuiltins[name]
+		fmt.Fprintf(commandStdout(), "  %-22s - %s\n", b.usage, b.help)
+	}
+	fmt.Fprintf(commandStdout(), "  %-22s - %s\n", "<cmd> --pty", "Run a command with a PTY")
+	fmt.Fprintf(commandStdout(), "  %-22s - %s\n", "exit, quit, q", "Return to GADB")
+	fmt.Fprintln(commandStdout(), "")
+	return nil
+}
+
+// adbTransfer runs adb push or pull, showing adb's progress output
+func adbTransfer(serial, direction, src, dst string) error {
+	cmd := exec.Command("adb", "-s", serial, direction, src, dst)
+	setupCommand(cmd)
+	cmd.Stdout = commandStdout()
+	cmd.Stderr = commandStderr()
+	return cmd.Run()
+}
+
+// runEditor opens a file in $VISUAL or $EDITOR
+func runEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// fileDigest returns the SHA-256 of a file's content
+func fileDigest(file string) ([32]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
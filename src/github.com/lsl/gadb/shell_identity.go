@@ -0,0 +1,214 @@
+package gadb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// identityCwdPrefix starts the file root commands leave their working
+// directory in, one per identity so sessions do not overwrite each
+// other's; su implementations such as Magisk do not pass extra file
+// descriptors through to the command, so the directory cannot be
+// reported on fd 3
+const identityCwdPrefix = "/data/local/tmp/.gadb_cwd_"
+
+// identityStagingDir is where files are staged when transferring them
+// to or from another identity's directories
+const identityStagingDir = "/data/local/tmp"
+
+// shellIdentity is a user that shell mode commands run as
+// instead of the shell user, set with "as <package>" or "root"
+type shellIdentity struct {
+	// name is shown in the prompt
+	name string
+	// prefix runs a single script argument as the identity,
+	// e.g. "run-as com.example sh -c" or "su -c"
+	prefix string
+	// root is true for su, false for run-as
+	root bool
+	// cwd is the identity's working directory; it is tracked apart
+	// from the session's because every command runs in a new process
+	cwd string
+	// cwdFile is where a root command writes the directory it ended in
+	cwdFile string
+}
+
+// wrap turns a command line into one that runs as the identity in its
+// working directory and reports the directory it ended in
+// When a root command's directory cannot be read back, as after an
+// exit, a warning is printed and the identity stays where it was
+func (id *shellIdentity) wrap(command string) string {
+	inner := fmt.Sprintf("cd %s 2>/dev/null\n%s\n__s=$?", shellQuote(id.cwd), command)
+	if id.root {
+		file := shellQuote(id.cwdFile)
+		inner += "; pwd > " + file + "; exit $__s"
+		warning := shellQuote(fmt.Sprintf("gadb: could not read the working directory from %s, staying in %s", id.cwdFile, id.cwd))
+		return fmt.Sprintf("%s %s; __s=$?; __gadb_cwd=$(cat %s 2>/dev/null) || { echo %s >&2; __gadb_cwd=%s; }; rm -f %s; (exit $__s)",
+			id.prefix, shellQuote(inner), file, warning, shellQuote(id.cwd), file)
+	}
+	// run-as keeps file descriptors, so the directory goes out on fd 3
+	// into the command substitution while output goes to the real stdout
+	inner += "; pwd >&3; exit $__s"
+	return fmt.Sprintf("{ __gadb_cwd=$(%s %s 3>&1 1>&4 2>&1); } 4>&1", id.prefix, shellQuote(inner))
+}
+
+// builtinAs handles the "as" builtin
+// "as <package>" runs commands with run-as in the app's data directory;
+// "as" with no argument returns to the shell user
+func builtinAs(m *shellMode, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s", shellBuiltins["as"].usage)
+	}
+	if m.session == nil {
+		return fmt.Errorf("switching users needs a persistent shell session")
+	}
+	if len(args) == 0 || args[0] == "shell" {
+		return m.resetIdentity()
+	}
+
+	pkg := args[0]
+	var out bytes.Buffer
+	status, err := m.session.Run("run-as "+shellQuote(pkg)+" pwd 2>&1", &out)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("run-as %s: %s", pkg, strings.TrimSpace(out.String()))
+	}
+	m.identity = &shellIdentity{
+		name:   pkg,
+		prefix: "run-as " + shellQuote(pkg) + " sh -c",
+		cwd:    strings.TrimSpace(out.String()),
+	}
+	fmt.Fprintf(commandStdout(), "Running commands as %s in %s\n", pkg, m.identity.cwd)
+	return nil
+}
+
+// builtinRoot runs commands through su, detecting which su syntax the
+// device supports
+func builtinRoot(m *shellMode, args []string) error {
+	if m.session == nil {
+		return fmt.Errorf("switching users needs a persistent shell session")
+	}
+	// Magisk and SuperSU take "su -c <cmd>", AOSP userdebug builds "su 0 <cmd>"
+	for _, prefix := range []string{"su -c", "su 0 sh -c"} {
+		var out bytes.Buffer
+		status, err := m.session.Run(prefix+" id 2>&1 </dev/null", &out)
+		if err != nil {
+			return err
+		}
+		if status == 0 && strings.Contains(out.String(), "uid=0") {
+			token := make([]byte, 8)
+			if _, err := rand.Read(token); err != nil {
+				return err
+			}
+			m.identity = &shellIdentity{
+				name:    "root",
+				prefix:  prefix,
+				root:    true,
+				cwd:     m.session.Cwd,
+				cwdFile: identityCwdPrefix + hex.EncodeToString(token),
+			}
+			fmt.Fprintln(commandStdout(), "Running commands as root")
+			return nil
+		}
+	}
+	return fmt.Errorf("su is not available on this device")
+}
+
+// resetIdentity returns to running commands as the shell user
+func (m *shellMode) resetIdentity() error {
+	if m.identity == nil {
+		return nil
+	}
+	m.identity = nil
+	// Refresh the session's own directory, which identity commands hid
+	_, err := m.session.Run(":", io.Discard)
+	fmt.Fprintln(commandStdout(), "Running commands as shell")
+	return err
+}
+
+// pushFile copies a local file to the device, staging it through
+// /data/local/tmp when the destination belongs to another identity
+func (m *shellMode) pushFile(local, remote string) error {
+	if m.identity == nil {
+		return adbTransfer(m.device.Serial, "push", local, remote)
+	}
+
+	staged := path.Join(identityStagingDir, ".gadb_put_"+path.Base(local))
+	if err := adbTransfer(m.device.Serial, "push", local, staged); err != nil {
+		return err
+	}
+	defer m.session.Run("rm -f "+shellQuote(staged), io.Discard)
+
+	// A directory destination keeps the local file name
+	script := fmt.Sprintf("dst=%s; [ -d \"$dst\" ] && dst=\"$dst\"/%s; cat %s > \"$dst\"",
+		shellQuote(remote), shellQuote(path.Base(local)), shellQuote(staged))
+	return m.runAsIdentity(script)
+}
+
+// pullFile copies a device file to the local machine, reading it as the
+// current identity when there is one
+func (m *shellMode) pullFile(remote, local string) error {
+	if m.identity == nil {
+		return adbTransfer(m.device.Serial, "pull", remote, local)
+	}
+
+	staged := path.Join(identityStagingDir, ".gadb_get_"+path.Base(remote))
+	defer m.session.Run("rm -f "+shellQuote(staged), io.Discard)
+
+	// The outer shell creates the staging file, so it stays readable by adb
+	script := fmt.Sprintf("%s %s > %s", m.identity.prefix, shellQuote("cat "+shellQuote(remote)), shellQuote(staged))
+	status, err := m.session.Run(script, commandStdout())
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("cannot read %s as %s", remote, m.identity.name)
+	}
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	return adbTransfer(m.device.Serial, "pull", staged, local)
+}
+
+// remoteExists reports whether a device path exists for the current
+// identity; without a session it asks a one-off adb shell
+func (m *shellMode) remoteExists(remote string) (bool, error) {
+	test := "[ -e " + shellQuote(remote) + " ]"
+	if m.session == nil {
+		cmd := exec.Command("adb", "-s", m.device.Serial, "shell", test+" && echo yes || echo no")
+		setupCommand(cmd)
+		out, err := cmd.Output()
+		if err != nil {
+			return false, fmt.Errorf("cannot check %s: %w", remote, err)
+		}
+		return strings.TrimSpace(string(out)) == "yes", nil
+	}
+	if m.identity != nil {
+		test = m.identity.prefix + " " + shellQuote(test)
+	}
+	status, err := m.session.Run(test, io.Discard)
+	return err == nil && status == 0, err
+}
+
+// runAsIdentity runs a script as the current identity, failing on a
+// non-zero exit status
+func (m *shellMode) runAsIdentity(script string) error {
+	status, err := m.session.Run(m.identity.prefix+" "+shellQuote(script), commandStdout())
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("command failed as %s (exit %d)", m.identity.name, status)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRootIdentityTracksItsDirectory(t *testing.T) {
+	s, err := NewShellSession("fake-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	dir := t.TempDir()
+	// sh -c stands in for su -c, which also drops extra descriptors
+	id := &shellIdentity{name: "root", prefix: "sh -c", root: true, cwd: dir, cwdFile: filepath.Join(dir, ".cwd")}
+
+	var out strings.Builder
+	if _, err := s.Run(id.wrap("mkdir sub && cd sub"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "sub"); s.Cwd != want || out.String() != "" {
+		t.Fatalf("Cwd = %q, output %q, want %q", s.Cwd, out.String(), want)
+	}
+	id.cwd = s.Cwd
+
+	// exit skips writing the directory: warn and stay
+	out.Reset()
+	status, err := s.Run(id.wrap("cd / && exit 3"), &out)
+	if err != nil || status != 3 || s.Cwd != id.cwd || !strings.Contains(out.String(), "could not read the working directory") {
+		t.Errorf("after exit: status %d, Cwd %q, output %q, %v", status, s.Cwd, out.String(), err)
+	}
+}
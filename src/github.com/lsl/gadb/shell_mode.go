@@ -9,6 +9,88 @@ import (
 	"github.com/chzyer/readline"
 )
 
+// shellMode holds the state of a shell mode session
+type shellMode struct {
+	ctx    *Context
+	device *Device
+	// session is nil when the persistent shell could not be started
+	session  *ShellSession
+	lastExit int
+	// identity is the user commands run as; nil means the shell user
+	identity *shellIdentity
+}
+
+// remoteCwd returns the remote working directory
+func (m *shellMode) remoteCwd() string {
+	if m.identity != nil {
+		return m.identity.cwd
+	}
+	if m.session != nil {
+		return m.session.Cwd
+	}
+	return "/"
+}
+
+// resolveRemote resolves a device path against the remote working directory
+func (m *shellMode) resolveRemote(p string) string {
+	return resolveRemotePath(m.remoteCwd(), p)
+}
+
+// prompt renders the shell mode prompt with the current identity,
+// the remote working directory and the last exit code when it was non-zero
+func (m *shellMode) prompt() string {
+	location := m.device.Serial
+	sigil := "$"
+	if m.identity != nil {
+		location += " " + m.identity.name
+		if m.identity.root {
+			sigil = "#"
+		}
+	}
+	if m.session != nil {
+		location += ":" + m.remoteCwd()
+	}
+	if m.lastExit != 0 {
+		return fmt.Sprintf("[%s] \033[31m%d\033[0m %s ", location, m.lastExit, sigil)
+	}
+	return fmt.Sprintf("[%s] %s ", location, sigil)
+}
+
+// run executes a line on the device, in the persistent session when
+// there is one and as a one-off adb shell process otherwise
+func (m *shellMode) run(line string) {
+	if m.session != nil {
+		var err error
+		if m.identity != nil {
+			// The wrapper quotes the line, which hides incomplete
+			// quoting from the session's own check
+			if err := checkComplete(line); err != nil {
+				fmt.Fprintf(commandStdout(), "Error: %v\n", err)
+				m.lastExit = 2
+				return
+			}
+			line = m.identity.wrap(line)
+		}
+		m.lastExit, err = m.session.Run(line, commandStdout())
+		if err == nil && m.identity != nil {
+			m.identity.cwd = m.session.Cwd
+		}
+		if err != nil {
+			fmt.Fprintf(commandStdout(), "\nError: %v\n", err)
+			// Reconnect so the next command keeps the last directory
+			if m.session, err = m.ctx.shellSession(m.device); err != nil {
+				fmt.Fprintf(commandStdout(), "Warning: %v\n", err)
+			}
+		}
+		return
+	}
+	err := ExecSingleShellCommand(m.device, line)
+	m.lastExit = exitCodeOf(err)
+	if err != nil {
+		fmt.Fprintf(commandStdout(), "Error: %v\n", err)
+	}
+}
+
 // RunLocalShellMode enters the local shell REPL mode
 // This mode provides a non-PTY shell experience with history and auto-completion
 func RunLocalShellMode(ctx *Context) error {
@@ -17,14 +99,26 @@ func RunLocalShellMode(ctx *Context) error {
 	}
 
 	device := ctx.CurrentDevice
-	prompt := fmt.Sprintf("[%s] $ ", device.Serial)
+	m := &shellMode{ctx: ctx, device: device}
+
+	// Keep one shell connection per device so cd, export and su persist
+	session, err := ctx.shellSession(device)
+	if err != nil {
+		fmt.Fprintf(commandStdout(), "Warning: %v\n", err)
+		fmt.Fprintln(commandStdout(), "Falling back to one adb process per command")
+	} else {
+		m.session = session
+	}
+
+	completer := newPathCompleter(ctx, getShellModeCompleter(), true)
+	completer.remoteCwd = m.remoteCwd
 
 	// Create readline instance for shell mode
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          prompt,
+		Prompt:          m.prompt(),
 		HistoryFile:     getShellHistoryPath(),
 		HistoryLimit:    100,
-		AutoComplete:    getShellModeCompleter(),
+		AutoComplete:    completer,
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 	})
@@ -33,14 +127,20 @@ func RunLocalShellMode(ctx *Context) error {
 	}
 	defer rl.Close()
 
-	fmt.Println("")
-	fmt.Printf("Entering shell mode for: %s\n", device.String())
-	fmt.Println("Type 'exit', 'quit', or Ctrl+D to return to GADB")
-	fmt.Println("For interactive commands (top, logcat), use: --pty")
-	fmt.Println("")
+	fmt.Fprintln(commandStdout(), "")
+	fmt.Fprintf(commandStdout(), "Entering shell mode for: %s\n", device.String())
+	fmt.Fprintln(commandStdout(), "Type 'exit', 'quit', or Ctrl+D to return to GADB")
+	fmt.Fprintln(commandStdout(), "For interactive commands (top, logcat), use: --pty (~? for PTY escapes)")
+	fmt.Fprintln(commandStdout(), "Builtins: put, get, lls, lcd, edit, as, root, source (type 'help' for details)")
+	fmt.Fprintln(commandStdout(), "")
+
+	// The line that entered shell mode ends here; each line typed in
+	// shell mode gets its own transcript entry
+	ctx.endTranscriptEntry(0)
 
 	// Shell mode loop
 	for {
+		rl.SetPrompt(m.prompt())
 		line, err := rl.Readline()
 		if err != nil {
 			// Handle Ctrl+D
@@ -67,37 +167,73 @@ func RunLocalShellMode(ctx *Context) error {
 			break
 		}
 
-		// Check for --pty flag to switch to PTY mode
-		if line == "--pty" || line == "-i" {
-			fmt.Println("Switching to PTY mode...")
-			ptyArgs := []string{"shell"}
-			ExecWithPTY(device.Serial, ptyArgs)
+		finish := ctx.beginTranscriptEntry("shell", line)
+		leave := m.execLine(line)
+		finish(m.lastExit)
+		if leave {
 			break
 		}
+	}
 
-		// Check if command ends with --pty for PTY execution of specific command
-		if strings.HasSuffix(line, " --pty") || strings.HasSuffix(line, " -i") {
-			// Extract the actual command
-			var actualCmd string
-			if strings.HasSuffix(line, " --pty") {
-				actualCmd = strings.TrimSuffix(line, " --pty")
-			} else {
-				actualCmd = strings.TrimSuffix(line, " -i")
-			}
-			actualCmd = strings.TrimSpace(actualCmd)
-			fmt.Printf("Running in PTY mode: %s\n", actualCmd)
-			ptyArgs := []string{"shell", actualCmd}
-			ExecWithPTY(device.Serial, ptyArgs)
-			continue
+	return nil
+}
+
+// execLine runs a line typed in shell mode and reports whether shell
+// mode should end
+func (m *shellMode) execLine(line string) bool {
+	ctx, device := m.ctx, m.device
+
+	// Check for --pty flag to switch to PTY mode
+	if line == "--pty" || line == "-i" {
+		fmt.Fprintln(commandStdout(), "Switching to PTY mode...")
+		ptyArgs := []string{"shell"}
+		d, err := followPTYSwitches(device, &ParsedCommand{Args: ptyArgs}, ctx.Config, ExecWithPTY(device.Serial, ptyArgs))
+		ctx.useDevice(d)
+		m.lastExit = exitCodeOf(err)
+		if err != nil {
+			fmt.Fprintf(commandStdout(), "Error: %v\n", err)
+		}
+		return true
+	}
+
+	// Check if command ends with --pty for PTY execution of specific command
+	if strings.HasSuffix(line, " --pty") || strings.HasSuffix(line, " -i") {
+		// Extract the actual command
+		var actualCmd string
+		if strings.HasSuffix(line, " --pty") {
+			actualCmd = strings.TrimSuffix(line, " --pty")
+		} else {
+			actualCmd = strings.TrimSuffix(line, " -i")
+		}
+		actualCmd = strings.TrimSpace(actualCmd)
+		fmt.Fprintf(commandStdout(), "Running in PTY mode: %s\n", actualCmd)
+		ptyArgs := []string{"shell", actualCmd}
+		d, err := followPTYSwitches(device, &ParsedCommand{Args: ptyArgs}, ctx.Config, ExecWithPTY(device.Serial, ptyArgs))
+		ctx.useDevice(d)
+		m.lastExit = exitCodeOf(err)
+		if err != nil {
+			fmt.Fprintf(commandStdout(), "Error: %v\n", err)
+		}
+		// A PTY escape may have moved to another device
+		if ctx.CurrentDevice == nil || ctx.CurrentDevice.Serial != device.Serial {
+			fmt.Fprintln(commandStdout(), "Exiting shell mode...")
+			return true
 		}
+		return false
+	}
 
-		// Execute the shell command
-		if err := ExecSingleShellCommand(device, line); err != nil {
-			fmt.Printf("Error: %v\n", err)
+	// Check for gadb builtins such as put and get
+	if handled, err := m.runBuiltin(line); handled {
+		if err != nil {
+			m.lastExit = exitCodeOf(err)
+			fmt.Fprintf(commandStdout(), "Error: %v\n", err)
 		}
+		return false
 	}
 
-	return nil
+	// Execute the shell command
+	m.run(line)
+	return false
 }
 
 // ExecSingleShellCommand executes a single shell command on the device
@@ -111,8 +247,8 @@ func ExecSingleShellCommand(device *Device, cmd string) error {
 
 	// Directly connect stdout and stderr for streaming output
 	// This supports real-time commands like top, logcat, etc.
-	cmdExec.Stdout = os.Stdout
-	cmdExec.Stderr = os.Stderr
+	cmdExec.Stdout = commandStdout()
+	cmdExec.Stderr = commandStderr()
 	cmdExec.Stdin = os.Stdin
 
 	return cmdExec.Run()
@@ -136,9 +272,13 @@ func getShellModeCompleter() *readline.PrefixCompleter {
 		readline.PcItem("exit"),
 		readline.PcItem("quit"),
 		readline.PcItem("q"),
+		readline.PcItem("help"),
 		readline.PcItem("--pty"),
 		readline.PcItem("-i"),
 	)
+	for _, name := range shellBuiltinNames() {
+		completers = append(completers, readline.PcItem(name))
+	}
 
 	return readline.NewPrefixCompleter(completers...)
 }
@@ -151,7 +291,7 @@ func buildShellModeShellCompleter() *readline.PrefixCompleter {
 	// pm with subcommands
 	pmItems := make([]readline.PrefixCompleterInterface, len(pmCommands))
 	for i, cmd := range pmCommands {
-		pmItems[i] = readline.PcItem(cmd)
+		pmItems[i] = readline.PcItem(cmd.name)
 	}
 	subItems = append(subItems, readline.PcItem("pm", pmItems...))
 
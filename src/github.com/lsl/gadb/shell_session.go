@@ -0,0 +1,321 @@
+package gadb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ShellSession is a long-lived "adb shell" connection to one device
+//
+// Commands are written to the remote shell's stdin and each one is
+// followed by a sentinel line that reports its exit status and the
+// shell's working directory, so state such as cd, export and su
+// carries over from one command to the next. Commands read from
+// /dev/null so they cannot consume the sentinel.
+//
+// The adb process runs in its own process group, so Ctrl+C does not
+// end the connection; instead SIGINT is sent to the remote shell's
+// process group, which interrupts the command while the shell, trapping
+// SIGINT, carries on.
+type ShellSession struct {
+	serial string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	// marker prefixes the sentinel line; it is random per session so
+	// command output cannot be mistaken for it
+	marker string
+	// pgid is the remote shell's process group, 0 when unknown
+	pgid int
+	// Cwd is the remote working directory after the last command
+	Cwd string
+	// LastExit is the exit status of the last command
+	LastExit int
+	mu       sync.Mutex
+	closed   bool
+}
+
+// NewShellSession starts a shell session on the device
+func NewShellSession(serial string) (*ShellSession, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("adb", "-s", serial, "shell")
+	setupCommand(cmd)
+	detachCommand(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start shell session: %w", err)
+	}
+
+	s := &ShellSession{
+		serial: serial,
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+		marker: "__GADB_" + hex.EncodeToString(token) + "__",
+		Cwd:    "/",
+	}
+
+	// Merge the remote stderr into stdout so output keeps its order,
+	// survive the SIGINT meant for commands, and learn the process group
+	// and the initial directory; old toolbox ps has no -o, but adbd
+	// starts the shell in a session of its own, so $$ is the group
+	var pgid bytes.Buffer
+	if _, err := s.run("exec 2>&1; trap : INT; ps -o pgid= -p $$ 2>/dev/null || echo $$", &pgid); err != nil {
+		s.Close()
+		return nil, err
+	}
+	fields := strings.Fields(pgid.String())
+	if len(fields) > 0 {
+		s.pgid, _ = strconv.Atoi(fields[len(fields)-1])
+	}
+	return s, nil
+}
+
+// Serial returns the serial of the session's device
+func (s *ShellSession) Serial() string {
+	return s.serial
+}
+
+// Alive reports whether the session can still run commands
+func (s *ShellSession) Alive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.closed
+}
+
+// Run executes a command in the session, streaming its output to out
+// It returns the command's exit status
+// The command's stdin is /dev/null, and one with an unterminated quote
+// is refused, as either would leave the shell waiting for more input
+// Ctrl+C interrupts the command and keeps the session; if the
+// connection drops the session is closed and an error is returned
+func (s *ShellSession) Run(command string, out io.Writer) (int, error) {
+	if err := checkComplete(command); err != nil {
+		return -1, err
+	}
+	if strings.TrimSpace(command) == "" {
+		command = ":"
+	}
+	// A group runs in the shell itself, so cd and export still stick;
+	// the newline ends a trailing comment
+	return s.run("{ "+command+"\n} </dev/null", out)
+}
+
+// run writes a script to the session followed by the sentinel
+func (s *ShellSession) run(command string, out io.Writer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return -1, fmt.Errorf("shell session closed")
+	}
+
+	// Ctrl+C interrupts the remote command instead of gadb
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	done := make(chan struct{})
+	defer func() {
+		signal.Stop(sigCh)
+		close(done)
+	}()
+	var interrupted atomic.Bool
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				interrupted.Store(true)
+				s.interrupt()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// A wrapped command may report a directory other than the shell's
+	// own by setting __gadb_cwd (see shellIdentity)
+	script := fmt.Sprintf("%s\nprintf '\\n%s %%s %%s\\n' \"$?\" \"${__gadb_cwd:-$PWD}\"; unset __gadb_cwd\n", command, s.marker)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		s.closeLocked()
+		return -1, fmt.Errorf("shell session write failed: %w", err)
+	}
+
+	status, cwd, err := s.readUntilMarker(out)
+	if err != nil {
+		s.closeLocked()
+		if interrupted.Load() {
+			return 130, fmt.Errorf("interrupted")
+		}
+		return -1, fmt.Errorf("shell session ended: %w", err)
+	}
+	s.LastExit = status
+	if cwd != "" {
+		s.Cwd = cwd
+	}
+	return status, nil
+}
+
+// interrupt sends SIGINT to the remote shell's process group over a
+// second connection; without a known group the connection is dropped,
+// which ends the command along with the session
+func (s *ShellSession) interrupt() {
+	if s.pgid <= 0 {
+		_ = s.cmd.Process.Kill()
+		return
+	}
+	cmd := exec.Command("adb", "-s", s.serial, "shell", fmt.Sprintf("kill -s INT -- -%d", s.pgid))
+	setupCommand(cmd)
+	detachCommand(cmd)
+	_ = cmd.Run()
+}
+
+// readUntilMarker copies output to out until the sentinel line
+// and returns the status and directory it reports
+func (s *ShellSession) readUntilMarker(out io.Writer) (int, string, error) {
+	sentinel := []byte("\n" + s.marker + " ")
+	var pending []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.stdout.Read(buf)
+		pending = append(pending, buf[:n]...)
+
+		if i := bytes.Index(pending, sentinel); i >= 0 {
+			rest := pending[i+len(sentinel):]
+			if j := bytes.IndexByte(rest, '\n'); j >= 0 {
+				_, _ = out.Write(pending[:i])
+				return parseSentinel(string(rest[:j]))
+			}
+		} else if keep := len(sentinel) - 1; len(pending) > keep {
+			// Flush everything that cannot be the start of a sentinel
+			_, _ = out.Write(pending[:len(pending)-keep])
+			pending = append(pending[:0], pending[len(pending)-keep:]...)
+		}
+
+		if err != nil {
+			_, _ = out.Write(pending)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return -1, "", err
+		}
+	}
+}
+
+// checkComplete refuses a command the shell would not consider
+// complete: an unterminated quote or a trailing backslash
+func checkComplete(command string) error {
+	var quote rune
+	escaped := false
+	for _, r := range command {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			}
+		case r == '\\':
+			escaped = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		}
+	}
+	switch {
+	case quote != 0:
+		return fmt.Errorf("unterminated %c quote", quote)
+	case escaped:
+		return fmt.Errorf("command ends with a backslash")
+	}
+	return nil
+}
+
+// parseSentinel parses "<status> <cwd>" from a sentinel line
+func parseSentinel(s string) (int, string, error) {
+	s = strings.TrimRight(s, "\r")
+	statusStr, cwd, _ := strings.Cut(s, " ")
+	status, err := strconv.Atoi(statusStr)
+	if err != nil {
+		return -1, "", fmt.Errorf("bad sentinel %q", s)
+	}
+	return status, cwd, nil
+}
+
+// Close ends the session
+func (s *ShellSession) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+// closeLocked ends the session; s.mu must be held
+func (s *ShellSession) closeLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	_ = s.stdin.Close()
+	if s.cmd.Process != nil {
+		_ = s.cmd.Process.Kill()
+	}
+	_ = s.cmd.Wait()
+}
+
+// shellSession returns the live shell session for a device, starting
+// a new one if needed
+// A replacement session is moved to the directory the old one was in
+func (c *Context) shellSession(device *Device) (*ShellSession, error) {
+	if c.shellSessions == nil {
+		c.shellSessions = make(map[string]*ShellSession)
+	}
+	old := c.shellSessions[device.Serial]
+	if old != nil && old.Alive() {
+		return old, nil
+	}
+
+	s, err := NewShellSession(device.Serial)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil && old.Cwd != "" && old.Cwd != s.Cwd {
+		_, _ = s.Run("cd "+shellQuote(old.Cwd), io.Discard)
+	}
+	c.shellSessions[device.Serial] = s
+	return s, nil
+}
+
+// closeShellSessions ends all shell sessions
+func (c *Context) closeShellSessions() {
+	for serial, s := range c.shellSessions {
+		s.Close()
+		delete(c.shellSessions, serial)
+	}
+}
+
+// shellQuote quotes s for the device's sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
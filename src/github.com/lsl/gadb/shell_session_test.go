@@ -0,0 +1,125 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShellSessionRun(t *testing.T) {
+	s, err := NewShellSession("fake-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	run := func(command string) (int, string, error) {
+		t.Helper()
+		var out strings.Builder
+		type result struct {
+			status int
+			err    error
+		}
+		done := make(chan result, 1)
+		go func() {
+			status, err := s.Run(command, &out)
+			done <- result{status, err}
+		}()
+		select {
+		case r := <-done:
+			return r.status, out.String(), r.err
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Run(%q) hung", command)
+			return 0, "", nil
+		}
+	}
+
+	if status, out, err := run("echo hello; false"); err != nil || status != 1 || out != "hello\n" {
+		t.Errorf("Run = %d, %q, %v", status, out, err)
+	}
+	// Commands reading stdin get /dev/null rather than the sentinel
+	for _, command := range []string{"cat", "read x; echo got$x", "sh"} {
+		if _, out, err := run(command); err != nil || strings.Contains(out, "__GADB_") {
+			t.Errorf("Run(%q) = %q, %v", command, out, err)
+		}
+	}
+	if status, out, err := run("echo done # comment"); err != nil || status != 0 || out != "done\n" {
+		t.Errorf("Run with a comment = %d, %q, %v", status, out, err)
+	}
+	for _, command := range []string{`echo 'oops`, `echo "it's`, `echo \`} {
+		if _, _, err := run(command); err == nil {
+			t.Errorf("Run(%q) accepted an incomplete command", command)
+		}
+	}
+	// State carries over between commands
+	dir := t.TempDir()
+	run("cd " + shellQuote(dir) + " && export GADB_TEST=kept")
+	if _, out, _ := run("echo $GADB_TEST"); s.Cwd != dir || out != "kept\n" {
+		t.Errorf("Cwd = %q, GADB_TEST = %q after cd and export", s.Cwd, out)
+	}
+	if !s.Alive() {
+		t.Error("session ended")
+	}
+}
+
+func TestShellSessionSurvivesInterrupt(t *testing.T) {
+	s, err := NewShellSession("fake-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// Ctrl+C in the terminal goes to gadb's process group only
+	if pgid, err := syscall.Getpgid(s.cmd.Process.Pid); err != nil || pgid == syscall.Getpgrp() {
+		t.Errorf("adb shell runs in gadb's process group (%v)", err)
+	}
+	dir := t.TempDir()
+	if _, err := s.Run("cd "+shellQuote(dir), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		status int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		status, err := s.Run("touch started; sleep 30", io.Discard)
+		done <- result{status, err}
+	}()
+	// Run catches SIGINT before it sends the command, so once the
+	// command has started gadb is safe from Ctrl+C
+	started := filepath.Join(dir, "started")
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the command did not start")
+		}
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil || r.status == 0 {
+			t.Errorf("interrupted Run = %d, %v", r.status, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ctrl+C did not interrupt the command")
+	}
+
+	var pwd strings.Builder
+	if _, err := s.Run("pwd", &pwd); err != nil || !s.Alive() {
+		t.Fatalf("session after Ctrl+C: %v", err)
+	}
+	if got := strings.TrimSpace(pwd.String()); got != dir || s.Cwd != dir {
+		t.Errorf("directory after Ctrl+C = %q (Cwd %q), want %q", got, s.Cwd, dir)
+	}
+}
@@ -0,0 +1,180 @@
+package gadb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Default address of the local adb server
+const defaultADBServerPort = "5037"
+
+// syncDialTimeout bounds how long we wait for the adb server
+const syncDialTimeout = 2 * time.Second
+
+// File mode bits as reported by the sync protocol (same as st_mode)
+const (
+	syncModeTypeMask = 0170000
+	syncModeDir      = 0040000
+	syncModeLink     = 0120000
+)
+
+// SyncEntry is a single directory entry returned by the sync LIST request
+type SyncEntry struct {
+	Name  string
+	Mode  uint32
+	Size  uint32
+	MTime time.Time
+}
+
+// IsDir reports whether the entry is a directory
+func (e SyncEntry) IsDir() bool {
+	return e.Mode&syncModeTypeMask == syncModeDir
+}
+
+// IsLink reports whether the entry is a symbolic link
+func (e SyncEntry) IsLink() bool {
+	return e.Mode&syncModeTypeMask == syncModeLink
+}
+
+// adbServerAddr returns the address of the local adb server,
+// honoring ANDROID_ADB_SERVER_PORT like the adb client does
+func adbServerAddr() string {
+	port := os.Getenv("ANDROID_ADB_SERVER_PORT")
+	if port == "" {
+		port = defaultADBServerPort
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// dialDevice opens a connection to the adb server and switches it
+// to the transport of the given device
+func dialDevice(serial string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", adbServerAddr(), syncDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendHostRequest(conn, "host:transport:"+serial); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sendHostRequest sends a length-prefixed request and waits for OKAY
+func sendHostRequest(conn net.Conn, req string) error {
+	if _, err := fmt.Fprintf(conn, "%04x%s", len(req), req); err != nil {
+		return err
+	}
+	return readStatus(conn)
+}
+
+// readStatus reads an OKAY/FAIL status from the adb server
+func readStatus(r io.Reader) error {
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(r, status); err != nil {
+		return err
+	}
+	switch string(status) {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		lenHex := make([]byte, 4)
+		if _, err := io.ReadFull(r, lenHex); err != nil {
+			return fmt.Errorf("adb server failure")
+		}
+		n, err := strconv.ParseUint(string(lenHex), 16, 32)
+		if err != nil {
+			return fmt.Errorf("adb server failure")
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return fmt.Errorf("adb server failure")
+		}
+		return fmt.Errorf("adb: %s", msg)
+	default:
+		return fmt.Errorf("unexpected adb status: %q", status)
+	}
+}
+
+// SyncList lists a directory on the device using the native sync protocol
+func SyncList(serial, dir string) ([]SyncEntry, error) {
+	conn, err := dialDevice(serial)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := sendHostRequest(conn, "sync:"); err != nil {
+		return nil, err
+	}
+	if err := writeSyncRequest(conn, "LIST", dir); err != nil {
+		return nil, err
+	}
+	if err := writeSyncRequest(conn, "QUIT", ""); err != nil {
+		return nil, err
+	}
+
+	var entries []SyncEntry
+	header := make([]byte, 20)
+	for {
+		if _, err := io.ReadFull(conn, header[:4]); err != nil {
+			return nil, err
+		}
+		id := string(header[:4])
+		if id == "FAIL" {
+			return nil, readSyncFail(conn)
+		}
+		if _, err := io.ReadFull(conn, header[4:]); err != nil {
+			return nil, err
+		}
+		if id == "DONE" {
+			return entries, nil
+		}
+		if id != "DENT" {
+			return nil, fmt.Errorf("unexpected sync response: %q", id)
+		}
+		nameLen := binary.LittleEndian.Uint32(header[16:20])
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, err
+		}
+		if string(name) == "." || string(name) == ".." {
+			continue
+		}
+		entries = append(entries, SyncEntry{
+			Name:  string(name),
+			Mode:  binary.LittleEndian.Uint32(header[4:8]),
+			Size:  binary.LittleEndian.Uint32(header[8:12]),
+			MTime: time.Unix(int64(binary.LittleEndian.Uint32(header[12:16])), 0),
+		})
+	}
+}
+
+// writeSyncRequest writes a sync protocol request: id, length, payload
+func writeSyncRequest(w io.Writer, id, payload string) error {
+	buf := make([]byte, 8+len(payload))
+	copy(buf, id)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	copy(buf[8:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readSyncFail reads the message that follows a sync FAIL id
+func readSyncFail(r io.Reader) error {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		return err
+	}
+	msg := make([]byte, binary.LittleEndian.Uint32(lenBuf))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return err
+	}
+	return fmt.Errorf("sync: %s", msg)
+}
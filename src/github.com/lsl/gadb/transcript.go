@@ -0,0 +1,254 @@
+package gadb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTranscriptOutput caps the output stored per transcript entry, so
+// a long logcat does not make a single multi-megabyte line
+const maxTranscriptOutput = 1 << 20
+
+// Transcript writes REPL inputs and their output as NDJSON, one entry
+// per command
+type Transcript struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+}
+
+// transcriptEntry is one line of a transcript file
+type transcriptEntry struct {
+	Time       string `json:"time"`
+	Mode       string `json:"mode"`
+	Serial     string `json:"serial,omitempty"`
+	Model      string `json:"model,omitempty"`
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Output     string `json:"output"`
+	Truncated  bool   `json:"truncated,omitempty"`
+}
+
+// OpenTranscript opens path for appending transcript entries
+func OpenTranscript(path string) (*Transcript, error) {
+	path = expandHome(path)
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create transcript directory: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript: %w", err)
+	}
+	return &Transcript{f: f, path: path}, nil
+}
+
+// Path returns the transcript file path
+func (t *Transcript) Path() string {
+	return t.path
+}
+
+// write appends an entry
+func (t *Transcript) write(e *transcriptEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.f.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the transcript file
+func (t *Transcript) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.f.Close()
+}
+
+// expandHome replaces a leading "~" or "~/" with the user's home
+// directory, leaving the path unchanged when there is none
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// outputCapture collects command output for the transcript entry
+// being recorded; commands write to it through commandStdout,
+// commandStderr and teeOutput
+var outputCapture struct {
+	sync.Mutex
+	buf       []byte
+	active    bool
+	truncated bool
+}
+
+// captureWriter appends to outputCapture while a capture is active
+type captureWriter struct{}
+
+func (captureWriter) Write(p []byte) (int, error) {
+	outputCapture.Lock()
+	defer outputCapture.Unlock()
+	if !outputCapture.active {
+		return len(p), nil
+	}
+	room := maxTranscriptOutput - len(outputCapture.buf)
+	if len(p) > room {
+		outputCapture.truncated = true
+		outputCapture.buf = append(outputCapture.buf, p[:room]...)
+	} else {
+		outputCapture.buf = append(outputCapture.buf, p...)
+	}
+	return len(p), nil
+}
+
+// capturing reports whether command output is being captured
+func capturing() bool {
+	outputCapture.Lock()
+	defer outputCapture.Unlock()
+	return outputCapture.active
+}
+
+// teeOutput returns w, copying writes into the transcript capture
+// when one is active
+func teeOutput(w io.Writer) io.Writer {
+	if !capturing() {
+		return w
+	}
+	return io.MultiWriter(w, captureWriter{})
+}
+
+// commandStdout is the writer commands use for standard output
+func commandStdout() io.Writer {
+	return teeOutput(os.Stdout)
+}
+
+// commandStderr is the writer commands use for standard error
+func commandStderr() io.Writer {
+	return teeOutput(os.Stderr)
+}
+
+// beginTranscriptEntry starts capturing output for one input line and
+// returns a function that writes the entry with the command's exit code
+// An entry still open is written first, so entries never nest; calling
+// the returned function again does nothing
+// It does nothing when no transcript is open
+func (c *Context) beginTranscriptEntry(mode, command string) func(exitCode int) {
+	c.endTranscriptEntry(0)
+	t := c.Transcript
+	if t == nil {
+		return func(int) {}
+	}
+	entry := &transcriptEntry{Mode: mode, Command: command}
+	if c.CurrentDevice != nil {
+		entry.Serial = c.CurrentDevice.Serial
+		entry.Model = devicePropValue(c.CurrentDevice.Model)
+	}
+	start := time.Now()
+
+	outputCapture.Lock()
+	outputCapture.buf = nil
+	outputCapture.truncated = false
+	outputCapture.active = true
+	outputCapture.Unlock()
+
+	done := false
+	finish := func(exitCode int) {
+		if done {
+			return
+		}
+		done = true
+		c.openEntry = nil
+
+		outputCapture.Lock()
+		entry.Output = string(outputCapture.buf)
+		entry.Truncated = outputCapture.truncated
+		outputCapture.buf = nil
+		outputCapture.active = false
+		outputCapture.Unlock()
+
+		// "log off" closed the transcript while this entry was open
+		if c.Transcript != t {
+			return
+		}
+		entry.Time = start.Format(time.RFC3339Nano)
+		entry.ExitCode = exitCode
+		entry.DurationMs = time.Since(start).Milliseconds()
+		if err := t.write(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: transcript: %v\n", err)
+		}
+	}
+	c.openEntry = finish
+	return finish
+}
+
+// endTranscriptEntry writes the open transcript entry, if any, with
+// the exit code; shell mode uses it so the line that entered it does
+// not span the whole session
+func (c *Context) endTranscriptEntry(exitCode int) {
+	if c.openEntry != nil {
+		c.openEntry(exitCode)
+	}
+}
+
+// startTranscript opens a transcript, replacing any open one
+func (c *Context) startTranscript(path string) error {
+	t, err := OpenTranscript(path)
+	if err != nil {
+		return err
+	}
+	c.stopTranscript()
+	c.Transcript = t
+	return nil
+}
+
+// stopTranscript closes the open transcript, if any
+func (c *Context) stopTranscript() {
+	if c.Transcript != nil {
+		_ = c.Transcript.Close()
+		c.Transcript = nil
+	}
+}
+
+// runLogCommand handles the REPL "log" command:
+// "log on <file>", "log off" and "log" to show the status
+func runLogCommand(ctx *Context, args []string) error {
+	if len(args) == 0 {
+		if ctx.Transcript != nil {
+			fmt.Fprintf(commandStdout(), "Logging to %s\n", ctx.Transcript.Path())
+		} else {
+			fmt.Fprintln(commandStdout(), "Not logging")
+		}
+		return nil
+	}
+	switch {
+	case args[0] == "on" && len(args) == 2:
+		if err := ctx.startTranscript(args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(commandStdout(), "Logging to %s\n", ctx.Transcript.Path())
+		return nil
+	case args[0] == "off" && len(args) == 1:
+		if ctx.Transcript != nil {
+			fmt.Fprintf(commandStdout(), "Transcript saved to %s\n", ctx.Transcript.Path())
+		}
+		ctx.stopTranscript()
+		return nil
+	}
+	return fmt.Errorf("usage: log [on <file> | off]")
+}
@@ -0,0 +1,91 @@
+//go:build linux || darwin
+
+package gadb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscriptRecordsRedirectedOutput(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{CurrentDevice: &Device{Serial: "fake-1", Model: "model:Fake_One"}}
+	if err := ctx.startTranscript(filepath.Join(dir, "log.ndjson")); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "shell echo hello > " + filepath.Join(dir, "out.txt")
+	finish := ctx.beginTranscriptEntry("repl", input)
+	err := ExecWithRedirect(ctx.CurrentDevice, ParseCommand(input), nil)
+	finish(exitCodeOf(err))
+	ctx.stopTranscript()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "log.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry transcriptEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("bad entry %q: %v", data, err)
+	}
+	if entry.Serial != "fake-1" || entry.Model != "Fake_One" || entry.Command != input {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry.Output != "hello\n" || entry.ExitCode != 0 {
+		t.Errorf("got output %q exit %d, want hello and 0", entry.Output, entry.ExitCode)
+	}
+}
+
+func TestTranscriptShellModeEntries(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{CurrentDevice: &Device{Serial: "fake-1"}}
+	if err := ctx.startTranscript(filepath.Join(dir, "log.ndjson")); err != nil {
+		t.Fatal(err)
+	}
+	m := &shellMode{ctx: ctx, device: ctx.CurrentDevice}
+
+	// The REPL's "shell" entry ends when shell mode starts
+	outer := ctx.beginTranscriptEntry("repl", "shell")
+	ctx.endTranscriptEntry(0)
+	for _, line := range []string{"echo hello", "lpwd", "put"} {
+		finish := ctx.beginTranscriptEntry("shell", line)
+		m.execLine(line)
+		finish(m.lastExit)
+	}
+	outer(0)
+	ctx.stopTranscript()
+
+	data, err := os.ReadFile(filepath.Join(dir, "log.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []transcriptEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e transcriptEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad entry %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	wd, _ := os.Getwd()
+	want := []struct{ command, output string }{
+		{"shell", ""},
+		{"echo hello", "hello\n"},
+		{"lpwd", wd + "\n"},
+		{"put", "Error: usage: put <local> [remote]\n"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		if entries[i].Command != w.command || entries[i].Output != w.output {
+			t.Errorf("entry %d = %q %q, want %q %q", i, entries[i].Command, entries[i].Output, w.command, w.output)
+		}
+	}
+}
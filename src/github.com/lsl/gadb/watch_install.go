@@ -0,0 +1,324 @@
+package gadb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gadb/src/github.com/lsl/gadb/apk"
+)
+
+const (
+	// watchSettle is how long an APK must stay unchanged before it is
+	// installed, so a file Gradle is still writing is left alone
+	watchSettle = time.Second
+	// watchPollInterval is how often the polling fallback looks
+	watchPollInterval = 500 * time.Millisecond
+	// watchRescan is how often the directory is scanned even without
+	// notifications, to pick it up again after a clean build removed it
+	watchRescan = 2 * time.Second
+	// watchBuildQuiet is how long the build tree must stay unchanged
+	// before the next change counts as the start of a new build, so
+	// files Gradle writes after the APK do not start one
+	watchBuildQuiet = 10 * time.Second
+)
+
+// dirWatcher signals changes anywhere under a directory
+type dirWatcher interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+// newDirWatcher watches dir with file system notifications on Linux,
+// polling otherwise; the second result names the method
+func newDirWatcher(dir string) (dirWatcher, string) {
+	w, err := newNotifyWatcher(dir)
+	if err == nil {
+		return w, "notifications"
+	}
+	return newPollWatcher(dir, watchPollInterval), fmt.Sprintf("polling; %v", err)
+}
+
+// signalChange sends on a change channel without blocking; one pending
+// signal is enough as the receiver rescans
+func signalChange(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// fileState is what tells one version of a file from the next
+type fileState struct {
+	size int64
+	mod  time.Time
+}
+
+// treeSnapshot returns the state of every file under dir
+func treeSnapshot(dir string) map[string]fileState {
+	files := make(map[string]fileState)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files[path] = fileState{size: info.Size(), mod: info.ModTime()}
+		}
+		return nil
+	})
+	return files
+}
+
+// apkStates keeps the APKs of a snapshot
+func apkStates(files map[string]fileState) map[string]fileState {
+	apks := make(map[string]fileState)
+	for path, st := range files {
+		if strings.HasSuffix(strings.ToLower(path), ".apk") {
+			apks[path] = st
+		}
+	}
+	return apks
+}
+
+// pollWatcher compares snapshots of the tree at an interval
+type pollWatcher struct {
+	events chan struct{}
+	done   chan struct{}
+}
+
+// newPollWatcher starts polling dir
+func newPollWatcher(dir string, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{events: make(chan struct{}, 1), done: make(chan struct{})}
+	last := treeSnapshot(dir)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			cur := treeSnapshot(dir)
+			if !sameSnapshot(last, cur) {
+				signalChange(w.events)
+			}
+			last = cur
+		}
+	}()
+	return w
+}
+
+func (w *pollWatcher) Events() <-chan struct{} { return w.events }
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+// sameSnapshot reports whether two snapshots list the same files in
+// the same states
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, st := range a {
+		if other, ok := b[path]; !ok || other.size != st.size || !other.mod.Equal(st.mod) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildRoot returns the build directory dir is in, such as app/build
+// for app/build/outputs/apk/debug, or dir itself when it is not in one
+// The whole build tree is watched so the build time starts with the
+// first task that writes to it rather than with the APK
+func buildRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for p := abs; ; p = filepath.Dir(p) {
+		if filepath.Base(p) == "build" {
+			if p == abs {
+				return dir
+			}
+			return p
+		}
+		if filepath.Dir(p) == p {
+			return dir
+		}
+	}
+}
+
+// apkWatch tracks the APKs under a directory between deploys
+type apkWatch struct {
+	dir string
+	// known are the APK states last deployed or seen at startup
+	known map[string]fileState
+	// pending are changed APKs, with the time one last changed
+	pending   map[string]fileState
+	changedAt time.Time
+	// buildStart is the first change in the build tree since the last
+	// deploy, or since it was last quiet; lastChange is the latest
+	buildStart time.Time
+	lastChange time.Time
+}
+
+// changed records a change in the build tree, which may start a build
+func (w *apkWatch) changed(now time.Time) {
+	if w.buildStart.IsZero() || len(w.pending) == 0 && now.Sub(w.lastChange) > watchBuildQuiet {
+		w.buildStart = now
+	}
+	w.lastChange = now
+}
+
+// scan looks for APKs that differ from the known ones
+func (w *apkWatch) scan(now time.Time) {
+	current := apkStates(treeSnapshot(w.dir))
+	for path, st := range current {
+		if old, ok := w.known[path]; ok && old == st {
+			delete(w.pending, path)
+			continue
+		}
+		if prev, ok := w.pending[path]; !ok || prev != st {
+			w.changed(now)
+			w.pending[path] = st
+			w.changedAt = now
+		}
+	}
+	for path := range w.pending {
+		if _, ok := current[path]; !ok {
+			delete(w.pending, path)
+		}
+	}
+}
+
+// ready returns the newest pending APK once all of them have settled,
+// with the build time, and marks them known; "" while none is ready
+func (w *apkWatch) ready(now time.Time) (string, time.Duration) {
+	if len(w.pending) == 0 || now.Sub(w.changedAt) < watchSettle {
+		return "", 0
+	}
+	newest := ""
+	for path, st := range w.pending {
+		if newest == "" || st.mod.After(w.pending[newest].mod) {
+			newest = path
+		}
+		w.known[path] = st
+	}
+	build := w.changedAt.Sub(w.buildStart)
+	w.pending = make(map[string]fileState)
+	w.buildStart = time.Time{}
+	return newest, build
+}
+
+// watchInstallUsage is shown for malformed watch-install commands
+const watchInstallUsage = "usage: watch-install [--all] <dir> [install flags]"
+
+// parseWatchInstallArgs splits "watch-install [--all] <dir> [flags]"
+func parseWatchInstallArgs(args []string) (all bool, dir string, installArgs []string, err error) {
+	for _, a := range args {
+		switch {
+		case a == "--all":
+			all = true
+		case dir == "" && !strings.HasPrefix(a, "-"):
+			dir = a
+		default:
+			installArgs = append(installArgs, a)
+		}
+	}
+	if dir == "" {
+		return false, "", nil, fmt.Errorf(watchInstallUsage)
+	}
+	return all, dir, installArgs, nil
+}
+
+// runWatchInstall watches dir for new or changed APKs and, once one
+// stops changing, reinstalls and relaunches it on the devices until
+// Ctrl+C; APKs present at startup are not installed
+// Changes anywhere in the enclosing build tree time the build
+func runWatchInstall(dir string, devices []Device, installArgs []string) error {
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("no device found")
+	}
+	installArgs = append([]string{"-r", "--launch"}, installArgs...)
+
+	root := buildRoot(dir)
+	w, method := newDirWatcher(root)
+	defer w.Close()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	serials := make([]string, len(devices))
+	for i, d := range devices {
+		serials[i] = d.Serial
+	}
+	fmt.Fprintf(commandStdout(), "Watching %s for APKs (%s), installing on %s; Ctrl+C to stop\n", dir, method, strings.Join(serials, ", "))
+	if root != dir {
+		fmt.Fprintf(commandStdout(), "Timing builds from the first change in %s\n", root)
+	}
+
+	watch := &apkWatch{
+		dir:     dir,
+		known:   apkStates(treeSnapshot(dir)),
+		pending: make(map[string]fileState),
+	}
+	ticker := time.NewTicker(watchSettle / 4)
+	defer ticker.Stop()
+	lastScan := time.Now()
+	for {
+		select {
+		case <-interrupt:
+			fmt.Fprintln(commandStdout(), "\nStopped watching")
+			return nil
+		case <-w.Events():
+			watch.changed(time.Now())
+		case <-ticker.C:
+			if len(watch.pending) == 0 && time.Since(lastScan) < watchRescan {
+				continue
+			}
+		}
+		now := time.Now()
+		watch.scan(now)
+		lastScan = now
+		if path, build := watch.ready(now); path != "" {
+			deployWatchedAPK(path, devices, installArgs, build)
+		}
+	}
+}
+
+// deployWatchedAPK installs and launches a settled APK on each device,
+// showing the build, install and launch times
+func deployWatchedAPK(path string, devices []Device, installArgs []string, build time.Duration) {
+	version := ""
+	if info, err := apk.Open(path); err == nil {
+		version = fmt.Sprintf(" %s (%d)", info.VersionName, info.VersionCode)
+	}
+	fmt.Fprintf(commandStdout(), "\n[%s] %s%s changed, build %s\n", time.Now().Format("15:04:05"), filepath.Base(path), version, build.Round(time.Millisecond))
+
+	var results []installResult
+	for _, d := range devices {
+		results = append(results, installOnDevice(d.Serial, append(installArgs, path)))
+	}
+	for _, r := range results {
+		switch r.outcome {
+		case installFailed:
+			fmt.Fprintf(commandStdout(), "  %-20s failed: %s\n", r.serial, r.detail)
+		case installSkipped:
+			fmt.Fprintf(commandStdout(), "  %-20s skipped: %s\n", r.serial, r.detail)
+		default:
+			fmt.Fprintf(commandStdout(), "  %-20s install %s  launch %s\n", r.serial,
+				r.installTime.Round(time.Millisecond), r.launchTime.Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gadb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPKWatchWaitsForTheFileToSettle(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.apk")
+	if err := os.WriteFile(old, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := &apkWatch{dir: dir, known: apkStates(treeSnapshot(dir)), pending: map[string]fileState{}}
+
+	t0 := time.Now()
+	w.changed(t0)
+	apk := filepath.Join(dir, "debug", "app-debug.apk")
+	if err := os.MkdirAll(filepath.Dir(apk), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(apk, []byte("half"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(t0.Add(100 * time.Millisecond))
+	if path, _ := w.ready(t0.Add(900 * time.Millisecond)); path != "" {
+		t.Fatalf("ready before settling: %s", path)
+	}
+
+	// Gradle is still writing
+	if err := os.WriteFile(apk, []byte("the whole apk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(t0.Add(1000 * time.Millisecond))
+	if path, _ := w.ready(t0.Add(1500 * time.Millisecond)); path != "" {
+		t.Fatalf("ready while still changing: %s", path)
+	}
+	w.scan(t0.Add(2100 * time.Millisecond))
+	path, build := w.ready(t0.Add(2100 * time.Millisecond))
+	if path != apk || build != time.Second {
+		t.Fatalf("ready = %q, %v, want %q after 1s", path, build, apk)
+	}
+
+	// Nothing changed since
+	w.scan(t0.Add(5 * time.Second))
+	if path, _ := w.ready(t0.Add(7 * time.Second)); path != "" {
+		t.Errorf("unchanged APK deployed again: %s", path)
+	}
+}
+
+func TestAPKWatchTimesTheBuild(t *testing.T) {
+	dir := t.TempDir()
+	apk := filepath.Join(dir, "app-debug.apk")
+	w := &apkWatch{dir: dir, known: map[string]fileState{}, pending: map[string]fileState{}}
+
+	// Gradle writes a file after the APK, then the tree goes quiet
+	t0 := time.Now()
+	w.changed(t0)
+	if err := os.WriteFile(apk, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(t0.Add(time.Second))
+	w.ready(t0.Add(2 * time.Second))
+	w.changed(t0.Add(3 * time.Second))
+
+	// The next build starts with its first change in the build tree,
+	// long before it writes the APK
+	t1 := t0.Add(time.Minute)
+	w.changed(t1)
+	w.changed(t1.Add(5 * time.Second))
+	if err := os.WriteFile(apk, []byte("version 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(t1.Add(8 * time.Second))
+	if path, build := w.ready(t1.Add(10 * time.Second)); path != apk || build != 8*time.Second {
+		t.Errorf("ready = %q, %v, want %q after 8s", path, build, apk)
+	}
+}
+
+func TestBuildRoot(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct{ dir, want string }{
+		{filepath.Join(dir, "app", "build", "outputs", "apk", "debug"), filepath.Join(dir, "app", "build")},
+		{filepath.Join("app", "build"), filepath.Join("app", "build")},
+		{filepath.Join(dir, "dist"), filepath.Join(dir, "dist")},
+	}
+	for _, tt := range tests {
+		if got := buildRoot(tt.dir); got != tt.want {
+			t.Errorf("buildRoot(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestDirWatcherSignalsChanges(t *testing.T) {
+	// Each watcher gets its own directory so one cannot pass on the
+	// other's file
+	for name, start := range map[string]func(dir string) dirWatcher{
+		"default": func(dir string) dirWatcher { w, _ := newDirWatcher(dir); return w },
+		"polling": func(dir string) dirWatcher { return newPollWatcher(dir, 10*time.Millisecond) },
+	} {
+		dir := t.TempDir()
+		w := start(dir)
+		if err := os.WriteFile(filepath.Join(dir, "app.apk"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-w.Events():
+		case <-time.After(3 * time.Second):
+			t.Errorf("%s watcher missed a new file", name)
+		}
+		w.Close()
+	}
+}
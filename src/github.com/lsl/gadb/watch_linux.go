@@ -0,0 +1,108 @@
+//go:build linux
+
+package gadb
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask is what inotifyWatcher listens for in each directory
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_DELETE_SELF
+
+// inotifyWatcher signals changes under a directory with inotify
+type inotifyWatcher struct {
+	fd     int
+	root   string
+	events chan struct{}
+	done   chan struct{}
+	closed chan struct{}
+}
+
+// newNotifyWatcher watches root and the directories below it
+func newNotifyWatcher(root string) (dirWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	w := &inotifyWatcher{
+		fd:     fd,
+		root:   root,
+		events: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	if err := w.addTree(); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	go w.loop()
+	return w, nil
+}
+
+// addTree watches every directory under root; inotify keeps one watch
+// per directory, so adding a watched one again is harmless
+func (w *inotifyWatcher) addTree() error {
+	return filepath.WalkDir(w.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == w.root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if _, err := unix.InotifyAddWatch(w.fd, path, inotifyMask); err != nil && path == w.root {
+			return fmt.Errorf("inotify: %w", err)
+		}
+		return nil
+	})
+}
+
+// loop reads events until Close; the fd is polled with a timeout so
+// Close does not wait on a blocked read
+func (w *inotifyWatcher) loop() {
+	defer close(w.closed)
+	defer unix.Close(w.fd)
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	idle := 0
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+		n, err := unix.Poll(fds, 250)
+		if err != nil && err != unix.EINTR {
+			return
+		}
+		if n <= 0 {
+			// A clean build may have removed the directory; watch it
+			// again once it is back
+			if idle++; idle%8 == 0 {
+				w.addTree()
+			}
+			continue
+		}
+		if _, err := unix.Read(w.fd, buf); err != nil {
+			continue
+		}
+		// New directories need watches of their own
+		w.addTree()
+		signalChange(w.events)
+	}
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} { return w.events }
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	<-w.closed
+	return nil
+}
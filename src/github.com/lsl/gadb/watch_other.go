@@ -0,0 +1,11 @@
+//go:build !linux
+
+package gadb
+
+import "errors"
+
+// newNotifyWatcher is only implemented with inotify, so watch-install
+// polls on other systems
+func newNotifyWatcher(root string) (dirWatcher, error) {
+	return nil, errors.New("file notifications are only used on Linux")
+}